@@ -0,0 +1,261 @@
+// Package access клиент CheckAccess сервиса доступов для backend сервисов.
+//
+// Решения по user_id кэшируются на время TTL, поэтому изменение роли
+// пользователя может учитываться с задержкой до TTL. Проверки по access токену
+// не кэшируются.
+package access
+
+import (
+	"context"
+	"fmt"
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"google.golang.org/grpc"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultTTL       = 30 * time.Second
+	DefaultCacheSize = 10_000
+)
+
+// Check параметры проверки доступа.
+type Check struct {
+	UserID      string
+	AccessToken string
+	Permission  string
+	DomainID    string
+	Resource    map[string]string
+}
+
+func (c Check) toProto() *perserv1.CheckAccessRequest {
+	return &perserv1.CheckAccessRequest{
+		UserId:      c.UserID,
+		AccessToken: c.AccessToken,
+		Permission:  c.Permission,
+		DomainId:    c.DomainID,
+		Resource:    c.Resource,
+	}
+}
+
+// cacheKey возвращает ключ кэша; пустая строка - проверку не кэшировать.
+func (c Check) cacheKey() string {
+	if c.AccessToken != "" || c.UserID == "" {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteString(c.UserID)
+	b.WriteByte('|')
+	b.WriteString(c.DomainID)
+	b.WriteByte('|')
+	b.WriteString(c.Permission)
+
+	keys := make([]string, 0, len(c.Resource))
+	for k := range c.Resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte('|')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(c.Resource[k])
+	}
+	return b.String()
+}
+
+// Decision результат проверки доступа.
+type Decision struct {
+	Allowed  bool
+	Reason   string
+	UserID   string
+	DomainID string
+	RoleID   string
+}
+
+func decisionFromProto(p *perserv1.CheckAccessResponse) Decision {
+	return Decision{
+		Allowed:  p.GetAllowed(),
+		Reason:   p.GetReason(),
+		UserID:   p.GetUserId(),
+		DomainID: p.GetDomainId(),
+		RoleID:   p.GetRoleId(),
+	}
+}
+
+type entry struct {
+	decision Decision
+	expires  time.Time
+}
+
+// Client обертка над PermissionsServiceClient с кэшем решений.
+type Client struct {
+	api  perserv1.PermissionsServiceClient
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]entry
+	// generation растет при каждом сбросе. Решение, полученное от сервиса, не
+	// кладется в кэш, если за время вызова кэш сбрасывался.
+	generation uint64
+}
+
+type Option func(*Client)
+
+// WithTTL время жизни решения в кэше; 0 отключает кэш.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.ttl = ttl
+	}
+}
+
+// WithCacheSize максимальное число решений в кэше.
+func WithCacheSize(size int) Option {
+	return func(c *Client) {
+		c.size = size
+	}
+}
+
+// New создает клиент поверх соединения с сервисом авторизации.
+func New(conn grpc.ClientConnInterface, opts ...Option) *Client {
+	return NewFromAPI(perserv1.NewPermissionsServiceClient(conn), opts...)
+}
+
+// NewFromAPI создает клиент поверх готового PermissionsServiceClient.
+func NewFromAPI(api perserv1.PermissionsServiceClient, opts ...Option) *Client {
+	c := &Client{
+		api:   api,
+		ttl:   DefaultTTL,
+		size:  DefaultCacheSize,
+		now:   time.Now,
+		cache: map[string]entry{},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Check проверяет доступ, используя кэш для проверок по user_id.
+func (c *Client) Check(ctx context.Context, check Check) (Decision, error) {
+	key := check.cacheKey()
+	generation := c.currentGeneration()
+	if decision, ok := c.get(key); ok {
+		return decision, nil
+	}
+
+	res, err := c.api.CheckAccess(ctx, check.toProto())
+	if err != nil {
+		return Decision{}, err
+	}
+
+	decision := decisionFromProto(res)
+	c.put(key, decision, generation)
+	return decision, nil
+}
+
+// Allowed сокращение для Check, возвращающее только факт разрешения.
+func (c *Client) Allowed(ctx context.Context, check Check) (bool, error) {
+	decision, err := c.Check(ctx, check)
+	return decision.Allowed, err
+}
+
+// CheckBatch проверяет несколько доступов за один вызов BatchCheckAccess;
+// в сервис отправляются только проверки, которых нет в кэше. Ответ с другим
+// числом результатов считается ошибкой.
+func (c *Client) CheckBatch(ctx context.Context, checks []Check) ([]Decision, error) {
+	decisions := make([]Decision, len(checks))
+	generation := c.currentGeneration()
+	var pending []int
+	var request perserv1.BatchCheckAccessRequest
+	for i, check := range checks {
+		if decision, ok := c.get(check.cacheKey()); ok {
+			decisions[i] = decision
+			continue
+		}
+		pending = append(pending, i)
+		request.Checks = append(request.Checks, check.toProto())
+	}
+
+	if len(pending) == 0 {
+		return decisions, nil
+	}
+
+	res, err := c.api.BatchCheckAccess(ctx, &request)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.GetResults()) != len(pending) {
+		return nil, fmt.Errorf("batch check access: %d results for %d checks", len(res.GetResults()), len(pending))
+	}
+
+	for j, result := range res.GetResults() {
+		i := pending[j]
+		decisions[i] = decisionFromProto(result)
+		c.put(checks[i].cacheKey(), decisions[i], generation)
+	}
+	return decisions, nil
+}
+
+// Invalidate очищает кэш, например после получения уведомления об изменении доступов.
+func (c *Client) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.cache = map[string]entry{}
+}
+
+func (c *Client) currentGeneration() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+func (c *Client) get(key string) (Decision, bool) {
+	if key == "" || c.ttl <= 0 {
+		return Decision{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.cache[key]
+	if !ok {
+		return Decision{}, false
+	}
+	if c.now().After(e.expires) {
+		delete(c.cache, key)
+		return Decision{}, false
+	}
+	return e.decision, true
+}
+
+// put кладет решение в кэш, если с момента currentGeneration кэш не
+// сбрасывался.
+func (c *Client) put(key string, decision Decision, generation uint64) {
+	if key == "" || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+
+	if len(c.cache) >= c.size {
+		now := c.now()
+		for k, e := range c.cache {
+			if now.After(e.expires) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= c.size {
+			c.cache = map[string]entry{}
+		}
+	}
+	c.cache[key] = entry{decision: decision, expires: c.now().Add(c.ttl)}
+}
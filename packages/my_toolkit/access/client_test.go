@@ -0,0 +1,92 @@
+package access
+
+import (
+	"context"
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"testing"
+)
+
+// permissionsStub отвечает на проверки и вызывает during во время вызова.
+type permissionsStub struct {
+	perserv1.PermissionsServiceClient
+	calls   int
+	results int
+	during  func()
+}
+
+func (s *permissionsStub) CheckAccess(context.Context, *perserv1.CheckAccessRequest, ...grpc.CallOption) (*perserv1.CheckAccessResponse, error) {
+	s.calls++
+	if s.during != nil {
+		s.during()
+	}
+	return &perserv1.CheckAccessResponse{Allowed: true, UserId: "user", RoleId: "role"}, nil
+}
+
+func (s *permissionsStub) BatchCheckAccess(context.Context, *perserv1.BatchCheckAccessRequest, ...grpc.CallOption) (*perserv1.BatchCheckAccessResponse, error) {
+	s.calls++
+	res := &perserv1.BatchCheckAccessResponse{}
+	for range s.results {
+		res.Results = append(res.Results, &perserv1.CheckAccessResponse{Allowed: true})
+	}
+	return res, nil
+}
+
+func TestClient_Check(t *testing.T) {
+	ctx := context.Background()
+	check := Check{UserID: "user", Permission: "users.read"}
+
+	t.Run("решение кэшируется до сброса", func(t *testing.T) {
+		stub := &permissionsStub{}
+		client := NewFromAPI(stub)
+
+		for range 2 {
+			allowed, err := client.Allowed(ctx, check)
+			require.NoError(t, err)
+			assert.True(t, allowed)
+		}
+		assert.Equal(t, 1, stub.calls)
+
+		client.Evict(Change{RoleID: "role"})
+		_, err := client.Check(ctx, check)
+		require.NoError(t, err)
+		assert.Equal(t, 2, stub.calls)
+	})
+
+	t.Run("сброс во время вызова", func(t *testing.T) {
+		stub := &permissionsStub{}
+		client := NewFromAPI(stub)
+		stub.during = func() { client.Evict(Change{UserID: "user"}) }
+
+		_, err := client.Check(ctx, check)
+		require.NoError(t, err)
+		stub.during = nil
+
+		_, err = client.Check(ctx, check)
+		require.NoError(t, err)
+		assert.Equal(t, 2, stub.calls)
+	})
+}
+
+func TestClient_CheckBatch(t *testing.T) {
+	ctx := context.Background()
+	checks := []Check{
+		{UserID: "user", Permission: "users.read"},
+		{UserID: "user", Permission: "users.write"},
+	}
+
+	t.Run("результат на каждую проверку", func(t *testing.T) {
+		client := NewFromAPI(&permissionsStub{results: 2})
+		decisions, err := client.CheckBatch(ctx, checks)
+		require.NoError(t, err)
+		assert.Len(t, decisions, 2)
+	})
+
+	t.Run("число результатов не совпадает", func(t *testing.T) {
+		client := NewFromAPI(&permissionsStub{results: 1})
+		_, err := client.CheckBatch(ctx, checks)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,131 @@
+package access
+
+import (
+	"context"
+	"errors"
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"strings"
+	"time"
+)
+
+// Виды изменений WatchPermissionChanges.
+const (
+	ChangeHeartbeat    = "heartbeat"
+	ChangeRoleUpdated  = "role_updated"
+	ChangeRoleDeleted  = "role_deleted"
+	ChangeMembership   = "membership_changed"
+	ChangeUserDisabled = "user_disabled"
+	ChangeUserRestored = "user_restored"
+)
+
+const (
+	watchMinBackoff = 100 * time.Millisecond
+	watchMaxBackoff = 10 * time.Second
+)
+
+// Change уведомление об изменении доступов.
+type Change struct {
+	ResumeToken string
+	Kind        string
+	UserID      string
+	DomainID    string
+	RoleID      string
+	Time        time.Time
+}
+
+func changeFromProto(p *perserv1.WatchPermissionChangesResponse) Change {
+	return Change{
+		ResumeToken: p.GetResumeToken(),
+		Kind:        p.GetKind(),
+		UserID:      p.GetUserId(),
+		DomainID:    p.GetDomainId(),
+		RoleID:      p.GetRoleId(),
+		Time:        p.GetTime().AsTime(),
+	}
+}
+
+// Watch держит подписку WatchPermissionChanges до отмены ctx и передает
+// изменения в handle; heartbeat в handle не попадают. После обрыва подписка
+// возобновляется с последнего полученного токена. reset вызывается, когда
+// часть изменений могла быть пропущена: при первом подключении и
+// переподключении без токена, а также если токен устарел. В reset кэш нужно
+// очистить целиком.
+func Watch(ctx context.Context, api perserv1.PermissionsServiceClient, handle func(Change), reset func()) {
+	var token string
+	backoff := watchMinBackoff
+	for ctx.Err() == nil {
+		received, err := watchOnce(ctx, api, &token, handle, reset)
+		if ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) == codes.OutOfRange {
+			token = ""
+		}
+		if received {
+			backoff = watchMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, watchMaxBackoff)
+	}
+}
+
+// watchOnce читает одну подписку до ошибки. received сообщает, что
+// подписка успела получить хотя бы одно уведомление.
+func watchOnce(ctx context.Context, api perserv1.PermissionsServiceClient, token *string, handle func(Change), reset func()) (received bool, err error) {
+	stream, err := api.WatchPermissionChanges(ctx, &perserv1.WatchPermissionChangesRequest{ResumeToken: *token})
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return received, nil
+			}
+			return received, err
+		}
+
+		change := changeFromProto(res)
+		if !received && *token == "" {
+			// Пока подписки не было, изменения не отслеживались.
+			reset()
+		}
+		received = true
+		*token = change.ResumeToken
+		if change.Kind != ChangeHeartbeat {
+			handle(change)
+		}
+	}
+}
+
+// Watch подписывается на изменения доступов и удаляет из кэша затронутые
+// решения до отмены ctx. С подпиской TTL ограничивает лишь время, на которое
+// кэш может устареть при недоступности сервиса доступов.
+func (c *Client) Watch(ctx context.Context) {
+	Watch(ctx, c.api, c.Evict, c.Invalidate)
+}
+
+// Evict удаляет из кэша решения, на которые влияет изменение change.
+func (c *Client) Evict(change Change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key, e := range c.cache {
+		switch {
+		case change.UserID != "" && (e.decision.UserID == change.UserID || strings.HasPrefix(key, change.UserID+"|")):
+			delete(c.cache, key)
+		case change.RoleID != "" && e.decision.RoleID == change.RoleID:
+			delete(c.cache, key)
+		}
+	}
+}
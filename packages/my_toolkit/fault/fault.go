@@ -0,0 +1,54 @@
+// Package fault описывает ошибки бизнес-логики сервисов.
+//
+// Ошибка несет код (Code), по которому faultstatus определяет статус gRPC, а
+// faultlocale - сообщение на языке клиента. Текст ошибки - сам код, поэтому
+// ошибки с одинаковыми сообщениями в локалях не путаются между собой.
+//
+// Коды объявляются константами с сообщением в комментарии, из которого
+// faultgen собирает файлы локалей:
+//
+//	const UserNotFoundErr fault.Code = "UserNotFoundErr" // UserNotFoundErr: "пользователь не найден"
+package fault
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Code код ошибки.
+type Code string
+
+// UnhandledError код непредвиденной ошибки, подробности которой клиенту не раскрываются.
+const UnhandledError Code = "UnhandledError"
+
+// Err возвращает ошибку с кодом c.
+func (c Code) Err() *Fault {
+	return &Fault{code: c}
+}
+
+// Fault ошибка с кодом.
+type Fault struct {
+	code Code
+}
+
+// Code возвращает код ошибки.
+func (f *Fault) Code() Code {
+	return f.code
+}
+
+func (f *Fault) Error() string {
+	return string(f.code)
+}
+
+// Is сравнивает ошибки по коду, чтобы errors.Is находил fault среди
+// обернутых ошибок.
+func (f *Fault) Is(target error) bool {
+	t, ok := target.(*Fault)
+	return ok && t.code == f.code
+}
+
+// ToProto возвращает ошибку gRPC с кодом в сообщении. Статус по коду
+// назначает faultstatus.
+func (f *Fault) ToProto() error {
+	return status.Error(codes.Unknown, f.Error())
+}
@@ -0,0 +1,23 @@
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testNotFoundErr Code = "testNotFoundErr"
+
+func TestFault(t *testing.T) {
+	err := fmt.Errorf("context: %w", testNotFoundErr.Err())
+
+	f := new(Fault)
+	require.ErrorAs(t, err, &f)
+	assert.Equal(t, testNotFoundErr, f.Code())
+	assert.Equal(t, "testNotFoundErr", f.Error())
+
+	assert.ErrorIs(t, err, testNotFoundErr.Err())
+	assert.False(t, errors.Is(err, UnhandledError.Err()))
+}
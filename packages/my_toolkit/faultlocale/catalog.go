@@ -0,0 +1,142 @@
+// Package faultlocale переводит сообщения ошибок fault на язык клиента.
+//
+// Файлы локалей <язык>.yaml (ru.yaml, en.yaml) содержат пары
+// КодОшибки: "сообщение" и встраиваются в бинарь сервиса через embed.FS.
+// Язык клиента берется из метаданных accept-language, которые grpc-gateway
+// заполняет заголовком Accept-Language; если подходящего перевода нет,
+// используется язык по умолчанию.
+package faultlocale
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hughbliss/my_toolkit/fault"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Catalog сообщения кодов fault на нескольких языках.
+type Catalog struct {
+	fallback string
+	messages map[string]map[fault.Code]string
+}
+
+// Load читает файлы *.yaml из корня fsys. fallback - язык, сообщения
+// которого отдаются, когда перевода на язык клиента нет; его файл обязателен.
+func Load(fsys fs.FS, fallback string) (*Catalog, error) {
+	files, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Catalog{
+		fallback: normalize(fallback),
+		messages: make(map[string]map[fault.Code]string, len(files)),
+	}
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[fault.Code]string
+		if err := yaml.Unmarshal(content, &messages); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", file, err)
+		}
+
+		lang := normalize(strings.TrimSuffix(path.Base(file), ".yaml"))
+		c.messages[lang] = messages
+	}
+
+	if _, ok := c.messages[c.fallback]; !ok {
+		return nil, fmt.Errorf("fallback locale %q not found", fallback)
+	}
+	return c, nil
+}
+
+// Languages возвращает языки каталога по алфавиту.
+func (c *Catalog) Languages() []string {
+	languages := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Message возвращает сообщение кода на языке, лучше всего подходящем под
+// значение заголовка Accept-Language, и сам язык.
+func (c *Catalog) Message(code fault.Code, acceptLanguage string) (message, lang string, ok bool) {
+	for _, candidate := range append(parseAcceptLanguage(acceptLanguage), c.fallback) {
+		if message, ok := c.messages[candidate][code]; ok {
+			return message, candidate, true
+		}
+		if base, _, found := strings.Cut(candidate, "-"); found {
+			if message, ok := c.messages[base][code]; ok {
+				return message, base, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Text возвращает сообщение ошибки err на языке по умолчанию, например для
+// вывода в консоль. Ошибки без кода fault возвращаются как есть.
+func (c *Catalog) Text(err error) string {
+	f := new(fault.Fault)
+	if !errors.As(err, &f) {
+		return err.Error()
+	}
+	message, _, ok := c.Message(f.Code(), "")
+	if !ok {
+		return err.Error()
+	}
+	return message
+}
+
+type weighted struct {
+	lang string
+	q    float64
+}
+
+// parseAcceptLanguage возвращает языки заголовка Accept-Language по
+// убыванию веса; языки с нулевым весом и * пропускаются.
+func parseAcceptLanguage(header string) []string {
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = normalize(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{lang: tag, q: q})
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	languages := make([]string, len(tags))
+	for i, tag := range tags {
+		languages[i] = tag.lang
+	}
+	return languages
+}
+
+func normalize(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
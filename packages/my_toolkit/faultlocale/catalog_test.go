@@ -0,0 +1,81 @@
+package faultlocale
+
+import (
+	"context"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"testing"
+	"testing/fstest"
+)
+
+const testNotFoundErr fault.Code = "TestNotFoundErr"
+
+var testLocales = fstest.MapFS{
+	"ru.yaml": {Data: []byte(`TestNotFoundErr: "не найдено"`)},
+	"en.yaml": {Data: []byte(`TestNotFoundErr: "not found"`)},
+}
+
+func TestCatalog_Message(t *testing.T) {
+	catalog, err := Load(testLocales, "ru")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"en", "ru"}, catalog.Languages())
+
+	cases := []struct {
+		accept, message, lang string
+	}{
+		{"", "не найдено", "ru"},
+		{"en", "not found", "en"},
+		{"en-US,en;q=0.9", "not found", "en"},
+		{"de-DE, ru;q=0.5, en;q=0.7", "not found", "en"},
+		{"de, en;q=0", "не найдено", "ru"},
+		{"*", "не найдено", "ru"},
+	}
+	for _, c := range cases {
+		t.Run(c.accept, func(t *testing.T) {
+			message, lang, ok := catalog.Message(testNotFoundErr, c.accept)
+			require.True(t, ok)
+			assert.Equal(t, c.message, message)
+			assert.Equal(t, c.lang, lang)
+		})
+	}
+
+	_, _, ok := catalog.Message("UnknownErr", "en")
+	assert.False(t, ok)
+
+	_, err = Load(testLocales, "de")
+	assert.Error(t, err)
+}
+
+func TestCatalog_Localize(t *testing.T) {
+	catalog, err := Load(testLocales, "ru")
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(gatewayMetadataKey, "en-GB"))
+	st := status.Convert(catalog.Localize(ctx, faultstatus.ToProto(testNotFoundErr.Err())))
+	assert.Equal(t, "not found", st.Message())
+
+	var localized *errdetails.LocalizedMessage
+	for _, detail := range st.Details() {
+		if m, ok := detail.(*errdetails.LocalizedMessage); ok {
+			localized = m
+		}
+	}
+	require.NotNil(t, localized)
+	assert.Equal(t, "en", localized.GetLocale())
+
+	// Ошибка fault, не прошедшая faultstatus, получает код до перевода.
+	st = status.Convert(catalog.Localize(ctx, testNotFoundErr.Err()))
+	assert.Equal(t, "not found", st.Message())
+	code, ok := faultstatus.CodeOf(st)
+	assert.True(t, ok)
+	assert.Equal(t, testNotFoundErr, code)
+
+	plain := status.Error(codes.Internal, "boom")
+	assert.Equal(t, plain, catalog.Localize(ctx, plain))
+}
@@ -0,0 +1,60 @@
+// Команда faultgen обновляет файлы локалей по константам fault.Code сервиса.
+// Сообщения локали -source берутся из комментариев констант, в остальные
+// локали добавляются пустые строки для новых кодов.
+//
+// Использование в пакете с локалями сервиса:
+//
+//	//go:generate go run github.com/hughbliss/my_toolkit/faultlocale/cmd/faultgen -src .. -langs ru,en
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/hughbliss/my_toolkit/faultlocale"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	src := flag.String("src", ".", "каталог исходников сервиса")
+	dir := flag.String("dir", ".", "каталог файлов локалей")
+	source := flag.String("source", "ru", "язык комментариев констант")
+	langs := flag.String("langs", "", "языки через запятую; существующие файлы локалей обновляются всегда")
+	flag.Parse()
+
+	if err := run(*src, *dir, *source, *langs); err != nil {
+		fmt.Fprintln(os.Stderr, "faultgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(src, dir, source, langs string) error {
+	entries, err := faultlocale.Scan(src)
+	if err != nil {
+		return err
+	}
+
+	languages := map[string]struct{}{source: {}}
+	for _, lang := range strings.Split(langs, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			languages[lang] = struct{}{}
+		}
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, file := range existing {
+		languages[strings.TrimSuffix(filepath.Base(file), ".yaml")] = struct{}{}
+	}
+
+	for lang := range languages {
+		filename := filepath.Join(dir, lang+".yaml")
+		if err := faultlocale.WriteLocale(filename, entries, lang == source); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("faultgen: %d codes, %d locales\n", len(entries), len(languages))
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "errors.go"), []byte(`package p
+
+import "github.com/hughbliss/my_toolkit/fault"
+
+const NotFoundErr fault.Code = "NotFoundErr" // NotFoundErr: "не найдено"
+`), 0o600))
+	// Существующая локаль обновляется, даже если ее нет в -langs.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "de.yaml"), []byte("NotFoundErr: \"nicht gefunden\"\n"), 0o600))
+
+	require.NoError(t, run(src, dir, "ru", "ru, en"))
+
+	for lang, want := range map[string]string{
+		"ru": "NotFoundErr: \"не найдено\"\n",
+		"en": "NotFoundErr: \"\"\n",
+		"de": "NotFoundErr: \"nicht gefunden\"\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, lang+".yaml"))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), lang)
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(src, "broken.go"), []byte(`package p
+
+import "github.com/hughbliss/my_toolkit/fault"
+
+const BrokenErr fault.Code = "BrokenErr"
+`), 0o600))
+	assert.Error(t, run(src, dir, "ru", ""))
+}
@@ -0,0 +1,86 @@
+package faultlocale
+
+import (
+	"context"
+	"errors"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ключи метаданных с языком клиента. grpc-gateway передает заголовок
+// Accept-Language с префиксом grpcgateway-, если шлюз не настроен передавать
+// его как есть.
+const (
+	MetadataKey        = "accept-language"
+	gatewayMetadataKey = "grpcgateway-accept-language"
+)
+
+// AcceptLanguage возвращает значение Accept-Language из входящих метаданных.
+func AcceptLanguage(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, key := range []string{MetadataKey, gatewayMetadataKey} {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// Localize заменяет сообщение статуса ошибки fault переводом на язык клиента
+// и добавляет errdetails.LocalizedMessage. Сообщение заменяется только после
+// того, как определен код: ошибка fault, еще не переведенная в статус,
+// сначала переводится faultstatus. Прочие ошибки возвращаются как есть.
+func (c *Catalog) Localize(ctx context.Context, err error) error {
+	if f := new(fault.Fault); errors.As(err, &f) {
+		err = faultstatus.ToProto(err)
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	code, ok := faultstatus.CodeOf(st)
+	if !ok {
+		return err
+	}
+	message, lang, ok := c.Message(code, AcceptLanguage(ctx))
+	if !ok {
+		return err
+	}
+
+	p := st.Proto()
+	p.Message = message
+	localized := status.FromProto(p)
+	detailed, derr := localized.WithDetails(&errdetails.LocalizedMessage{Locale: lang, Message: message})
+	if derr != nil {
+		return localized.Err()
+	}
+	return detailed.Err()
+}
+
+// UnaryServerInterceptor переводит ошибки unary обработчиков.
+func (c *Catalog) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, c.Localize(ctx, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor переводит ошибки потоковых обработчиков.
+func (c *Catalog) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := handler(srv, stream); err != nil {
+			return c.Localize(stream.Context(), err)
+		}
+		return nil
+	}
+}
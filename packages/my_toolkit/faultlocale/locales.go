@@ -0,0 +1,149 @@
+package faultlocale
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hughbliss/my_toolkit/fault"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// Verify сверяет файлы локалей fsys с константами fault.Code в каталоге dir:
+// каждый код должен иметь непустое сообщение во всех локалях, а сообщения
+// локали source - совпадать с комментариями констант.
+func Verify(dir string, fsys fs.FS, source string) error {
+	entries, err := Scan(dir)
+	if err != nil {
+		return err
+	}
+
+	files, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no locale files")
+	}
+
+	var problems []error
+	sourceFound := false
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		messages, _, err := parseLocale(content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		isSource := strings.TrimSuffix(path.Base(file), ".yaml") == source
+		sourceFound = sourceFound || isSource
+		for _, entry := range entries {
+			message := messages[entry.Code]
+			switch {
+			case message == "":
+				problems = append(problems, fmt.Errorf("%s: no translation for %s (%s)", file, entry.Code, entry.Pos))
+			case isSource && message != entry.Message:
+				problems = append(problems, fmt.Errorf("%s: %s differs from the comment at %s", file, entry.Code, entry.Pos))
+			}
+		}
+	}
+	if !sourceFound {
+		problems = append(problems, fmt.Errorf("source locale %s.yaml not found", source))
+	}
+	return errors.Join(problems...)
+}
+
+// WriteLocale обновляет файл локали filename по найденным константам. Коды
+// записываются в порядке entries, коды из файла без констант (например,
+// коды toolkit) сохраняются в конце. В локали source сообщения берутся из
+// комментариев, в остальных сохраняется перевод, а для новых кодов
+// записывается пустая строка, которую Verify считает отсутствующим переводом.
+func WriteLocale(filename string, entries []Entry, source bool) error {
+	var messages map[fault.Code]string
+	var order []fault.Code
+	content, err := os.ReadFile(filename)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if messages, order, err = parseLocale(content); err != nil {
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	written := make(map[fault.Code]struct{}, len(entries))
+	write := func(code fault.Code, message string) error {
+		if _, ok := written[code]; ok {
+			return nil
+		}
+		written[code] = struct{}{}
+		quoted, err := quote(message)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(&buf, "%s: %s\n", code, quoted)
+		return err
+	}
+
+	for _, entry := range entries {
+		message := messages[entry.Code]
+		if source {
+			message = entry.Message
+		}
+		if err := write(entry.Code, message); err != nil {
+			return err
+		}
+	}
+	for _, code := range order {
+		if err := write(code, messages[code]); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(filename, buf.Bytes(), 0o644)
+}
+
+// parseLocale возвращает сообщения файла локали и порядок кодов в нем.
+func parseLocale(content []byte) (map[fault.Code]string, []fault.Code, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, nil, err
+	}
+	messages := map[fault.Code]string{}
+	if len(doc.Content) == 0 {
+		return messages, nil, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, errors.New("locale must be a mapping of codes to messages")
+	}
+	order := make([]fault.Code, 0, len(root.Content)/2)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		code := fault.Code(root.Content[i].Value)
+		messages[code] = root.Content[i+1].Value
+		order = append(order, code)
+	}
+	return messages, order, nil
+}
+
+// quote возвращает сообщение в двойных кавычках; строка JSON - корректная
+// строка YAML.
+func quote(message string) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(message); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
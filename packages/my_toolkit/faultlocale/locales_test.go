@@ -0,0 +1,146 @@
+package faultlocale
+
+import (
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// writeSource создает каталог исходников с кодами NotFoundErr и InvalidErr.
+func writeSource(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "errors.go"), []byte(`package p
+
+import "github.com/hughbliss/my_toolkit/fault"
+
+const (
+	NotFoundErr fault.Code = "NotFoundErr" // NotFoundErr: "не найдено"
+	InvalidErr  fault.Code = "InvalidErr"  // InvalidErr: "некорректный запрос"
+)
+`), 0o600))
+	return dir
+}
+
+func TestWriteLocale(t *testing.T) {
+	entries := []Entry{
+		{Code: "NotFoundErr", Message: "не найдено"},
+		{Code: "InvalidErr", Message: "некорректный \"запрос\""},
+	}
+
+	cases := []struct {
+		name     string
+		existing string
+		source   bool
+		want     string
+	}{
+		{
+			name:   "новая локаль source",
+			source: true,
+			want:   "NotFoundErr: \"не найдено\"\nInvalidErr: \"некорректный \\\"запрос\\\"\"\n",
+		},
+		{
+			name: "новая локаль перевода",
+			want: "NotFoundErr: \"\"\nInvalidErr: \"\"\n",
+		},
+		{
+			name:     "перевод и коды без констант сохраняются",
+			existing: "UnhandledError: \"internal server error\"\nNotFoundErr: \"not found\"\n",
+			want:     "NotFoundErr: \"not found\"\nInvalidErr: \"\"\nUnhandledError: \"internal server error\"\n",
+		},
+		{
+			name:     "source берет сообщения из комментариев",
+			existing: "NotFoundErr: \"устарело\"\nUnhandledError: \"внутренняя ошибка сервера\"\n",
+			source:   true,
+			want:     "NotFoundErr: \"не найдено\"\nInvalidErr: \"некорректный \\\"запрос\\\"\"\nUnhandledError: \"внутренняя ошибка сервера\"\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "locale.yaml")
+			if c.existing != "" {
+				require.NoError(t, os.WriteFile(filename, []byte(c.existing), 0o600))
+			}
+
+			require.NoError(t, WriteLocale(filename, entries, c.source))
+			content, err := os.ReadFile(filename)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, string(content))
+
+			messages, _, err := parseLocale(content)
+			require.NoError(t, err)
+			if c.source {
+				assert.Equal(t, `некорректный "запрос"`, messages[fault.Code("InvalidErr")])
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	src := writeSource(t)
+	const (
+		ru = "NotFoundErr: \"не найдено\"\nInvalidErr: \"некорректный запрос\"\n"
+		en = "NotFoundErr: \"not found\"\nInvalidErr: \"invalid request\"\n"
+	)
+
+	cases := []struct {
+		name    string
+		locales fstest.MapFS
+		errs    []string
+	}{
+		{
+			name:    "все переводы на месте",
+			locales: fstest.MapFS{"ru.yaml": {Data: []byte(ru)}, "en.yaml": {Data: []byte(en)}},
+		},
+		{
+			name: "нет перевода",
+			locales: fstest.MapFS{
+				"ru.yaml": {Data: []byte(ru)},
+				"en.yaml": {Data: []byte("NotFoundErr: \"not found\"\n")},
+			},
+			errs: []string{"en.yaml: no translation for InvalidErr"},
+		},
+		{
+			name: "пустой перевод",
+			locales: fstest.MapFS{
+				"ru.yaml": {Data: []byte(ru)},
+				"en.yaml": {Data: []byte("NotFoundErr: \"not found\"\nInvalidErr: \"\"\n")},
+			},
+			errs: []string{"en.yaml: no translation for InvalidErr"},
+		},
+		{
+			name: "устаревшее сообщение source",
+			locales: fstest.MapFS{
+				"ru.yaml": {Data: []byte("NotFoundErr: \"не найден\"\nInvalidErr: \"некорректный запрос\"\n")},
+				"en.yaml": {Data: []byte(en)},
+			},
+			errs: []string{"ru.yaml: NotFoundErr differs from the comment"},
+		},
+		{
+			name:    "нет локали source",
+			locales: fstest.MapFS{"en.yaml": {Data: []byte(en)}},
+			errs:    []string{"source locale ru.yaml not found"},
+		},
+		{
+			name:    "нет файлов локалей",
+			locales: fstest.MapFS{},
+			errs:    []string{"no locale files"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := Verify(src, c.locales, "ru")
+			if len(c.errs) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range c.errs {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
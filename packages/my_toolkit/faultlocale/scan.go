@@ -0,0 +1,146 @@
+package faultlocale
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hughbliss/my_toolkit/fault"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const faultImportPath = "github.com/hughbliss/my_toolkit/fault"
+
+// Entry константа fault.Code, найденная в исходниках, с сообщением из ее
+// комментария вида `// Имя: "сообщение"`.
+type Entry struct {
+	Code    fault.Code
+	Message string
+	Pos     token.Position
+}
+
+// Scan находит константы типа fault.Code в go файлах каталога dir и его
+// подкаталогов, кроме тестов, vendor и testdata. Константа без комментария
+// в формате строки локали считается ошибкой.
+func Scan(dir string) ([]Entry, error) {
+	var entries []Entry
+	var problems []error
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		found, errs := scanFile(fset, file)
+		entries = append(entries, found...)
+		problems = append(problems, errs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, errors.Join(problems...)
+}
+
+func scanFile(fset *token.FileSet, file *ast.File) ([]Entry, []error) {
+	alias := ""
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == faultImportPath {
+			alias = "fault"
+			if spec.Name != nil {
+				alias = spec.Name.Name
+			}
+		}
+	}
+	if alias == "" {
+		return nil, nil
+	}
+
+	var entries []Entry
+	var problems []error
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			value := spec.(*ast.ValueSpec)
+			if !isFaultCode(value.Type, alias) {
+				continue
+			}
+			for i, name := range value.Names {
+				pos := fset.Position(name.Pos())
+				if i >= len(value.Values) {
+					problems = append(problems, fmt.Errorf("%s: %s has no value", pos, name.Name))
+					continue
+				}
+				lit, ok := value.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					problems = append(problems, fmt.Errorf("%s: %s is not a string literal", pos, name.Name))
+					continue
+				}
+				code, _ := strconv.Unquote(lit.Value)
+
+				message, err := commentMessage(name.Name, value, gen)
+				if err != nil {
+					problems = append(problems, fmt.Errorf("%s: %w", pos, err))
+					continue
+				}
+				entries = append(entries, Entry{Code: fault.Code(code), Message: message, Pos: pos})
+			}
+		}
+	}
+	return entries, problems
+}
+
+func isFaultCode(expr ast.Expr, alias string) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Code" {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == alias
+}
+
+// commentMessage разбирает комментарий константы как строку локали и
+// проверяет, что ключ совпадает с именем константы. Комментарий над
+// одиночным объявлением const без скобок парсер относит к gen.
+func commentMessage(name string, spec *ast.ValueSpec, gen *ast.GenDecl) (string, error) {
+	groups := []*ast.CommentGroup{spec.Comment, spec.Doc}
+	if !gen.Lparen.IsValid() {
+		groups = append(groups, gen.Doc)
+	}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		var entry map[string]string
+		if err := yaml.Unmarshal([]byte(strings.TrimSpace(group.Text())), &entry); err != nil {
+			continue
+		}
+		if message, ok := entry[name]; ok && message != "" {
+			return message, nil
+		}
+	}
+	return "", fmt.Errorf(`%s: comment must be a locale entry %s: "message"`, name, name)
+}
@@ -0,0 +1,133 @@
+package faultlocale
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanFile(t *testing.T) {
+	cases := []struct {
+		name     string
+		src      string
+		want     map[string]string
+		problems int
+	}{
+		{
+			name: "комментарий в строке константы",
+			src: `package p
+import "github.com/hughbliss/my_toolkit/fault"
+const (
+	NotFoundErr fault.Code = "NotFoundErr" // NotFoundErr: "не найдено"
+	InvalidErr  fault.Code = "InvalidErr"  // InvalidErr: "некорректный запрос"
+)`,
+			want: map[string]string{"NotFoundErr": "не найдено", "InvalidErr": "некорректный запрос"},
+		},
+		{
+			name: "комментарий над константой",
+			src: `package p
+import "github.com/hughbliss/my_toolkit/fault"
+// NotFoundErr: "не найдено"
+const NotFoundErr fault.Code = "NotFoundErr"`,
+			want: map[string]string{"NotFoundErr": "не найдено"},
+		},
+		{
+			name: "импорт под другим именем",
+			src: `package p
+import f "github.com/hughbliss/my_toolkit/fault"
+const NotFoundErr f.Code = "NotFoundErr" // NotFoundErr: "не найдено"`,
+			want: map[string]string{"NotFoundErr": "не найдено"},
+		},
+		{
+			name: "константы других типов пропускаются",
+			src: `package p
+import "github.com/hughbliss/my_toolkit/fault"
+const Name = "name"
+var _ fault.Code`,
+			want: map[string]string{},
+		},
+		{
+			name: "файл без импорта fault",
+			src: `package p
+type Code string
+const NotFoundErr Code = "NotFoundErr"`,
+			want: map[string]string{},
+		},
+		{
+			name: "нет комментария",
+			src: `package p
+import "github.com/hughbliss/my_toolkit/fault"
+const NotFoundErr fault.Code = "NotFoundErr"`,
+			want:     map[string]string{},
+			problems: 1,
+		},
+		{
+			name: "ключ комментария не совпадает с именем",
+			src: `package p
+import "github.com/hughbliss/my_toolkit/fault"
+const NotFoundErr fault.Code = "NotFoundErr" // NotFound: "не найдено"`,
+			want:     map[string]string{},
+			problems: 1,
+		},
+		{
+			name: "значение не строковый литерал",
+			src: `package p
+import "github.com/hughbliss/my_toolkit/fault"
+const base = "NotFound"
+const NotFoundErr fault.Code = base + "Err" // NotFoundErr: "не найдено"`,
+			want:     map[string]string{},
+			problems: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "p.go", c.src, parser.ParseComments)
+			require.NoError(t, err)
+
+			entries, problems := scanFile(fset, file)
+			assert.Len(t, problems, c.problems)
+			got := map[string]string{}
+			for _, entry := range entries {
+				got[string(entry.Code)] = entry.Message
+			}
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	code := func(name string) string {
+		return "package p\nimport \"github.com/hughbliss/my_toolkit/fault\"\n" +
+			"const " + name + " fault.Code = \"" + name + "\" // " + name + ": \"сообщение\"\n"
+	}
+
+	write("usecase/errors.go", code("UsecaseErr"))
+	write("dto/errors.go", code("DtoErr"))
+	write("usecase/errors_test.go", code("TestOnlyErr"))
+	write("testdata/errors.go", code("TestdataErr"))
+	write("vendor/errors.go", code("VendorErr"))
+
+	entries, err := Scan(dir)
+	require.NoError(t, err)
+	codes := make([]string, len(entries))
+	for i, entry := range entries {
+		codes[i] = string(entry.Code)
+	}
+	// Порядок обхода каталогов определяет порядок кодов в локалях.
+	assert.Equal(t, []string{"DtoErr", "UsecaseErr"}, codes)
+
+	write("handler/errors.go", "package p\nimport \"github.com/hughbliss/my_toolkit/fault\"\nconst HandlerErr fault.Code = \"HandlerErr\"\n")
+	_, err = Scan(dir)
+	assert.ErrorContains(t, err, "HandlerErr")
+}
@@ -0,0 +1,141 @@
+// Package faultstatus сопоставляет коды fault со статусами gRPC, чтобы клиенты
+// и grpc-gateway различали отсутствующие сущности, некорректные запросы,
+// конфликты и сбои сервера.
+//
+// Сервисы регистрируют статусы рядом с объявлением кодов:
+//
+//	const UserNotFoundErr fault.Code = "UserNotFoundErr" // UserNotFoundErr: "пользователь не найден"
+//
+//	func init() {
+//		faultstatus.Register(codes.NotFound, UserNotFoundErr)
+//	}
+//
+// Незарегистрированные коды считаются сбоем сервера (codes.Internal).
+// Статус fault содержит errdetails.ErrorInfo с кодом в Reason, по которому
+// клиенты и перехватчики, например перевод сообщений, определяют код.
+package faultstatus
+
+import (
+	"errors"
+	"github.com/hughbliss/my_toolkit/fault"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"sync"
+)
+
+// ErrorDomain домен errdetails.ErrorInfo статусов fault.
+const ErrorDomain = "fault"
+
+var (
+	mu       sync.RWMutex
+	registry = map[fault.Code]codes.Code{
+		fault.UnhandledError: codes.Internal,
+	}
+)
+
+// Register сопоставляет кодам faults статус st. Повторная регистрация кода
+// заменяет статус.
+func Register(st codes.Code, faults ...fault.Code) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, code := range faults {
+		registry[code] = st
+	}
+}
+
+// Code возвращает статус, зарегистрированный для кода.
+func Code(code fault.Code) codes.Code {
+	mu.RLock()
+	defer mu.RUnlock()
+	if st, ok := registry[code]; ok {
+		return st
+	}
+	return codes.Internal
+}
+
+// Of возвращает статус, зарегистрированный для кода ошибки f.
+func Of(f *fault.Fault) codes.Code {
+	return Code(f.Code())
+}
+
+// FaultCode возвращает код fault, содержащегося в err, например для меток
+// метрик.
+func FaultCode(err error) (fault.Code, bool) {
+	var f *fault.Fault
+	if !errors.As(err, &f) {
+		return "", false
+	}
+	return f.Code(), true
+}
+
+// Status возвращает статус ошибки f с кодом из реестра и кодом fault в
+// errdetails.ErrorInfo.
+func Status(f *fault.Fault) *status.Status {
+	st := status.New(Of(f), f.Error())
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: string(f.Code()), Domain: ErrorDomain})
+	if err != nil {
+		return st
+	}
+	return detailed
+}
+
+// CodeOf возвращает код fault из деталей статуса st.
+func CodeOf(st *status.Status) (fault.Code, bool) {
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == ErrorDomain {
+			return fault.Code(info.GetReason()), true
+		}
+	}
+	return "", false
+}
+
+// ToProto переводит ошибку обработчика в ошибку gRPC. Ошибки с собственным
+// ToProto, например с деталями, переводятся им; fault - со статусом из
+// реестра; ошибки gRPC возвращаются как есть, остальные - как
+// fault.UnhandledError.
+func ToProto(err error) error {
+	var detailed interface{ ToProto() error }
+	if errors.As(err, &detailed) {
+		if f, ok := detailed.(*fault.Fault); ok {
+			return Status(f).Err()
+		}
+		return detailed.ToProto()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return Status(fault.UnhandledError.Err()).Err()
+}
+
+// HTTPStatus возвращает HTTP статус для статуса gRPC по соглашению
+// google.rpc.Code, которым пользуется grpc-gateway.
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
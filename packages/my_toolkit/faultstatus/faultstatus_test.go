@@ -0,0 +1,94 @@
+package faultstatus
+
+import (
+	"errors"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+)
+
+const (
+	testNotFoundErr fault.Code = "testNotFoundErr"
+	testInvalidErr  fault.Code = "testInvalidErr"
+	testDBErr       fault.Code = "testDBErr"
+)
+
+// detailedError ошибка с собственным ToProto, как ошибки с деталями в сервисах.
+type detailedError struct {
+	*fault.Fault
+}
+
+func (e *detailedError) Unwrap() error {
+	return e.Fault
+}
+
+func (e *detailedError) ToProto() error {
+	return status.Error(codes.Aborted, "detailed")
+}
+
+func init() {
+	Register(codes.NotFound, testNotFoundErr)
+	Register(codes.InvalidArgument, testInvalidErr)
+}
+
+func TestToProto(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"зарегистрированный код", testNotFoundErr.Err(), codes.NotFound},
+		{"обернутый fault", errors.Join(errors.New("context"), testInvalidErr.Err()), codes.InvalidArgument},
+		{"незарегистрированный код", testDBErr.Err(), codes.Internal},
+		{"ошибка с деталями", &detailedError{Fault: testNotFoundErr.Err()}, codes.Aborted},
+		{"ошибка gRPC", status.Error(codes.Unavailable, "down"), codes.Unavailable},
+		{"произвольная ошибка", errors.New("boom"), codes.Internal},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, status.Code(ToProto(c.err)))
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, HTTPStatus(Code(testNotFoundErr)))
+	assert.Equal(t, http.StatusConflict, HTTPStatus(codes.AlreadyExists))
+	assert.Equal(t, http.StatusUnauthorized, HTTPStatus(codes.Unauthenticated))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus(Code(testDBErr)))
+}
+
+func TestCodeOf(t *testing.T) {
+	code, ok := CodeOf(status.Convert(ToProto(testNotFoundErr.Err())))
+	assert.True(t, ok)
+	assert.Equal(t, testNotFoundErr, code)
+
+	code, ok = CodeOf(status.Convert(ToProto(testDBErr.Err())))
+	assert.True(t, ok)
+	assert.Equal(t, testDBErr, code)
+
+	code, ok = CodeOf(status.Convert(ToProto(errors.New("boom"))))
+	assert.True(t, ok)
+	assert.Equal(t, fault.UnhandledError, code)
+
+	_, ok = CodeOf(status.New(codes.Unavailable, "down"))
+	assert.False(t, ok)
+}
+
+func TestStatus(t *testing.T) {
+	assert.Equal(t, codes.NotFound, Status(testNotFoundErr.Err()).Code())
+	assert.Equal(t, codes.InvalidArgument, Status(testInvalidErr.Err()).Code())
+	assert.Equal(t, codes.Internal, Of(testDBErr.Err()))
+}
+
+func TestFaultCode(t *testing.T) {
+	code, ok := FaultCode(errors.Join(errors.New("context"), testInvalidErr.Err()))
+	assert.True(t, ok)
+	assert.Equal(t, testInvalidErr, code)
+
+	_, ok = FaultCode(errors.New("boom"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,89 @@
+package faultstatus
+
+import (
+	"context"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor переводит ошибки unary обработчиков в статусы gRPC
+// через ToProto, поэтому обработчики возвращают ошибки usecase как есть.
+// Неожиданные ошибки логируются со стеком и trace id, паника обработчика
+// возвращается клиенту как fault.UnhandledError.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				resp, err = nil, recovered(ctx, info.FullMethod, r)
+			}
+		}()
+
+		resp, err = handler(ctx, req)
+		if err != nil {
+			return resp, translate(ctx, info.FullMethod, err)
+		}
+		return resp, nil
+	}
+}
+
+// StreamServerInterceptor переводит ошибки потоковых обработчиков так же, как
+// UnaryServerInterceptor.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(stream.Context(), info.FullMethod, r)
+			}
+		}()
+
+		if err := handler(srv, stream); err != nil {
+			return translate(stream.Context(), info.FullMethod, err)
+		}
+		return nil
+	}
+}
+
+// translate переводит ошибку в статус и логирует ошибки, которые клиент
+// получит как сбой сервера. Ожидаемые коды, например NotFound, не логируются.
+func translate(ctx context.Context, method string, err error) error {
+	converted := ToProto(err)
+
+	switch status.Code(converted) {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		var stacked interface{ StackTrace() errors.StackTrace }
+		if !errors.As(err, &stacked) {
+			err = errors.WithStack(err)
+		}
+		log.Error().
+			Err(err).
+			Stack().
+			Str("method", method).
+			Str("trace_id", traceID(ctx)).
+			Msg("unexpected error")
+	}
+	return converted
+}
+
+// recovered логирует панику обработчика со стеком в момент паники.
+func recovered(ctx context.Context, method string, r any) error {
+	log.Error().
+		Err(errors.Errorf("panic: %v", r)).
+		Stack().
+		Str("method", method).
+		Str("trace_id", traceID(ctx)).
+		Msg("handler panic")
+	return Status(fault.UnhandledError.Err()).Err()
+}
+
+func traceID(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
@@ -0,0 +1,86 @@
+package faultstatus
+
+import (
+	"context"
+	"errors"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.v1.TestService/Method"}
+
+	cases := []struct {
+		name    string
+		handler grpc.UnaryHandler
+		want    codes.Code
+		reason  fault.Code
+	}{
+		{
+			name:    "fault со статусом",
+			handler: func(context.Context, any) (any, error) { return nil, testNotFoundErr.Err() },
+			want:    codes.NotFound,
+			reason:  testNotFoundErr,
+		},
+		{
+			name:    "произвольная ошибка",
+			handler: func(context.Context, any) (any, error) { return nil, errors.New("boom") },
+			want:    codes.Internal,
+			reason:  fault.UnhandledError,
+		},
+		{
+			name:    "паника",
+			handler: func(context.Context, any) (any, error) { panic("implement me") },
+			want:    codes.Internal,
+			reason:  fault.UnhandledError,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			resp, err := interceptor(context.Background(), nil, info, c.handler)
+			assert.Nil(t, resp)
+
+			st := status.Convert(err)
+			assert.Equal(t, c.want, st.Code())
+			code, ok := CodeOf(st)
+			assert.True(t, ok)
+			assert.Equal(t, c.reason, code)
+		})
+	}
+
+	t.Run("успешный вызов", func(t *testing.T) {
+		resp, err := interceptor(context.Background(), "req", info, func(_ context.Context, req any) (any, error) {
+			return req, nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "req", resp)
+	})
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	interceptor := StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/test.v1.TestService/Stream"}
+
+	err := interceptor(nil, &testServerStream{}, info, func(any, grpc.ServerStream) error {
+		panic("implement me")
+	})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = interceptor(nil, &testServerStream{}, info, func(any, grpc.ServerStream) error {
+		return testInvalidErr.Err()
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *testServerStream) Context() context.Context {
+	return context.Background()
+}
@@ -0,0 +1,32 @@
+// Package grpcerver создает gRPC сервер сервиса и слушатель на адресе из
+// секции listen конфигурации.
+package grpcerver
+
+import (
+	zfg "github.com/chaindead/zerocfg"
+	"google.golang.org/grpc"
+	"net"
+	"strconv"
+)
+
+// Адрес gRPC сервера, общий для всех сервисов.
+var (
+	listenGroup = zfg.NewGroup("listen")
+	listenHost  = zfg.Str("host", "0.0.0.0", "LISTEN_HOST", zfg.Group(listenGroup))
+	listenPort  = zfg.Uint32("port", 50051, "LISTEN_PORT", zfg.Group(listenGroup))
+)
+
+// Init создает gRPC сервер с опциями opts, например цепочками перехватчиков.
+func Init(opts ...grpc.ServerOption) *grpc.Server {
+	return grpc.NewServer(opts...)
+}
+
+// Listener открывает TCP слушатель на listen.host:listen.port.
+func Listener() (net.Listener, error) {
+	return net.Listen("tcp", addr())
+}
+
+// addr возвращает адрес сервера из конфигурации.
+func addr() string {
+	return net.JoinHostPort(*listenHost, strconv.FormatUint(uint64(*listenPort), 10))
+}
@@ -0,0 +1,36 @@
+package grpcerver
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthv1 "google.golang.org/grpc/health/grpc_health_v1"
+	"testing"
+)
+
+func TestInit(t *testing.T) {
+	*listenHost, *listenPort = "127.0.0.1", 0
+
+	var intercepted []string
+	s := Init(grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		intercepted = append(intercepted, info.FullMethod)
+		return handler(ctx, req)
+	}))
+	healthv1.RegisterHealthServer(s, health.NewServer())
+
+	listener, err := Listener()
+	require.NoError(t, err)
+	go func() { _ = s.Serve(listener) }()
+	defer s.Stop()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = healthv1.NewHealthClient(conn).Check(context.Background(), &healthv1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{healthv1.Health_Check_FullMethodName}, intercepted)
+}
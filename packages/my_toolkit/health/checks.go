@@ -0,0 +1,107 @@
+// Package health проверяет зависимости сервиса и публикует результат через
+// grpc.health.v1 и HTTP, чтобы compose и Kubernetes знали, когда сервис
+// готов принимать запросы.
+package health
+
+import (
+	"context"
+	"fmt"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"sync"
+	"time"
+)
+
+// Check проверяет одну зависимость. Ошибка означает, что зависимость
+// недоступна.
+type Check func(ctx context.Context) error
+
+// Checks набор именованных проверок зависимостей.
+type Checks struct {
+	timeout time.Duration
+	names   []string
+	checks  map[string]Check
+}
+
+// NewChecks создает пустой набор проверок. Каждая проверка прерывается по
+// истечении timeout.
+func NewChecks(timeout time.Duration) *Checks {
+	return &Checks{
+		timeout: timeout,
+		checks:  map[string]Check{},
+	}
+}
+
+// Add добавляет проверку зависимости name. Повторное добавление имени
+// заменяет проверку.
+func (c *Checks) Add(name string, check Check) {
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+	c.checks[name] = check
+}
+
+// Names возвращает имена проверок в порядке добавления.
+func (c *Checks) Names() []string {
+	return c.names
+}
+
+// Report результат проверки зависимостей.
+type Report struct {
+	Ready  bool
+	Errors map[string]error // Errors ошибки проверок по именам, nil для доступных зависимостей.
+}
+
+// Run параллельно выполняет все проверки.
+func (c *Checks) Run(ctx context.Context) Report {
+	report := Report{
+		Ready:  true,
+		Errors: make(map[string]error, len(c.names)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range c.names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.run(ctx, c.checks[name])
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Errors[name] = err
+			if err != nil {
+				report.Ready = false
+			}
+		}()
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (c *Checks) run(ctx context.Context, check Check) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("health check panic: %v", r)
+		}
+	}()
+	return check(ctx)
+}
+
+// Client проверяет бэкенд по grpc.health.v1. Пустой service проверяет
+// сервер целиком.
+func Client(client healthpb.HealthClient, service string) Check {
+	return func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.GetStatus())
+		}
+		return nil
+	}
+}
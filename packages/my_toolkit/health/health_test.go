@@ -0,0 +1,130 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testChecks(dbErr error) *Checks {
+	checks := NewChecks(20 * time.Millisecond)
+	checks.Add("db", func(context.Context) error { return dbErr })
+	checks.Add("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checks.Add("cache", func(context.Context) error { return nil })
+	return checks
+}
+
+func TestChecks_Run(t *testing.T) {
+	report := testChecks(errors.New("connection refused")).Run(context.Background())
+
+	assert.False(t, report.Ready)
+	assert.EqualError(t, report.Errors["db"], "connection refused")
+	assert.ErrorIs(t, report.Errors["slow"], context.DeadlineExceeded)
+	assert.NoError(t, report.Errors["cache"])
+
+	checks := NewChecks(time.Second)
+	checks.Add("panics", func(context.Context) error { panic("boom") })
+	report = checks.Run(context.Background())
+	assert.False(t, report.Ready)
+	assert.EqualError(t, report.Errors["panics"], "health check panic: boom")
+}
+
+func TestServer_Run(t *testing.T) {
+	checks := NewChecks(time.Second)
+	var dbErr error
+	checks.Add("db", func(context.Context) error { return dbErr })
+	s := NewServer(checks, time.Hour)
+
+	status := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := s.health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		require.NoError(t, err)
+		return resp.GetStatus()
+	}
+
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+
+	s.update(context.Background())
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, status("db"))
+
+	dbErr = errors.New("connection refused")
+	s.update(context.Background())
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status("db"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dbErr = nil
+	s.Run(ctx)
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, status(""))
+}
+
+func TestReadinessHandler(t *testing.T) {
+	readyz := func(s *Server) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ReadinessHandler(s).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec
+	}
+
+	t.Run("до первой проверки", func(t *testing.T) {
+		rec := readyz(NewServer(testChecks(nil), time.Hour))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		assert.JSONEq(t, `{"status":"unavailable"}`, rec.Body.String())
+	})
+
+	t.Run("зависимость недоступна", func(t *testing.T) {
+		s := NewServer(testChecks(errors.New("dial tcp 10.0.0.5:5432: connection refused")), time.Hour)
+		s.update(context.Background())
+
+		rec := readyz(s)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		var resp response
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, statusUnavailable, resp.Status)
+		// Текст ошибки не раскрывается: адреса зависимостей остаются в логе.
+		assert.Equal(t, statusUnavailable, resp.Checks["db"])
+		assert.Equal(t, statusOK, resp.Checks["cache"])
+		assert.NotContains(t, rec.Body.String(), "10.0.0.5")
+	})
+
+	t.Run("ответ из последней проверки", func(t *testing.T) {
+		calls := 0
+		checks := NewChecks(time.Second)
+		checks.Add("db", func(context.Context) error {
+			calls++
+			return nil
+		})
+		s := NewServer(checks, time.Hour)
+		s.update(context.Background())
+
+		for range 3 {
+			rec := readyz(s)
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.JSONEq(t, `{"status":"ok","checks":{"db":"ok"}}`, rec.Body.String())
+		}
+		assert.Equal(t, 1, calls)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		s.Run(ctx)
+		assert.Equal(t, http.StatusServiceUnavailable, readyz(s).Code)
+	})
+
+	t.Run("liveness", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+	})
+}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// response тело ответов /healthz и /readyz.
+type response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+)
+
+// LivenessHandler отвечает 200, пока процесс обслуживает HTTP запросы.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, response{Status: statusOK})
+	})
+}
+
+// ReadinessHandler отвечает 200, если при последней проверке s все
+// зависимости были доступны, иначе 503. Проверки не выполняются на запрос, а
+// в ответ попадают только статусы ok и unavailable: /readyz открыт без
+// авторизации, а подробные ошибки Server пишет в лог.
+func ReadinessHandler(s *Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report, ok := s.Report()
+		if !ok {
+			writeJSON(w, http.StatusServiceUnavailable, response{Status: statusUnavailable})
+			return
+		}
+
+		resp := response{
+			Status: statusOK,
+			Checks: make(map[string]string, len(report.Errors)),
+		}
+		for name, err := range report.Errors {
+			resp.Checks[name] = statusOK
+			if err != nil {
+				resp.Checks[name] = statusUnavailable
+			}
+		}
+
+		code := http.StatusOK
+		if !report.Ready {
+			code = http.StatusServiceUnavailable
+			resp.Status = statusUnavailable
+		}
+		writeJSON(w, code, resp)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"sync/atomic"
+	"time"
+)
+
+// Server периодически выполняет проверки и публикует последний результат
+// через grpc.health.v1 и ReadinessHandler: статус сервиса "" отражает
+// готовность сервера целиком, статус с именем проверки - доступность
+// отдельной зависимости. Ошибки проверок пишутся в лог.
+type Server struct {
+	health   *grpchealth.Server
+	checks   *Checks
+	interval time.Duration
+	report   atomic.Pointer[Report]
+}
+
+// NewServer создает сервер проверок, который выполняет checks каждые
+// interval. До первой проверки сервер отвечает NOT_SERVING.
+func NewServer(checks *Checks, interval time.Duration) *Server {
+	s := &Server{
+		health:   grpchealth.NewServer(),
+		checks:   checks,
+		interval: interval,
+	}
+	s.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	return s
+}
+
+// Register регистрирует grpc.health.v1 на сервере g.
+func (s *Server) Register(g grpc.ServiceRegistrar) {
+	healthpb.RegisterHealthServer(g, s.health)
+}
+
+// Run выполняет проверки до отмены ctx. После отмены сервер отвечает
+// NOT_SERVING, чтобы балансировщики перестали направлять запросы до
+// остановки.
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.update(ctx)
+
+		select {
+		case <-ctx.Done():
+			s.report.Store(nil)
+			s.health.Shutdown()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) update(ctx context.Context) {
+	report := s.checks.Run(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	s.report.Store(&report)
+
+	for name, err := range report.Errors {
+		if err != nil {
+			log.Warn().Err(err).Str("check", name).Msg("health check failed")
+			s.health.SetServingStatus(name, healthpb.HealthCheckResponse_NOT_SERVING)
+			continue
+		}
+		s.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+
+	if report.Ready {
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	} else {
+		s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Report возвращает результат последней проверки; ok ложно до первой
+// проверки и после остановки.
+func (s *Server) Report() (report Report, ok bool) {
+	if last := s.report.Load(); last != nil {
+		return *last, true
+	}
+	return Report{}, false
+}
+
+func (s *Server) set(st healthpb.HealthCheckResponse_ServingStatus) {
+	s.health.SetServingStatus("", st)
+	for _, name := range s.checks.Names() {
+		s.health.SetServingStatus(name, st)
+	}
+}
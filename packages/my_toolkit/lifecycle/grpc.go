@@ -0,0 +1,30 @@
+package lifecycle
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// StreamServerInterceptor завершает потоковые вызовы с началом остановки:
+// контекст потока отменяется вместе с Context. Без этого GracefulStop
+// дожидался бы бесконечных потоков, например подписок на изменения, до
+// дедлайна остановки и обрывал бы их вместе с остальными вызовами.
+func (r *Runner) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := context.WithCancel(stream.Context())
+		defer cancel()
+		stop := context.AfterFunc(r.ctx, cancel)
+		defer stop()
+
+		return handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
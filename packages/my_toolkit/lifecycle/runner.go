@@ -0,0 +1,126 @@
+// Package lifecycle останавливает сервисы по SIGINT и SIGTERM: серверы
+// перестают принимать соединения и дожидаются текущих запросов, затем
+// сбрасывается телеметрия и закрываются соединения с базой данных.
+//
+//	runner := lifecycle.New(*shutdownTimeout)
+//	runner.OnStop("telemetry", lifecycle.Func(telemetryDown))
+//	runner.OnStop("db", lifecycle.Close(db))
+//	runner.Go("grpc", func() error { return s.Serve(listener) })
+//	runner.OnStop("grpc", lifecycle.GRPC(s))
+//	if err := runner.Wait(); err != nil {
+//		log.Error().Err(err).Msg("shutdown failed")
+//		os.Exit(1)
+//	}
+//
+// Шаги остановки выполняются в обратном порядке регистрации, как defer:
+// сначала серверы, затем телеметрия и база данных, от которых они зависят.
+// Каждому шагу отводится свой timeout, поэтому зависший сервер не отнимает
+// время у сброса телеметрии и закрытия базы данных.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type step struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Runner запускает серверы приложения и останавливает их по сигналу или при
+// ошибке любого из них.
+type Runner struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+	errs    chan error
+	steps   []step
+}
+
+// New создает Runner, который ждет SIGINT или SIGTERM. На каждый шаг
+// остановки отводится timeout, после чего шаг получает отмененный контекст.
+func New(timeout time.Duration) *Runner {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	return &Runner{
+		ctx:     ctx,
+		cancel:  cancel,
+		timeout: timeout,
+		errs:    make(chan error, 1),
+	}
+}
+
+// Context возвращает контекст приложения, который отменяется в начале
+// остановки. Фоновые задачи, например воркеры и проверки здоровья, должны
+// завершаться по нему.
+func (r *Runner) Context() context.Context {
+	return r.ctx
+}
+
+// Go запускает блокирующую функцию serve, например Serve сервера.
+// Завершение serve до сигнала, с ошибкой или без, начинает остановку
+// приложения.
+func (r *Runner) Go(name string, serve func() error) {
+	go func() {
+		err := serve()
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("stopped unexpectedly")
+		}
+
+		select {
+		case r.errs <- fmt.Errorf("%s: %w", name, err):
+		default:
+		}
+	}()
+}
+
+// OnStop регистрирует шаг остановки.
+func (r *Runner) OnStop(name string, stop func(ctx context.Context) error) {
+	r.steps = append(r.steps, step{name: name, stop: stop})
+}
+
+// Wait блокируется до сигнала или ошибки сервера и выполняет шаги остановки.
+// Возвращает ошибку сервера и ошибки шагов. Повторный сигнал во время
+// остановки завершает процесс сразу.
+func (r *Runner) Wait() error {
+	var errs []error
+
+	select {
+	case <-r.ctx.Done():
+		log.Info().Msg("shutdown signal received")
+	case err := <-r.errs:
+		log.Error().Err(err).Msg("server failed, shutting down")
+		errs = append(errs, err)
+	}
+	// Отмена снимает обработчик сигналов, поэтому повторный сигнал
+	// завершает процесс поведением по умолчанию.
+	r.cancel()
+
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		s := r.steps[i]
+		start := time.Now()
+		if err := r.stop(s); err != nil {
+			log.Error().Err(err).Str("step", s.name).Msg("shutdown step failed")
+			errs = append(errs, fmt.Errorf("stop %s: %w", s.name, err))
+			continue
+		}
+		log.Info().Str("step", s.name).Dur("took", time.Since(start)).Msg("stopped")
+	}
+
+	return errors.Join(errs...)
+}
+
+// stop выполняет шаг s с отдельным дедлайном.
+func (r *Runner) stop(s step) error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	return s.stop(ctx)
+}
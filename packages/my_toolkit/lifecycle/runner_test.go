@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunner_Wait(t *testing.T) {
+	t.Run("сигнал останавливает шаги в обратном порядке", func(t *testing.T) {
+		runner := New(time.Second)
+		var order []string
+		for _, name := range []string{"db", "telemetry", "grpc"} {
+			runner.OnStop(name, func(context.Context) error {
+				order = append(order, name)
+				return nil
+			})
+		}
+
+		serving := make(chan struct{})
+		runner.Go("grpc", func() error {
+			close(serving)
+			<-runner.Context().Done()
+			return nil
+		})
+		<-serving
+
+		require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+		assert.NoError(t, runner.Wait())
+		assert.Equal(t, []string{"grpc", "telemetry", "db"}, order)
+		assert.Error(t, runner.Context().Err())
+	})
+
+	t.Run("ошибка сервера начинает остановку", func(t *testing.T) {
+		runner := New(time.Second)
+		stopped := false
+		runner.OnStop("db", func(context.Context) error {
+			stopped = true
+			return errors.New("close failed")
+		})
+		runner.Go("http", func() error { return errors.New("address already in use") })
+
+		err := runner.Wait()
+		assert.ErrorContains(t, err, "http: address already in use")
+		assert.ErrorContains(t, err, "stop db: close failed")
+		assert.True(t, stopped)
+	})
+
+	t.Run("каждому шагу свой дедлайн", func(t *testing.T) {
+		runner := New(20 * time.Millisecond)
+		var dbErr error
+		runner.OnStop("db", func(ctx context.Context) error {
+			dbErr = ctx.Err()
+			return nil
+		})
+		runner.OnStop("grpc", func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		runner.Go("grpc", func() error { return errors.New("boom") })
+
+		err := runner.Wait()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.NoError(t, dbErr)
+	})
+}
+
+func TestRunner_StreamServerInterceptor(t *testing.T) {
+	runner := New(time.Second)
+	interceptor := runner.StreamServerInterceptor()
+
+	streaming := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- interceptor(nil, &testServerStream{ctx: context.Background()}, &grpc.StreamServerInfo{},
+			func(_ any, stream grpc.ServerStream) error {
+				close(streaming)
+				<-stream.Context().Done()
+				return stream.Context().Err()
+			})
+	}()
+	<-streaming
+
+	runner.Go("grpc", func() error { return errors.New("boom") })
+	assert.Error(t, runner.Wait())
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// hangingServer сервер, текущие вызовы которого не завершаются до Stop.
+type hangingServer struct {
+	stop    chan struct{}
+	stopped bool
+}
+
+func (s *hangingServer) GracefulStop() { <-s.stop }
+func (s *hangingServer) Stop() {
+	s.stopped = true
+	close(s.stop)
+}
+
+func TestGRPC(t *testing.T) {
+	s := &hangingServer{stop: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := GRPC(s)(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, s.stopped)
+}
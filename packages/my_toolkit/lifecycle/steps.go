@@ -0,0 +1,50 @@
+package lifecycle
+
+import (
+	"context"
+	"io"
+)
+
+// GracefulServer сервер, который умеет дожидаться текущих вызовов, как
+// grpc.Server.
+type GracefulServer interface {
+	GracefulStop()
+	Stop()
+}
+
+// GRPC останавливает сервер gRPC: новые соединения не принимаются, текущие
+// вызовы дорабатывают до дедлайна остановки, после чего обрываются.
+func GRPC(s GracefulServer) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			s.GracefulStop()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			s.Stop()
+			<-done
+			return ctx.Err()
+		}
+	}
+}
+
+// Close закрывает c, например клиент базы данных.
+func Close(c io.Closer) func(ctx context.Context) error {
+	return func(context.Context) error {
+		return c.Close()
+	}
+}
+
+// Func оборачивает функцию остановки без контекста и ошибки, например сброс
+// телеметрии.
+func Func(f func()) func(ctx context.Context) error {
+	return func(context.Context) error {
+		f()
+		return nil
+	}
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/hughbliss/my_toolkit/telemetry/meter"
+	meterExporter "github.com/hughbliss/my_toolkit/telemetry/meter/exporter/otlp"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// InitExporter включает экспорт метрик экспортером name: ExporterOTLP - в
+// коллектор, ExporterPrometheus - по HTTP на отдельном сервере addr для
+// окружений без коллектора, ExporterNone - без экспорта. Метрики не
+// отдаются на публичных портах сервисов. Возвращенная функция останавливает
+// экспорт.
+func InitExporter(ctx context.Context, res *resource.Resource, name, addr string) (func(), error) {
+	switch name {
+	case ExporterOTLP:
+		otlpMeter, err := meterExporter.OTLPMeter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return meter.Init(ctx, res, otlpMeter), nil
+	case ExporterPrometheus:
+		handler, providerDown, err := Prometheus(res)
+		if err != nil {
+			return nil, err
+		}
+		serverDown := Serve(addr, handler)
+		return func() {
+			serverDown()
+			providerDown()
+		}, nil
+	case ExporterNone:
+		return func() {}, nil
+	default:
+		return nil, fmt.Errorf("unknown meter exporter %q", name)
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"strings"
+	"time"
+)
+
+// rpcDuration гистограмма длительности gRPC вызовов. Число вызовов и ошибок
+// считается по ней же с разбивкой по rpc.grpc.status_code.
+type rpcDuration struct {
+	histogram metric.Float64Histogram
+}
+
+func newRPCDuration() rpcDuration {
+	return rpcDuration{
+		histogram: DurationHistogram(Meter(instrumentation), "rpc.server.duration", "Duration of gRPC server calls"),
+	}
+}
+
+func (d rpcDuration) record(ctx context.Context, fullMethod string, start time.Time, err error) {
+	service, method := splitMethod(fullMethod)
+	d.histogram.Record(ctx, Since(start), metric.WithAttributes(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", method),
+		attribute.String("rpc.grpc.status_code", status.Code(err).String()),
+	))
+}
+
+// UnaryServerInterceptor записывает RED метрики unary методов. Перехватчик
+// ставится перед перехватчиком faultstatus, чтобы учитывать итоговый код
+// статуса.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	duration := newRPCDuration()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		duration.record(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor записывает RED метрики потоковых методов, длительность
+// считается до закрытия потока.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	duration := newRPCDuration()
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		duration.record(stream.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// splitMethod разбивает полное имя метода "/pkg.Service/Method" на сервис и
+// метод.
+func splitMethod(fullMethod string) (string, string) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "unknown", name
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type routeKey struct{}
+
+// SetRoute уточняет маршрут запроса для метрик. Используется обработчиками,
+// которые сами разбирают путь, например grpc-gateway под маршрутом "/v1/*".
+func SetRoute(ctx context.Context, route string) {
+	if r, ok := ctx.Value(routeKey{}).(*string); ok {
+		*r = route
+	}
+}
+
+// EchoMiddleware записывает RED метрики HTTP маршрутов echo. Маршрут берется
+// из шаблона echo или из SetRoute, неизвестные пути учитываются как
+// "unmatched", чтобы не раздувать число рядов.
+func EchoMiddleware() echo.MiddlewareFunc {
+	duration := DurationHistogram(Meter(instrumentation), "http.server.request.duration", "Duration of HTTP server requests")
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			req := c.Request()
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), routeKey{}, &route)))
+
+			err := next(c)
+
+			duration.Record(req.Context(), Since(start), metric.WithAttributes(
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", route),
+				attribute.String("http.response.status_code", strconv.Itoa(responseStatus(c, err))),
+			))
+			return err
+		}
+	}
+}
+
+// responseStatus возвращает статус ответа. Ошибку обработчика echo
+// превращает в ответ позже, поэтому ее статус определяется по самой ошибке.
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
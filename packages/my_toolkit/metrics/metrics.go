@@ -0,0 +1,123 @@
+// Package metrics собирает RED метрики (частота, ошибки, длительность) gRPC
+// методов и HTTP маршрутов и отдает метрики в формате Prometheus для
+// окружений без OTLP коллектора.
+//
+// Инструменты создаются через глобальный MeterProvider, поэтому их можно
+// создавать до инициализации экспорта: после otel.SetMeterProvider они
+// начинают писать в установленный провайдер.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"net/http"
+	"time"
+)
+
+// Экспортеры метрик для настройки meter.exporter сервисов.
+const (
+	ExporterNone       = "none"
+	ExporterOTLP       = "otlp"
+	ExporterPrometheus = "prometheus"
+)
+
+// Path путь, по которому отдаются метрики Prometheus.
+const Path = "/metrics"
+
+const instrumentation = "github.com/hughbliss/my_toolkit/metrics"
+
+// durationBuckets границы гистограмм длительности в секундах.
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Meter возвращает meter глобального провайдера для метрик сервиса name.
+func Meter(name string) metric.Meter {
+	return otel.Meter(name)
+}
+
+// Prometheus устанавливает глобальный MeterProvider, метрики которого
+// отдает возвращенный http.Handler. Возвращенная функция останавливает
+// провайдер.
+func Prometheus(res *resource.Resource) (http.Handler, func(), error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(res),
+		sdkmetric.WithReader(exporter),
+	)
+	otel.SetMeterProvider(provider)
+
+	down := func() {
+		if err := provider.Shutdown(context.Background()); err != nil {
+			log.Error().Err(err).Msg("failed to shutdown meter provider")
+		}
+	}
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{}), down, nil
+}
+
+// Serve отдает метрики handler по пути Path на отдельном HTTP сервере addr,
+// для сервисов без собственного HTTP сервера. Возвращенная функция
+// останавливает сервер.
+func Serve(addr string, handler http.Handler) func() {
+	mux := http.NewServeMux()
+	mux.Handle(Path, handler)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Str("addr", addr).Msg("metrics server stopped")
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to shutdown metrics server")
+		}
+	}
+}
+
+// DurationHistogram создает гистограмму длительности в секундах с общими
+// для пакета границами. Ошибка создания передается в otel.Handle, инструмент
+// при этом остается рабочим no-op.
+func DurationHistogram(meter metric.Meter, name, description string) metric.Float64Histogram {
+	histogram, err := meter.Float64Histogram(name,
+		metric.WithDescription(description),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return histogram
+}
+
+// Counter создает счетчик. Ошибка создания передается в otel.Handle.
+func Counter(meter metric.Meter, name, description string) metric.Int64Counter {
+	counter, err := meter.Int64Counter(name, metric.WithDescription(description))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+}
+
+// Since возвращает длительность с start в секундах.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
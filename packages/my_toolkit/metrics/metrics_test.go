@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// collect устанавливает провайдер с ручным чтением и возвращает функцию,
+// собирающую точки гистограммы name.
+func collect(t *testing.T) func(name string) []metricdata.HistogramDataPoint[float64] {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	return func(name string) []metricdata.HistogramDataPoint[float64] {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		for _, scope := range rm.ScopeMetrics {
+			for _, m := range scope.Metrics {
+				if m.Name == name {
+					return m.Data.(metricdata.Histogram[float64]).DataPoints
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func attr(t *testing.T, point metricdata.HistogramDataPoint[float64], key string) string {
+	t.Helper()
+	v, ok := point.Attributes.Value(attribute.Key(key))
+	require.True(t, ok, "нет атрибута %s", key)
+	return v.AsString()
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	points := collect(t)
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/authn.v1.AuthenticationService/SignIn"}
+
+	_, _ = interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) { return "ok", nil })
+	_, _ = interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.Unauthenticated, "wrong password")
+	})
+
+	got := map[string]uint64{}
+	for _, point := range points("rpc.server.duration") {
+		assert.Equal(t, "authn.v1.AuthenticationService", attr(t, point, "rpc.service"))
+		assert.Equal(t, "SignIn", attr(t, point, "rpc.method"))
+		got[attr(t, point, "rpc.grpc.status_code")] = point.Count
+	}
+	assert.Equal(t, map[string]uint64{"OK": 1, "Unauthenticated": 1}, got)
+}
+
+func TestEchoMiddleware(t *testing.T) {
+	points := collect(t)
+	e := echo.New()
+	e.Use(EchoMiddleware())
+	e.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.Any("/v1/*", func(c echo.Context) error {
+		SetRoute(c.Request().Context(), "/v1/users/{id=*}")
+		return echo.NewHTTPError(http.StatusNotFound)
+	})
+
+	for _, path := range []string{"/healthz", "/v1/users/1", "/v1/users/2"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	got := map[string]uint64{}
+	for _, point := range points("http.server.request.duration") {
+		got[attr(t, point, "http.route")+" "+attr(t, point, "http.response.status_code")] = point.Count
+	}
+	assert.Equal(t, map[string]uint64{"/healthz 200": 1, "/v1/users/{id=*} 404": 2}, got)
+}
+
+func TestPrometheus(t *testing.T) {
+	previous := otel.GetMeterProvider()
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	handler, down, err := Prometheus(resource.Empty())
+	require.NoError(t, err)
+	defer down()
+
+	_, _ = UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/svc.v1.Svc/Do"},
+		func(context.Context, any) (any, error) { return nil, nil })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Path, nil))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "rpc_server_duration_seconds_count")
+}
+
+func TestInitExporter(t *testing.T) {
+	down, err := InitExporter(context.Background(), resource.Empty(), ExporterNone, "")
+	require.NoError(t, err)
+	down()
+
+	_, err = InitExporter(context.Background(), resource.Empty(), "statsd", "")
+	assert.EqualError(t, err, `unknown meter exporter "statsd"`)
+}
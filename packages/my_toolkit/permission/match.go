@@ -0,0 +1,66 @@
+// Package permission сопоставляет выданные ролям доступы с алиасами,
+// которых требуют методы API.
+//
+// Алиасы состоят из сегментов, разделенных точкой, например "admin.users.read".
+// Выданный доступ может быть точным алиасом либо шаблоном:
+//
+//	"*"             - любой алиас;
+//	"admin.users.*" - любой алиас внутри пространства "admin.users".
+//
+// Звездочка допустима только последним сегментом. Шаблон пространства не
+// покрывает сам алиас пространства: "admin.users.*" не дает "admin.users".
+package permission
+
+import "strings"
+
+const (
+	// Separator разделитель сегментов алиаса.
+	Separator = "."
+	// Wildcard сегмент, покрывающий любой остаток алиаса.
+	Wildcard = "*"
+)
+
+// IsPattern сообщает, является ли доступ шаблоном.
+func IsPattern(grant string) bool {
+	return grant == Wildcard || strings.HasSuffix(grant, Separator+Wildcard)
+}
+
+// Valid проверяет синтаксис доступа: непустые сегменты и звездочка только в
+// последнем сегменте.
+func Valid(grant string) bool {
+	if grant == "" {
+		return false
+	}
+	segments := strings.Split(grant, Separator)
+	for i, segment := range segments {
+		if segment == "" {
+			return false
+		}
+		if strings.Contains(segment, Wildcard) && (segment != Wildcard || i != len(segments)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match сообщает, покрывает ли выданный доступ grant требуемый алиас required.
+func Match(grant, required string) bool {
+	if !IsPattern(grant) {
+		return grant == required
+	}
+	if grant == Wildcard {
+		return required != ""
+	}
+	namespace := strings.TrimSuffix(grant, Wildcard)
+	return len(required) > len(namespace) && strings.HasPrefix(required, namespace)
+}
+
+// Any сообщает, покрывает ли хотя бы один из выданных доступов алиас required.
+func Any(grants []string, required string) bool {
+	for _, grant := range grants {
+		if Match(grant, required) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package permission
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		grant, required string
+		want            bool
+	}{
+		{"admin.users.read", "admin.users.read", true},
+		{"admin.users.read", "admin.users.write", false},
+		{"*", "admin.users.read", true},
+		{"*", "", false},
+		{"admin.users.*", "admin.users.read", true},
+		{"admin.users.*", "admin.users.roles.read", true},
+		{"admin.users.*", "admin.users", false},
+		{"admin.users.*", "admin.usersx.read", false},
+		{"admin.*", "admin.roles.read", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, Match(c.grant, c.required), "%s -> %s", c.grant, c.required)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, grant := range []string{"*", "admin", "admin.users.read", "admin.users.*"} {
+		assert.True(t, Valid(grant), grant)
+	}
+	for _, grant := range []string{"", ".", "admin..read", "admin.*.read", "admin.us*", "*.read", "admin."} {
+		assert.False(t, Valid(grant), grant)
+	}
+}
+
+func TestAny(t *testing.T) {
+	assert.True(t, Any([]string{"roles.read", "admin.*"}, "admin.users.read"))
+	assert.False(t, Any([]string{"roles.read"}, "admin.users.read"))
+	assert.False(t, Any(nil, "admin.users.read"))
+}
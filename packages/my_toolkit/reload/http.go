@@ -0,0 +1,99 @@
+package reload
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/hughbliss/my_toolkit/permission"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"strings"
+)
+
+// maxBodySize ограничивает тело запроса на изменение настройки.
+const maxBodySize = 64 << 10
+
+// ConfigPermission доступ к Handler в сервисах. Он не привязан к gRPC методу,
+// поэтому его нет в каталоге acman, и сервис авторизации добавляет его к
+// каталогу сам.
+const ConfigPermission = "admin.config.write"
+
+// Authenticator проверяет запрос к Handler и возвращает, кто его сделал,
+// например email пользователя. Ошибки gRPC и fault переводятся в HTTP
+// статус по коду gRPC.
+type Authenticator func(r *http.Request) (actor string, err error)
+
+// AuthorizeFunc проверяет access token и возвращает email пользователя и его
+// доступы.
+type AuthorizeFunc func(ctx context.Context, accessToken string) (email string, permissions []string, err error)
+
+// PermissionAuthenticator проверяет access token из заголовка Authorization
+// функцией authorize и доступ alias. Возвращает email пользователя для журнала
+// изменений.
+func PermissionAuthenticator(authorize AuthorizeFunc, alias string) Authenticator {
+	return func(r *http.Request) (string, error) {
+		accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || accessToken == "" {
+			return "", status.Error(codes.Unauthenticated, "authorization header is invalid")
+		}
+
+		email, permissions, err := authorize(r.Context(), accessToken)
+		if err != nil {
+			return "", err
+		}
+		if !permission.Any(permissions, alias) {
+			return "", status.Error(codes.PermissionDenied, "у вас нет доступа к настройкам сервиса")
+		}
+		return email, nil
+	}
+}
+
+// Change тело запроса PUT к Handler.
+type Change struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler отдает текущие значения перезагружаемых настроек на GET и меняет
+// одну настройку на PUT с телом Change. Оба метода требуют authenticate.
+func Handler(authenticate Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, err := authenticate(r)
+		if err != nil {
+			st := status.Convert(faultstatus.ToProto(err))
+			writeJSON(w, faultstatus.HTTPStatus(st.Code()), errorResponse{Error: st.Message()})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var change Change
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&change); err != nil {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid body: " + err.Error()})
+				return
+			}
+			if err := Set(change.Key, change.Value, actor); err != nil {
+				writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Values())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,97 @@
+// Package reload меняет отдельные настройки без перезапуска сервиса: по
+// изменению YAML файла конфигурации (Watch) и через админскую ручку (Handler).
+//
+// Перезагружаемые настройки регистрируются под тем же ключом, что и в
+// zerocfg, поэтому их значения находятся в том же файле:
+//
+//	accessTokenLifetime = reload.Dur("auth.access_token_lifetime",
+//		zfg.Dur("access_token_lifetime", 15*time.Minute, "AUTH_ACCESSTOKENLIFETIME", zfg.Group(cfgGroup)))
+//
+// Каждое изменение пишется в журнал вместе с тем, кто его сделал.
+package reload
+
+import (
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog/log"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownKey настройка не зарегистрирована как перезагружаемая.
+var ErrUnknownKey = errors.New("unknown reloadable setting")
+
+// Value перезагружаемое значение настройки. Set вызывается конкурентно с
+// чтением значения обработчиками запросов.
+type Value interface {
+	String() string
+	Set(value string) error
+}
+
+var (
+	mu     sync.Mutex
+	values = make(map[string]Value)
+)
+
+// Register регистрирует перезагружаемую настройку key. Повторная регистрация
+// ключа - ошибка программиста.
+func Register(key string, v Value) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := values[key]; ok {
+		panic(fmt.Sprintf("reload: setting %q is already registered", key))
+	}
+	values[key] = v
+}
+
+// Keys возвращает ключи зарегистрированных настроек по алфавиту.
+func Keys() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Values возвращает текущие значения зарегистрированных настроек.
+func Values() map[string]string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current := make(map[string]string, len(values))
+	for key, v := range values {
+		current[key] = v.String()
+	}
+	return current
+}
+
+// Set меняет настройку key и пишет изменение в журнал от имени actor:
+// пользователя админской ручки или файла конфигурации.
+func Set(key, value, actor string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	v, ok := values[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, key)
+	}
+
+	old := v.String()
+	if err := v.Set(value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	if current := v.String(); current != old {
+		log.Info().
+			Str("key", key).
+			Str("old", old).
+			Str("new", current).
+			Str("actor", actor).
+			Msg("setting changed")
+	}
+	return nil
+}
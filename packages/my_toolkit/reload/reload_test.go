@@ -0,0 +1,203 @@
+package reload
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	base := 15 * time.Minute
+	d := Dur("test.duration.lifetime", &base)
+	assert.Equal(t, 15*time.Minute, d.Get())
+
+	require.NoError(t, Set("test.duration.lifetime", "30m", "admin@example.com"))
+	assert.Equal(t, 30*time.Minute, d.Get())
+	assert.Equal(t, "30m0s", Values()["test.duration.lifetime"])
+
+	assert.Error(t, Set("test.duration.lifetime", "soon", "admin@example.com"))
+	assert.Error(t, Set("test.duration.lifetime", "-1m", "admin@example.com"))
+	assert.Equal(t, 30*time.Minute, d.Get())
+
+	assert.ErrorIs(t, Set("test.duration.unknown", "1m", "admin@example.com"), ErrUnknownKey)
+	assert.Panics(t, func() { Dur("test.duration.lifetime", &base) })
+}
+
+func TestLogLevel(t *testing.T) {
+	previous := zerolog.GlobalLevel()
+	t.Cleanup(func() { zerolog.SetGlobalLevel(previous) })
+
+	LogLevel("test.level")
+	require.NoError(t, Set("test.level", "warn", "admin@example.com"))
+	assert.Equal(t, zerolog.WarnLevel, zerolog.GlobalLevel())
+
+	require.NoError(t, Set("test.level", "-1", "admin@example.com"))
+	assert.Equal(t, zerolog.TraceLevel, zerolog.GlobalLevel())
+
+	assert.Error(t, Set("test.level", "", "admin@example.com"))
+	assert.Error(t, Set("test.level", "loud", "admin@example.com"))
+	assert.Equal(t, zerolog.TraceLevel, zerolog.GlobalLevel())
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	access, refresh := 15*time.Minute, time.Hour
+	accessLifetime := Dur("watch.access_lifetime", &access)
+	refreshLifetime := Dur("watch.refresh_lifetime", &refresh)
+
+	start := time.Now().Add(-time.Hour)
+	writeConfig("watch:\n  access_lifetime: 15m\n  refresh_lifetime: 1h\n", start)
+
+	w, err := newWatcher(path)
+	require.NoError(t, err)
+	var errs []error
+	onError := func(err error) { errs = append(errs, err) }
+
+	// Значение, заданное вручную, переживает перезагрузку файла, в котором
+	// оно не менялось.
+	require.NoError(t, Set("watch.refresh_lifetime", "2h", "admin@example.com"))
+	w.check(onError)
+	assert.Equal(t, 15*time.Minute, accessLifetime.Get())
+
+	writeConfig("watch:\n  access_lifetime: 5m\n  refresh_lifetime: 1h\n", start.Add(time.Minute))
+	w.check(onError)
+	assert.Empty(t, errs)
+	assert.Equal(t, 5*time.Minute, accessLifetime.Get())
+	assert.Equal(t, 2*time.Hour, refreshLifetime.Get())
+
+	writeConfig("watch:\n  access_lifetime: later\n", start.Add(2*time.Minute))
+	w.check(onError)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "watch.access_lifetime")
+	assert.Equal(t, 5*time.Minute, accessLifetime.Get())
+}
+
+func TestWatch_env(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("WATCHENV_LIFETIME", "30m")
+
+	// Значение из окружения применил zerocfg при запуске.
+	lifetime := 30 * time.Minute
+	value := Dur("watchenv.lifetime", &lifetime)
+
+	start := time.Now().Add(-time.Hour)
+	require.NoError(t, os.WriteFile(path, []byte("watchenv:\n  lifetime: 10m\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, start, start))
+	w, err := newWatcher(path)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("watchenv:\n  lifetime: 20m\n"), 0o600))
+	require.NoError(t, os.Chtimes(path, start.Add(time.Minute), start.Add(time.Minute)))
+	w.check(func(err error) { t.Error(err) })
+	assert.Equal(t, 30*time.Minute, value.Get())
+}
+
+func TestWatch_stops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		Watch(ctx, filepath.Join(t.TempDir(), "missing.yaml"), time.Millisecond, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch is not stopped by context")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	base := time.Minute
+	Dur("handler.ttl", &base)
+
+	handler := Handler(func(r *http.Request) (string, error) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer admin":
+			return "admin@example.com", nil
+		case "Bearer user":
+			return "", status.Error(codes.PermissionDenied, "forbidden")
+		}
+		return "", fault.Code("InvalidToken").Err()
+	})
+
+	serve := func(method, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/config", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "user", "").Code)
+		assert.NotEqual(t, http.StatusOK, serve(http.MethodGet, "nobody", "").Code)
+	})
+
+	t.Run("change", func(t *testing.T) {
+		rec := serve(http.MethodPut, "admin", `{"key":"handler.ttl","value":"5m"}`)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var values map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &values))
+		assert.Equal(t, "5m0s", values["handler.ttl"])
+
+		rec = serve(http.MethodGet, "admin", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"handler.ttl":"5m0s"`)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "admin", `{"key":"handler.unknown","value":"5m"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "admin", `{"key":"handler.ttl","value":"0s"}`).Code)
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPut, "admin", `not json`).Code)
+		assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodDelete, "admin", "").Code)
+	})
+}
+
+func TestPermissionAuthenticator(t *testing.T) {
+	authenticate := PermissionAuthenticator(func(_ context.Context, accessToken string) (string, []string, error) {
+		switch accessToken {
+		case "admin":
+			return "admin@example.com", []string{"admin.*"}, nil
+		case "user":
+			return "user@example.com", []string{"users.read"}, nil
+		}
+		return "", nil, status.Error(codes.Unauthenticated, "invalid token")
+	}, ConfigPermission)
+
+	request := func(header string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/config", nil)
+		req.Header.Set("Authorization", header)
+		return req
+	}
+
+	actor, err := authenticate(request("Bearer admin"))
+	require.NoError(t, err)
+	assert.Equal(t, "admin@example.com", actor)
+
+	_, err = authenticate(request("Bearer user"))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = authenticate(request("Bearer nobody"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = authenticate(request("admin"))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,71 @@
+package reload
+
+import (
+	"errors"
+	"github.com/rs/zerolog"
+	"sync/atomic"
+	"time"
+)
+
+// Duration перезагружаемая длительность. До первого изменения возвращает
+// значение, прочитанное zerocfg при запуске.
+type Duration struct {
+	base    *time.Duration
+	current atomic.Pointer[time.Duration]
+}
+
+// Dur регистрирует длительность key со значением base, заполняемым zerocfg.
+func Dur(key string, base *time.Duration) *Duration {
+	d := &Duration{base: base}
+	Register(key, d)
+	return d
+}
+
+// Get возвращает текущее значение.
+func (d *Duration) Get() time.Duration {
+	if current := d.current.Load(); current != nil {
+		return *current
+	}
+	return *d.base
+}
+
+func (d *Duration) String() string {
+	return d.Get().String()
+}
+
+// Set принимает длительность в формате time.ParseDuration, например "30m".
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if parsed <= 0 {
+		return errors.New("duration must be positive")
+	}
+	d.current.Store(&parsed)
+	return nil
+}
+
+type logLevel struct{}
+
+// LogLevel регистрирует key как глобальный уровень логирования zerolog.
+// Принимаются имена уровней ("debug", "info") и их номера ("-1", "0").
+func LogLevel(key string) {
+	Register(key, logLevel{})
+}
+
+func (logLevel) String() string {
+	return zerolog.GlobalLevel().String()
+}
+
+func (logLevel) Set(value string) error {
+	if value == "" {
+		return errors.New("log level is empty")
+	}
+	level, err := zerolog.ParseLevel(value)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(level)
+	return nil
+}
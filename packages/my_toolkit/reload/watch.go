@@ -0,0 +1,127 @@
+package reload
+
+import (
+	"context"
+	zfg "github.com/chaindead/zerocfg"
+	zfgEnv "github.com/chaindead/zerocfg/env"
+	zfgFlag "github.com/chaindead/zerocfg/flag"
+	zfgYaml "github.com/chaindead/zerocfg/yaml"
+	"maps"
+	"os"
+	"time"
+)
+
+// Настройки WatchConfig, общие для всех сервисов.
+var (
+	watchGroup    = zfg.NewGroup("reload")
+	watchPath     = zfg.Str("path", "./config.yaml", "RELOAD_PATH", zfg.Group(watchGroup))
+	watchInterval = zfg.Dur("interval", 10*time.Second, "RELOAD_INTERVAL", zfg.Group(watchGroup))
+)
+
+// WatchConfig вызывает Watch для файла reload.path с периодом
+// reload.interval. Ошибки передаются в onError вместе с путем файла.
+func WatchConfig(ctx context.Context, onError func(path string, err error)) {
+	path := *watchPath
+	Watch(ctx, path, *watchInterval, func(err error) {
+		onError(path, err)
+	})
+}
+
+// Watch проверяет YAML файл конфигурации раз в interval, пока не завершится
+// ctx, и при изменении времени модификации применяет перезагружаемые
+// настройки, значения которых поменялись. Значения читаются в том же порядке
+// приоритета, что и zerocfg при запуске: флаги командной строки и переменные
+// окружения перекрывают файл, поэтому правка файла не меняет настройку,
+// заданную через окружение. Настройки, которые не менялись, сохраняют
+// значения, заданные через Handler. Ошибки чтения и применения передаются в
+// onError.
+func Watch(ctx context.Context, path string, interval time.Duration, onError func(error)) {
+	if path == "" || interval <= 0 {
+		return
+	}
+
+	w, err := newWatcher(path)
+	if err != nil && onError != nil {
+		onError(err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check(onError)
+		}
+	}
+}
+
+type watcher struct {
+	path    string
+	modTime time.Time
+	last    map[string]string
+}
+
+// newWatcher запоминает текущие значения файла: при запуске их уже применил
+// zerocfg, они служат точкой отсчета.
+func newWatcher(path string) (*watcher, error) {
+	w := &watcher{path: path, modTime: modified(path)}
+	last, err := read(path)
+	w.last = last
+	return w, err
+}
+
+// check применяет значения, изменившиеся с прошлого чтения файла.
+func (w *watcher) check(onError func(error)) {
+	current := modified(w.path)
+	if current.Equal(w.modTime) {
+		return
+	}
+	w.modTime = current
+
+	found, err := read(w.path)
+	if err != nil {
+		if onError != nil {
+			onError(err)
+		}
+		return
+	}
+	for key, value := range found {
+		if previous, ok := w.last[key]; ok && previous == value {
+			continue
+		}
+		if err := Set(key, value, "file "+w.path); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	w.last = found
+}
+
+func modified(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// read читает значения зарегистрированных настроек теми же провайдерами, что
+// и zerocfg при запуске, от низшего приоритета к высшему.
+func read(path string) (map[string]string, error) {
+	awaited := make(map[string]bool)
+	for _, key := range Keys() {
+		awaited[key] = true
+	}
+
+	found := make(map[string]string)
+	for _, provider := range []zfg.Provider{zfgYaml.New(&path), zfgEnv.New(), zfgFlag.New()} {
+		values, _, err := provider.Provide(awaited, zfg.ToString)
+		if err != nil {
+			return found, err
+		}
+		maps.Copy(found, values)
+	}
+	return found, nil
+}
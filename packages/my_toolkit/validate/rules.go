@@ -0,0 +1,244 @@
+// Package validate проверяет входящие сообщения gRPC по декларативным
+// ограничениям полей до вызова обработчиков, по образцу protovalidate.
+//
+// Ограничения объявляются по именам полей proto рядом с регистрацией
+// обработчиков:
+//
+//	func init() {
+//		validate.Register(&authnv1.SignInRequest{}, validate.Fields{
+//			"email":    {validate.Required(), validate.Email()},
+//			"password": {validate.Required(), validate.MaxBytes(72)},
+//		})
+//	}
+//
+// Все нарушения сообщения возвращаются одной ошибкой InvalidRequestErr с
+// errdetails.BadRequest, по одному нарушению на поле. Register проверяет имена
+// полей по дескриптору сообщения, поэтому опечатка в имени или
+// переименованное поле обнаруживаются при запуске, а не пропускают проверку.
+package validate
+
+import (
+	"fmt"
+	"github.com/rs/xid"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"net/mail"
+	"unicode/utf8"
+)
+
+// Violation нарушение ограничения поля. Field содержит путь поля от корня
+// сообщения, например "user.email" или "records[2].email".
+type Violation struct {
+	Field       string
+	Description string
+}
+
+// Rule ограничение значения поля.
+type Rule struct {
+	check func(f field) []Violation
+	// nested ограничения полей вложенного сообщения, по которым Register
+	// проверяет имена полей.
+	nested []Fields
+}
+
+// Fields ограничения полей сообщения по именам полей proto.
+type Fields map[string][]Rule
+
+// field проверяемое значение: поле сообщения или элемент списка.
+type field struct {
+	path  string
+	fd    protoreflect.FieldDescriptor
+	value protoreflect.Value
+	set   bool
+	list  bool
+}
+
+// Required требует непустое значение: непустую строку, ненулевое число,
+// заданное сообщение или непустой список.
+func Required() Rule {
+	return Rule{check: func(f field) []Violation {
+		if f.set {
+			return nil
+		}
+		return f.violation("value is required")
+	}}
+}
+
+// Email требует адрес электронной почты без отображаемого имени. Пустое
+// значение не проверяется, обязательность задает Required.
+func Email() Rule {
+	return str(func(s string) string {
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return "value must be a valid email address"
+		}
+		return ""
+	})
+}
+
+// XID требует идентификатор в формате xid.
+func XID() Rule {
+	return str(func(s string) string {
+		if _, err := xid.FromString(s); err != nil {
+			return "value must be a valid xid"
+		}
+		return ""
+	})
+}
+
+// MinLen требует строку не короче n символов.
+func MinLen(n int) Rule {
+	return str(func(s string) string {
+		if utf8.RuneCountInString(s) < n {
+			return fmt.Sprintf("value length must be at least %d characters", n)
+		}
+		return ""
+	})
+}
+
+// MaxLen требует строку не длиннее n символов.
+func MaxLen(n int) Rule {
+	return str(func(s string) string {
+		if utf8.RuneCountInString(s) > n {
+			return fmt.Sprintf("value length must be at most %d characters", n)
+		}
+		return ""
+	})
+}
+
+// MaxBytes требует строку не длиннее n байт в UTF-8, например для значений,
+// которые ограничены в байтах, как пароль для bcrypt.
+func MaxBytes(n int) Rule {
+	return str(func(s string) string {
+		if len(s) > n {
+			return fmt.Sprintf("value length must be at most %d bytes", n)
+		}
+		return ""
+	})
+}
+
+// MaxItems ограничивает число элементов списка.
+func MaxItems(n int) Rule {
+	return Rule{check: func(f field) []Violation {
+		if !f.set || !f.list || f.value.List().Len() <= n {
+			return nil
+		}
+		return f.violation(fmt.Sprintf("value must contain at most %d items", n))
+	}}
+}
+
+// Each применяет ограничения к каждому элементу списка.
+func Each(rules ...Rule) Rule {
+	var nested []Fields
+	for _, rule := range rules {
+		nested = append(nested, rule.nested...)
+	}
+	return Rule{nested: nested, check: func(f field) []Violation {
+		if !f.set || !f.list {
+			return nil
+		}
+		var violations []Violation
+		list := f.value.List()
+		for i := 0; i < list.Len(); i++ {
+			item := field{
+				path:  fmt.Sprintf("%s[%d]", f.path, i),
+				fd:    f.fd,
+				value: list.Get(i),
+			}
+			item.set = isSet(item.fd, item.value)
+			for _, rule := range rules {
+				violations = append(violations, rule.check(item)...)
+			}
+		}
+		return violations
+	}}
+}
+
+// Nested проверяет вложенное сообщение по ограничениям его полей. Для
+// списка сообщений ограничения применяются к каждому элементу через Each.
+func Nested(fields Fields) Rule {
+	return Rule{nested: []Fields{fields}, check: func(f field) []Violation {
+		if !f.set || f.list || f.fd.Kind() != protoreflect.MessageKind {
+			return nil
+		}
+		return check(f.path+".", f.value.Message(), fields)
+	}}
+}
+
+// str применяет проверку к непустому строковому значению.
+func str(validate func(s string) string) Rule {
+	return Rule{check: func(f field) []Violation {
+		if !f.set || f.list || f.fd.Kind() != protoreflect.StringKind {
+			return nil
+		}
+		if description := validate(f.value.String()); description != "" {
+			return f.violation(description)
+		}
+		return nil
+	}}
+}
+
+func (f field) violation(description string) []Violation {
+	return []Violation{{Field: f.path, Description: description}}
+}
+
+// verify проверяет, что поля fields есть в сообщении desc, а вложенные
+// ограничения заданы для полей-сообщений.
+func verify(prefix string, desc protoreflect.MessageDescriptor, fields Fields) error {
+	for name, rules := range fields {
+		fd := desc.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			return fmt.Errorf("no field %q", prefix+name)
+		}
+		for _, rule := range rules {
+			for _, nested := range rule.nested {
+				if fd.Message() == nil {
+					return fmt.Errorf("field %q is not a message", prefix+name)
+				}
+				if err := verify(prefix+name+".", fd.Message(), nested); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// check проверяет поля сообщения в порядке их объявления в proto, чтобы
+// нарушения возвращались в стабильном порядке.
+func check(prefix string, msg protoreflect.Message, fields Fields) []Violation {
+	var violations []Violation
+	descriptors := msg.Descriptor().Fields()
+	for i := 0; i < descriptors.Len(); i++ {
+		fd := descriptors.Get(i)
+		rules, ok := fields[string(fd.Name())]
+		if !ok {
+			continue
+		}
+		f := field{
+			path:  prefix + string(fd.Name()),
+			fd:    fd,
+			value: msg.Get(fd),
+			set:   msg.Has(fd),
+			list:  fd.IsList(),
+		}
+		for _, rule := range rules {
+			violations = append(violations, rule.check(f)...)
+		}
+	}
+	return violations
+}
+
+// isSet определяет, задан ли элемент списка, по тем же правилам, что и
+// msg.Has для полей proto3.
+func isSet(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return v.String() != ""
+	case protoreflect.BytesKind:
+		return len(v.Bytes()) > 0
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return v.Message().IsValid()
+	default:
+		return v.Interface() != fd.Default().Interface()
+	}
+}
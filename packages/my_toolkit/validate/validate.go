@@ -0,0 +1,140 @@
+package validate
+
+import (
+	"context"
+	"fmt"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strings"
+	"sync"
+)
+
+const (
+	InvalidRequestErr fault.Code = "InvalidRequestErr" // InvalidRequestErr: "некорректный запрос"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidRequestErr)
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[protoreflect.FullName]Fields{}
+)
+
+// Register объявляет ограничения полей сообщений типа msg. Повторная
+// регистрация типа заменяет ограничения. Поле, которого нет в сообщении,
+// вызывает панику: Register вызывается из init, и ошибка в ограничениях
+// должна останавливать запуск.
+func Register(msg proto.Message, fields Fields) {
+	desc := msg.ProtoReflect().Descriptor()
+	if err := verify("", desc, fields); err != nil {
+		panic(fmt.Errorf("validate: %s: %w", desc.FullName(), err))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	registry[desc.FullName()] = fields
+}
+
+// Error ошибка валидации запроса со всеми нарушениями ограничений полей.
+type Error struct {
+	*fault.Fault
+	Violations []Violation
+}
+
+func (e *Error) Unwrap() error {
+	return e.Fault
+}
+
+// Error перечисляет нарушения после сообщения кода, чтобы они были видны в
+// логах без разбора деталей статуса.
+func (e *Error) Error() string {
+	fields := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		fields[i] = v.Field + ": " + v.Description
+	}
+	return e.Fault.Error() + ": " + strings.Join(fields, "; ")
+}
+
+// ToProto дополняет статус ошибки нарушениями в виде errdetails.BadRequest.
+func (e *Error) ToProto() error {
+	st := faultstatus.Status(e.Fault)
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		}
+	}
+
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// Message проверяет сообщение по зарегистрированным ограничениям. Сообщения
+// без ограничений считаются корректными.
+func Message(msg proto.Message) error {
+	m := msg.ProtoReflect()
+
+	mu.RLock()
+	fields, ok := registry[m.Descriptor().FullName()]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	if violations := check("", m, fields); len(violations) > 0 {
+		return &Error{
+			Fault:      InvalidRequestErr.Err(),
+			Violations: violations,
+		}
+	}
+	return nil
+}
+
+// UnaryServerInterceptor отклоняет некорректные запросы до вызова
+// обработчика.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if msg, ok := req.(proto.Message); ok {
+			if err := Message(msg); err != nil {
+				return nil, faultstatus.ToProto(err)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor проверяет каждое сообщение, полученное
+// обработчиком потока. Некорректное сообщение завершает поток ошибкой.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: stream})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if msg, ok := m.(proto.Message); ok {
+		if err := Message(msg); err != nil {
+			return faultstatus.ToProto(err)
+		}
+	}
+	return nil
+}
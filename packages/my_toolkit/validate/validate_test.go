@@ -0,0 +1,130 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func init() {
+	Register(&errdetails.ErrorInfo{}, Fields{
+		"reason": {Required(), MinLen(3), MaxLen(8)},
+		"domain": {Email()},
+	})
+	Register(&errdetails.BadRequest{}, Fields{
+		"field_violations": {Required(), MaxItems(2), Each(Nested(Fields{
+			"field":       {Required(), XID()},
+			"description": {MaxLen(4)},
+		}))},
+	})
+	Register(&errdetails.LocalizedMessage{}, Fields{
+		"message": {MaxBytes(6)},
+	})
+}
+
+func violations(t *testing.T, err error) []Violation {
+	t.Helper()
+	var verr *Error
+	require.True(t, errors.As(err, &verr), "ожидалась ошибка валидации, получено %v", err)
+	assert.Equal(t, InvalidRequestErr.Err().Error(), verr.Fault.Error())
+	return verr.Violations
+}
+
+func TestMessage(t *testing.T) {
+	t.Run("корректное сообщение", func(t *testing.T) {
+		assert.NoError(t, Message(&errdetails.ErrorInfo{Reason: "ok!", Domain: "admin@example.com"}))
+	})
+
+	t.Run("сообщение без ограничений", func(t *testing.T) {
+		assert.NoError(t, Message(&errdetails.RetryInfo{}))
+	})
+
+	t.Run("все нарушения в порядке полей", func(t *testing.T) {
+		err := Message(&errdetails.ErrorInfo{Domain: "Admin <admin@example.com>"})
+		assert.Equal(t, []Violation{
+			{Field: "reason", Description: "value is required"},
+			{Field: "domain", Description: "value must be a valid email address"},
+		}, violations(t, err))
+	})
+
+	t.Run("длина в символах", func(t *testing.T) {
+		assert.NoError(t, Message(&errdetails.ErrorInfo{Reason: "ключ"}))
+		err := Message(&errdetails.ErrorInfo{Reason: "слишком длинный"})
+		assert.Equal(t, []Violation{
+			{Field: "reason", Description: "value length must be at most 8 characters"},
+		}, violations(t, err))
+	})
+
+	t.Run("длина в байтах", func(t *testing.T) {
+		assert.NoError(t, Message(&errdetails.LocalizedMessage{Message: "ключ"[:6]}))
+		err := Message(&errdetails.LocalizedMessage{Message: "ключ"})
+		assert.Equal(t, []Violation{
+			{Field: "message", Description: "value length must be at most 6 bytes"},
+		}, violations(t, err))
+	})
+
+	t.Run("элементы списка", func(t *testing.T) {
+		err := Message(&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "9m4e2mr0ui3e8a215n4g"},
+			{Field: "bad", Description: "toolong"},
+			{},
+		}})
+		assert.Equal(t, []Violation{
+			{Field: "field_violations", Description: "value must contain at most 2 items"},
+			{Field: "field_violations[1].field", Description: "value must be a valid xid"},
+			{Field: "field_violations[1].description", Description: "value length must be at most 4 characters"},
+			{Field: "field_violations[2].field", Description: "value is required"},
+		}, violations(t, err))
+	})
+}
+
+func TestRegister(t *testing.T) {
+	assert.PanicsWithError(t, `validate: google.rpc.RetryInfo: no field "delay"`, func() {
+		Register(&errdetails.RetryInfo{}, Fields{"delay": {Required()}})
+	})
+	assert.PanicsWithError(t, `validate: google.rpc.BadRequest: no field "field_violations.name"`, func() {
+		Register(&errdetails.BadRequest{}, Fields{
+			"field_violations": {Each(Nested(Fields{"name": {Required()}}))},
+		})
+	})
+	assert.PanicsWithError(t, `validate: google.rpc.ErrorInfo: field "reason" is not a message`, func() {
+		Register(&errdetails.ErrorInfo{}, Fields{"reason": {Nested(Fields{})}})
+	})
+
+	// Неудачная регистрация не заменяет ограничения.
+	assert.Error(t, Message(&errdetails.ErrorInfo{}))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	called := false
+	handler := func(ctx context.Context, req any) (any, error) {
+		called = true
+		return req, nil
+	}
+
+	_, err := interceptor(context.Background(), &errdetails.ErrorInfo{}, &grpc.UnaryServerInfo{}, handler)
+	assert.False(t, called)
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	var details *errdetails.BadRequest
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*errdetails.BadRequest); ok {
+			details = d
+		}
+	}
+	require.NotNil(t, details)
+	require.Len(t, details.GetFieldViolations(), 1)
+	assert.Equal(t, "reason", details.GetFieldViolations()[0].GetField())
+
+	_, err = interceptor(context.Background(), &errdetails.ErrorInfo{Reason: "valid"}, &grpc.UnaryServerInfo{}, handler)
+	assert.NoError(t, err)
+	assert.True(t, called)
+}
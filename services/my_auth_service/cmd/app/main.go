@@ -1,7 +1,24 @@
 package main
 
-import "github.com/hughbliss/my_auth_service/internal/app"
+import (
+	"fmt"
+	"github.com/hughbliss/my_auth_service/internal/app"
+	"os"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := app.Commands[os.Args[1]]; ok {
+			args := os.Args[2:]
+			// Аргументы подкоманды не должны попасть в разбор конфигурации.
+			os.Args = os.Args[:1]
+			if err := command(args); err != nil {
+				fmt.Fprintln(os.Stderr, app.ErrorText(err))
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	app.Run()
 }
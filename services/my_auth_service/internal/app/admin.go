@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	zfg "github.com/chaindead/zerocfg"
+	"github.com/hughbliss/my_auth_service/internal/service/authn"
+	"github.com/hughbliss/my_toolkit/lifecycle"
+	"github.com/hughbliss/my_toolkit/reload"
+	"github.com/rs/zerolog/log"
+	"net/http"
+	"time"
+)
+
+var (
+	adminGroup = zfg.NewGroup("admin")
+	adminAddr  = zfg.Str("addr", "0.0.0.0:12001", "ADMIN_ADDR", zfg.Group(adminGroup))
+)
+
+// initReload следит за reload.path и применяет изменения log.level и времени
+// жизни токенов без перезапуска.
+func initReload(ctx context.Context) {
+	reload.LogLevel("log.level")
+	go reload.WatchConfig(ctx, func(path string, err error) {
+		log.Error().Err(err).Str("path", path).Msg("failed to reload config")
+	})
+}
+
+// initAdmin запускает HTTP ручку /admin/config на admin.addr для просмотра и
+// изменения перезагружаемых настроек. Пустой admin.addr отключает ручку.
+func initAdmin(runner *lifecycle.Runner, authnService authn.AuthenticationService) {
+	if *adminAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/config", reload.Handler(adminAuthenticator(authnService)))
+	server := &http.Server{
+		Addr:              *adminAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	runner.Go("admin", server.ListenAndServe)
+	runner.OnStop("admin", server.Shutdown)
+}
+
+// adminAuthenticator пропускает пользователей с доступом reload.ConfigPermission
+// по access token из заголовка Authorization.
+func adminAuthenticator(authnService authn.AuthenticationService) reload.Authenticator {
+	return reload.PermissionAuthenticator(func(ctx context.Context, accessToken string) (string, []string, error) {
+		userMeta, err := authnService.Authorize(ctx, accessToken)
+		if err != nil {
+			return "", nil, err
+		}
+		return userMeta.Email, userMeta.Permissions, nil
+	}, reload.ConfigPermission)
+}
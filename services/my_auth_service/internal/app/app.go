@@ -2,29 +2,63 @@ package app
 
 import (
 	"context"
+	"fmt"
 	zfg "github.com/chaindead/zerocfg"
 	"github.com/hughbliss/my_auth_service/internal/handler"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
 	"github.com/hughbliss/my_auth_service/internal/service/authn"
 	"github.com/hughbliss/my_auth_service/internal/usecase"
+	"github.com/hughbliss/my_auth_service/locales"
 	"github.com/hughbliss/my_database/pkg/dbauthclient"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
 	admrolserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/roles/v1"
 	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
 	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
 	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
 	"github.com/hughbliss/my_toolkit/cfg"
-	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultlocale"
+	"github.com/hughbliss/my_toolkit/faultstatus"
 	"github.com/hughbliss/my_toolkit/grpcerver"
+	"github.com/hughbliss/my_toolkit/health"
+	"github.com/hughbliss/my_toolkit/lifecycle"
+	"github.com/hughbliss/my_toolkit/metrics"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/hughbliss/my_toolkit/telemetry"
 	"github.com/hughbliss/my_toolkit/telemetry/tracer"
 	traceExporter "github.com/hughbliss/my_toolkit/telemetry/tracer/exporter/jaeger"
 	"github.com/hughbliss/my_toolkit/telemetry/tracer/trace_middleware"
+	"github.com/hughbliss/my_toolkit/validate"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"os"
+	"time"
 )
 
 var (
 	appName = zfg.Str("app_name", "auth_service", "APPNAME")
 	appVer  = zfg.Str("app_ver", "local", "APPVER", zfg.Alias("v"))
 	env     = zfg.Str("env", "local", "ENV", zfg.Alias("e"))
+
+	outboxGroup       = zfg.NewGroup("outbox")
+	outboxEnabled     = zfg.Bool("enabled", false, "OUTBOX_ENABLED", zfg.Group(outboxGroup))
+	outboxInterval    = zfg.Dur("interval", time.Second, "OUTBOX_INTERVAL", zfg.Group(outboxGroup))
+	outboxBatchSize   = zfg.Int("batch_size", 100, "OUTBOX_BATCHSIZE", zfg.Group(outboxGroup))
+	outboxRetention   = zfg.Dur("retention", 7*24*time.Hour, "OUTBOX_RETENTION", zfg.Group(outboxGroup))
+	outboxMaxAttempts = zfg.Int("max_attempts", 10, "OUTBOX_MAXATTEMPTS", zfg.Group(outboxGroup))
+
+	meterGroup          = zfg.NewGroup("meter")
+	meterExporterName   = zfg.Str("exporter", metrics.ExporterNone, "METER_EXPORTER", zfg.Group(meterGroup))
+	meterPrometheusAddr = zfg.Str("prometheus_addr", "0.0.0.0:9464", "METER_PROMETHEUSADDR", zfg.Group(meterGroup))
+
+	localeGroup    = zfg.NewGroup("locale")
+	localeFallback = zfg.Str("fallback", "ru", "LOCALE_FALLBACK", zfg.Group(localeGroup))
+
+	shutdownGroup   = zfg.NewGroup("shutdown")
+	shutdownTimeout = zfg.Dur("timeout", 15*time.Second, "SHUTDOWN_TIMEOUT", zfg.Group(shutdownGroup))
+
+	healthGroup    = zfg.NewGroup("health")
+	healthInterval = zfg.Dur("interval", 5*time.Second, "HEALTH_INTERVAL", zfg.Group(healthGroup))
+	healthTimeout  = zfg.Dur("timeout", 2*time.Second, "HEALTH_TIMEOUT", zfg.Group(healthGroup))
 )
 
 func initTelemetry() func() {
@@ -36,20 +70,15 @@ func initTelemetry() func() {
 		panic(err)
 	}
 
-	if err := fault.InitLocales("./locales/ru.yaml"); err != nil {
+	tracerDown := tracer.Init(ctx, resourceMeta, jaegerExporter)
+
+	meterDown, err := metrics.InitExporter(ctx, resourceMeta, *meterExporterName, *meterPrometheusAddr)
+	if err != nil {
 		panic(err)
 	}
 
-	//otlpMeter, err := meterExporter.OTLPMeter(ctx)
-	//if err != nil {
-	//	panic(err)
-	//}
-
-	tracerDown := tracer.Init(ctx, resourceMeta, jaegerExporter)
-	//meterDown := meter.Init(ctx, resourceMeta, otlpMeter)
-
 	return func() {
-		//meterDown()
+		meterDown()
 		tracerDown()
 	}
 }
@@ -60,19 +89,59 @@ func Run() {
 		panic(err)
 	}
 
-	lelemetryDown := initTelemetry()
-	defer lelemetryDown()
+	runner := lifecycle.New(*shutdownTimeout)
+	ctx := runner.Context()
+
+	telemetryDown := initTelemetry()
 
 	reporter.Init(*appName, *appVer, *env, trace_middleware.HookForLogger())
+	initReload(ctx)
 
 	db, err := dbauthclient.Init(&dbauthclient.Config{Debug: false})
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+	// Шаги выполняются в обратном порядке: телеметрия сбрасывается после
+	// остановки сервера, база данных закрывается последней.
+	runner.OnStop("db", lifecycle.Close(db))
+	runner.OnStop("telemetry", lifecycle.Func(telemetryDown))
+
+	if err := checkMigrations(ctx, db); err != nil {
+		panic(err)
+	}
+
+	if *outboxEnabled {
+		stop, err := initOutbox(ctx, db)
+		if err != nil {
+			panic(err)
+		}
+		runner.OnStop("outbox", stop)
+	}
+
+	catalog, err := initLocales()
+	if err != nil {
+		panic(err)
+	}
 
-	s := grpcerver.Init()
-	defer s.GracefulStop()
+	// catalog оборачивает faultstatus: к переводу сообщения код ошибки уже
+	// должен быть определен.
+	s := grpcerver.Init(
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			catalog.UnaryServerInterceptor(),
+			faultstatus.UnaryServerInterceptor(),
+			validate.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			runner.StreamServerInterceptor(),
+			metrics.StreamServerInterceptor(),
+			catalog.StreamServerInterceptor(),
+			faultstatus.StreamServerInterceptor(),
+			validate.StreamServerInterceptor(),
+		),
+	)
+
+	initHealth(ctx, s, db)
 
 	// REPOSITORIES
 
@@ -82,6 +151,7 @@ func Run() {
 	// USECASES
 	rolesUsecase := usecase.NewRolesUsecase(db)
 	usersUsecase := usecase.NewUsersUsecase(db)
+	accessUsecase := usecase.NewAccessUsecase(db, authnService)
 
 	// HANDLERS
 	authnHandler := handler.NewAuthenticationHandler(authnService)
@@ -93,16 +163,90 @@ func Run() {
 	adminUserHandler := handler.NewAdminUserHandler(usersUsecase)
 	admusrserv1.RegisterAdminUsersServiceServer(s, adminUserHandler)
 
-	permissionsHandler := handler.NewPermissionsHandler()
+	permissionsHandler := handler.NewPermissionsHandler(accessUsecase)
 	perserv1.RegisterPermissionsServiceServer(s, permissionsHandler)
 
+	initAdmin(runner, authnService)
+
 	listener, err := grpcerver.Listener()
 	if err != nil {
 		panic(err)
 	}
-	defer listener.Close()
 
-	if err := s.Serve(listener); err != nil {
-		panic(err)
+	runner.Go("grpc", func() error { return s.Serve(listener) })
+	runner.OnStop("grpc", lifecycle.GRPC(s))
+
+	if err := runner.Wait(); err != nil {
+		log.Error().Err(err).Msg("shutdown failed")
+		os.Exit(1)
 	}
 }
+
+// initLocales загружает встроенные локали сообщений ошибок. Язык ответа
+// выбирается по Accept-Language клиента, иначе используется locale.fallback.
+func initLocales() (*faultlocale.Catalog, error) {
+	return faultlocale.Load(locales.FS, *localeFallback)
+}
+
+// initHealth регистрирует grpc.health.v1 с проверкой доступности базы данных.
+// Сервер перестает отвечать SERVING при недоступной базе и при остановке.
+func initHealth(ctx context.Context, s grpc.ServiceRegistrar, db *dbauth.Client) {
+	checks := health.NewChecks(*healthTimeout)
+	checks.Add("db", func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "SELECT 1")
+		return err
+	})
+
+	healthServer := health.NewServer(checks, *healthInterval)
+	healthServer.Register(s)
+	go healthServer.Run(ctx)
+}
+
+// initOutbox запускает публикацию событий outbox. Внешний Publisher пока не
+// подключен, поэтому relay разрешен только при локальном запуске: события
+// уходят в MemoryBroker и пишутся в лог. В остальных окружениях relay отметил
+// бы события опубликованными, хотя их никто не получил.
+// Возвращенный шаг остановки дожидается, пока relay завершит текущую пачку.
+func initOutbox(ctx context.Context, db *dbauth.Client) (func(ctx context.Context) error, error) {
+	if *env != "local" {
+		return nil, fmt.Errorf("outbox: no publisher configured for env %q, only the in-memory broker is available for local runs", *env)
+	}
+
+	broker := outbox.NewMemoryBroker(*outboxBatchSize)
+	events, unsubscribe := broker.Subscribe()
+	go func() {
+		<-ctx.Done()
+		unsubscribe()
+	}()
+	go func() {
+		for event := range events {
+			log.Debug().
+				Str("id", event.ID).
+				Str("type", event.Type).
+				Str("subject", event.Subject).
+				RawJSON("data", event.Data).
+				Msg("outbox event published")
+		}
+	}()
+
+	relay := outbox.NewRelay(db, broker,
+		outbox.WithInterval(*outboxInterval),
+		outbox.WithBatchSize(*outboxBatchSize),
+		outbox.WithRetention(*outboxRetention),
+		outbox.WithMaxAttempts(*outboxMaxAttempts),
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay.Run(ctx)
+	}()
+
+	return func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}, nil
+}
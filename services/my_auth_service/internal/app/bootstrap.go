@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	zfg "github.com/chaindead/zerocfg"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/usecase"
+)
+
+var (
+	bootstrapGroup         = zfg.NewGroup("bootstrap")
+	bootstrapDomain        = zfg.Str("domain", "Main", "BOOTSTRAP_DOMAIN", zfg.Group(bootstrapGroup))
+	bootstrapRole          = zfg.Str("role", "super-admin", "BOOTSTRAP_ROLE", zfg.Group(bootstrapGroup))
+	bootstrapAdminEmail    = zfg.Str("admin_email", "", "BOOTSTRAP_ADMINEMAIL", zfg.Group(bootstrapGroup))
+	bootstrapAdminName     = zfg.Str("admin_name", "Administrator", "BOOTSTRAP_ADMINNAME", zfg.Group(bootstrapGroup))
+	bootstrapAdminPassword = zfg.Str("admin_password", "", "BOOTSTRAP_ADMINPASSWORD", zfg.Secret(), zfg.Group(bootstrapGroup))
+)
+
+// BootstrapCommand создает начальный домен, роль супер-администратора и
+// администратора. Значения по умолчанию берутся из группы bootstrap конфигурации
+// (переменные окружения BOOTSTRAP_*), флаги их переопределяют. Пароль лучше
+// передавать через BOOTSTRAP_ADMINPASSWORD, чтобы он не попал в историю shell.
+func BootstrapCommand(args []string) error {
+	db, err := initCommand()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	params := new(dto.Bootstrap)
+	flags := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	flags.StringVar(&params.DomainName, "domain", *bootstrapDomain, "initial domain name")
+	flags.StringVar(&params.RoleName, "role", *bootstrapRole, "super-admin role name")
+	flags.StringVar(&params.AdminEmail, "admin-email", *bootstrapAdminEmail, "admin user email")
+	flags.StringVar(&params.AdminName, "admin-name", *bootstrapAdminName, "admin user name")
+	flags.StringVar(&params.AdminPassword, "admin-password", *bootstrapAdminPassword, "admin user password, used only when the user is created")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	result, err := usecase.NewBootstrapUsecase(db).Bootstrap(context.Background(), params)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("domain  %s %s\n", result.DomainID, state(result.DomainCreated, false))
+	fmt.Printf("role    %s %s\n", result.RoleID, state(result.RoleCreated, result.RoleUpdated))
+	fmt.Printf("admin   %s %s\n", result.AdminID, state(result.AdminCreated, result.AdminRestored || result.MembershipChanged))
+	return nil
+}
+
+func state(created, updated bool) string {
+	switch {
+	case created:
+		return "created"
+	case updated:
+		return "updated"
+	default:
+		return "unchanged"
+	}
+}
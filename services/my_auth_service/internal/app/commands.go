@@ -0,0 +1,48 @@
+package app
+
+import (
+	"github.com/hughbliss/my_database/pkg/dbauthclient"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_toolkit/cfg"
+	"github.com/hughbliss/my_toolkit/reporter"
+	"github.com/hughbliss/my_toolkit/telemetry/tracer/trace_middleware"
+)
+
+// Command подкоманда бинаря сервиса. args - аргументы после имени подкоманды.
+// Конфигурация читается так же, как при запуске сервера: из config.yaml и
+// переменных окружения.
+type Command func(args []string) error
+
+// Commands подкоманды, доступные помимо запуска сервера.
+var Commands = map[string]Command{
+	"roles":     RolesCommand,
+	"bootstrap": BootstrapCommand,
+	"migrate":   MigrateCommand,
+}
+
+// initConfig читает конфигурацию для подкоманд, которым не нужна база данных.
+func initConfig() error {
+	return cfg.Init()
+}
+
+// initCommand готовит конфигурацию, логирование и подключение к базе данных
+// для подкоманды. Телеметрия и gRPC сервер не поднимаются.
+func initCommand() (*dbauth.Client, error) {
+	if err := initConfig(); err != nil {
+		return nil, err
+	}
+
+	reporter.Init(*appName, *appVer, *env, trace_middleware.HookForLogger())
+
+	return dbauthclient.Init(&dbauthclient.Config{Debug: false})
+}
+
+// ErrorText возвращает текст ошибки подкоманды; сообщения fault выводятся на
+// языке locale.fallback.
+func ErrorText(err error) string {
+	catalog, lerr := initLocales()
+	if lerr != nil {
+		return err.Error()
+	}
+	return catalog.Text(err)
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	zfg "github.com/chaindead/zerocfg"
+	"github.com/hughbliss/my_auth_service/internal/migration"
+	"github.com/hughbliss/my_auth_service/migrations"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/rs/zerolog/log"
+	"strconv"
+	"strings"
+)
+
+var (
+	migrateGroup  = zfg.NewGroup("migrate")
+	migrateAuto   = zfg.Bool("auto", false, "MIGRATE_AUTO", zfg.Group(migrateGroup))
+	migrateDir    = zfg.Str("dir", "./migrations", "MIGRATE_DIR", zfg.Group(migrateGroup))
+	migrateDevURL = zfg.Str("dev_url", "docker://postgres/16/dev", "MIGRATE_DEVURL", zfg.Group(migrateGroup))
+)
+
+const migrateUsage = `usage: auth_service migrate <command>
+
+up [-n N]          применить N ожидающих миграций (по умолчанию все)
+down [-n N]        откатить N последних миграций (по умолчанию одну)
+status             показать текущую версию и ожидающие миграции
+diff <name>        сгенерировать миграцию из ent схемы в migrate.dir
+baseline           отметить базовую миграцию примененной без ее выполнения
+force <version>    записать версию схемы и снять отметку dirty
+
+База, созданная автомиграцией ent до версионных миграций, переводится на
+них один раз: migrate baseline, затем migrate up.
+`
+
+// MigrateCommand управляет версионными миграциями базы данных.
+func MigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	n := flags.Int("n", 0, "number of migrations")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	if command == "diff" {
+		if flags.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+		// Для diff нужна только ent схема и dev база, подключение к базе
+		// сервиса не требуется.
+		if err := initConfig(); err != nil {
+			return err
+		}
+		return migration.Diff(ctx, *migrateDir, flags.Arg(0), *migrateDevURL)
+	}
+
+	db, err := initCommand()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migration.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx, *n)
+		printMigrations("applied", applied)
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, *n)
+		printMigrations("reverted", reverted)
+		return err
+	case "baseline":
+		baseline, err := migrator.Baseline(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrations("baselined", []*migration.Migration{baseline})
+		return nil
+	case "force":
+		if flags.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.ParseUint(flags.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", flags.Arg(0))
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			return err
+		}
+		fmt.Printf("version %d\n", version)
+		return nil
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("version %d", status.Version)
+		if status.Dirty {
+			fmt.Print(" (dirty)")
+		}
+		fmt.Println()
+		printMigrations("pending", status.Pending)
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func printMigrations(action string, list []*migration.Migration) {
+	if len(list) == 0 {
+		fmt.Printf("%s: none\n", action)
+		return
+	}
+	names := make([]string, len(list))
+	for i, m := range list {
+		names[i] = m.String()
+	}
+	fmt.Printf("%s:\n  %s\n", action, strings.Join(names, "\n  "))
+}
+
+// checkMigrations не дает сервису стартовать на отстающей схеме. При
+// migrate.auto ожидающие миграции применяются автоматически.
+func checkMigrations(ctx context.Context, db *dbauth.Client) error {
+	migrator, err := migration.New(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	before, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	after, err := migrator.EnsureCurrent(ctx, *migrateAuto)
+	if err != nil {
+		switch {
+		case errors.Is(err, migration.ErrSchemaBehind):
+			log.Error().
+				Uint64("version", after.Version).
+				Int("pending", len(after.Pending)).
+				Msg("database schema is behind")
+		case errors.Is(err, migration.ErrUntracked):
+			log.Error().Msg("database was created without migrations, run `migrate baseline`")
+		}
+		return err
+	}
+
+	if after.Version != before.Version {
+		log.Info().Uint64("from", before.Version).Uint64("to", after.Version).Msg("database migrated")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/usecase"
+	"io"
+	"os"
+	"strings"
+)
+
+const rolesUsage = `usage: auth_service roles <plan|apply> -f roles.yaml
+
+plan   показывает изменения, необходимые для приведения ролей к документу
+apply  рассчитывает и применяет план в одной транзакции
+`
+
+// RolesCommand сверяет роли в базе данных с YAML документом (см. dto.RolesDocument).
+func RolesCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "plan" && args[0] != "apply") {
+		return errors.New(rolesUsage)
+	}
+	apply := args[0] == "apply"
+
+	flags := flag.NewFlagSet("roles "+args[0], flag.ContinueOnError)
+	file := flags.String("f", "roles.yaml", "path to roles document")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	doc, err := dto.ParseRolesDocument(data)
+	if err != nil {
+		return err
+	}
+
+	db, err := initCommand()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	plan, err := usecase.NewRolesUsecase(db).ReconcileRoles(context.Background(), doc, apply)
+	if err != nil {
+		var unknown *usecase.UnknownPermissionsError
+		if errors.As(err, &unknown) {
+			return fmt.Errorf("%w: %s", err, strings.Join(unknown.Aliases, ", "))
+		}
+		return err
+	}
+
+	printRolesPlan(os.Stdout, plan)
+	return nil
+}
+
+func printRolesPlan(w io.Writer, plan *dto.RolesPlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Fprintln(w, "No changes. Roles match the document.")
+		return
+	}
+
+	var created, updated, deleted int
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case dto.RolePlanCreate:
+			created++
+			fmt.Fprintf(w, "+ %s/%s\n", change.DomainName, change.RoleName)
+		case dto.RolePlanUpdate:
+			updated++
+			fmt.Fprintf(w, "~ %s/%s\n", change.DomainName, change.RoleName)
+			if change.DescriptionChanged {
+				fmt.Fprintf(w, "    description: %q\n", change.Description)
+			}
+		case dto.RolePlanDelete:
+			deleted++
+			fmt.Fprintf(w, "- %s/%s", change.DomainName, change.RoleName)
+			if change.AssignedUsers > 0 {
+				fmt.Fprintf(w, " (assigned to %d users)", change.AssignedUsers)
+			}
+			fmt.Fprintln(w)
+		}
+		for _, alias := range change.AddedPermissions {
+			fmt.Fprintf(w, "    + %s\n", alias)
+		}
+		for _, alias := range change.RemovedPermissions {
+			fmt.Fprintf(w, "    - %s\n", alias)
+		}
+	}
+
+	verb := "to"
+	if plan.Applied {
+		verb = "applied:"
+	}
+	fmt.Fprintf(w, "\nPlan %s %d create, %d update, %d delete.\n", verb, created, updated, deleted)
+}
@@ -0,0 +1,115 @@
+package dto
+
+import (
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	InvalidAccessCheckIDErr fault.Code = "InvalidAccessCheckIDErr" // InvalidAccessCheckIDErr: "некорректный идентификатор пользователя или домена в проверке доступа"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidAccessCheckIDErr)
+}
+
+// Причины решений CheckAccess. Значения стабильны и предназначены для разбора
+// клиентами, поэтому не локализуются.
+const (
+	AccessGranted                = "granted"
+	AccessInvalidToken           = "invalid_token"
+	AccessUserNotFound           = "user_not_found"
+	AccessUserInactive           = "user_inactive"
+	AccessUnknownPermission      = "unknown_permission"
+	AccessNotAMember             = "not_a_member"
+	AccessPermissionMissing      = "permission_missing"
+	AccessResourceDomainMismatch = "resource_domain_mismatch"
+)
+
+// ResourceDomainAttr атрибут ресурса с идентификатором домена, которому он принадлежит.
+const ResourceDomainAttr = "domain_id"
+
+// AccessCheck запрос "может ли пользователь выполнить действие над ресурсом".
+// Пользователь задается либо UserID, либо AccessToken.
+type AccessCheck struct {
+	UserID      xid.ID
+	AccessToken string
+	Permission  string
+	DomainID    xid.ID            // DomainID домен проверки, по умолчанию текущий домен пользователя.
+	Resource    map[string]string // Resource атрибуты ресурса.
+}
+
+// AccessCheckFromProto возвращает InvalidAccessCheckIDErr, если user_id или
+// domain_id заданы, но не являются xid. Пустые значения остаются нулевыми.
+func AccessCheckFromProto(p *perserv1.CheckAccessRequest) (*AccessCheck, error) {
+	userID, err := optionalID(p.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	domainID, err := optionalID(p.GetDomainId())
+	if err != nil {
+		return nil, err
+	}
+	return &AccessCheck{
+		UserID:      userID,
+		AccessToken: p.GetAccessToken(),
+		Permission:  p.GetPermission(),
+		DomainID:    domainID,
+		Resource:    p.GetResource(),
+	}, nil
+}
+
+func optionalID(s string) (xid.ID, error) {
+	if s == "" {
+		return xid.NilID(), nil
+	}
+	id, err := xid.FromString(s)
+	if err != nil {
+		return xid.NilID(), InvalidAccessCheckIDErr.Err()
+	}
+	return id, nil
+}
+
+// AccessDecision результат проверки доступа.
+type AccessDecision struct {
+	Allowed  bool
+	Reason   string
+	UserID   xid.ID
+	DomainID xid.ID
+	RoleID   xid.ID
+}
+
+func (d *AccessDecision) ToProto() *perserv1.CheckAccessResponse {
+	res := &perserv1.CheckAccessResponse{
+		Allowed: d.Allowed,
+		Reason:  d.Reason,
+	}
+	if !d.UserID.IsNil() {
+		res.UserId = d.UserID.String()
+	}
+	if !d.DomainID.IsNil() {
+		res.DomainId = d.DomainID.String()
+	}
+	if !d.RoleID.IsNil() {
+		res.RoleId = d.RoleID.String()
+	}
+	return res
+}
+
+type AccessDecisionList []*AccessDecision
+
+func (l AccessDecisionList) ToProto() []*perserv1.CheckAccessResponse {
+	res := make([]*perserv1.CheckAccessResponse, len(l))
+	for i, d := range l {
+		res[i] = d.ToProto()
+	}
+	return res
+}
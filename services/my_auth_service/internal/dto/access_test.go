@@ -0,0 +1,29 @@
+package dto
+
+import (
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAccessCheckFromProto(t *testing.T) {
+	userID := xid.New()
+
+	check, err := AccessCheckFromProto(&perserv1.CheckAccessRequest{UserId: userID.String(), Permission: "admin.users.read"})
+	require.NoError(t, err)
+	assert.Equal(t, userID, check.UserID)
+	assert.True(t, check.DomainID.IsNil())
+
+	for _, request := range []*perserv1.CheckAccessRequest{
+		{UserId: "not-an-id"},
+		{UserId: userID.String(), DomainId: "not-an-id"},
+	} {
+		_, err := AccessCheckFromProto(request)
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, InvalidAccessCheckIDErr.Err().Error(), f.Error())
+	}
+}
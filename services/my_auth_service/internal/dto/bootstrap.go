@@ -0,0 +1,26 @@
+package dto
+
+import "github.com/rs/xid"
+
+// Bootstrap параметры начальной настройки пустой базы данных.
+type Bootstrap struct {
+	DomainName    string
+	RoleName      string
+	AdminEmail    string
+	AdminName     string
+	AdminPassword string // AdminPassword используется только при создании администратора.
+}
+
+// BootstrapResult итог начальной настройки. Флаги показывают, что было
+// изменено; при повторном запуске все они false.
+type BootstrapResult struct {
+	DomainID          xid.ID
+	DomainCreated     bool
+	RoleID            xid.ID
+	RoleCreated       bool
+	RoleUpdated       bool // RoleUpdated в роль добавлены новые доступы каталога.
+	AdminID           xid.ID
+	AdminCreated      bool
+	AdminRestored     bool // AdminRestored заблокированный или удаленный администратор снова активен.
+	MembershipChanged bool // MembershipChanged администратору назначена роль в домене.
+}
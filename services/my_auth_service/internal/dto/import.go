@@ -0,0 +1,86 @@
+package dto
+
+import (
+	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
+	"github.com/rs/xid"
+)
+
+// Действия над строкой импорта пользователей.
+const (
+	ImportCreated   = "created"
+	ImportUpdated   = "updated"
+	ImportUnchanged = "unchanged"
+	ImportFailed    = "failed"
+)
+
+// ImportRecord строка импорта пользователей. Domain и Role задаются
+// идентификатором либо именем; роль ищется внутри указанного домена.
+type ImportRecord struct {
+	Row    int
+	Email  string
+	Name   string
+	Domain string
+	Role   string
+}
+
+func ImportRecordFromProto(row int, p *admusrserv1.ImportUserRecord) *ImportRecord {
+	return &ImportRecord{
+		Row:    row,
+		Email:  p.GetEmail(),
+		Name:   p.GetName(),
+		Domain: p.GetDomain(),
+		Role:   p.GetRole(),
+	}
+}
+
+// ImportResult результат обработки одной строки.
+type ImportResult struct {
+	Row       int
+	Email     string
+	Action    string
+	UserID    xid.ID
+	ErrorCode string // ErrorCode код fault, по которому строка отклонена.
+	Error     string // Error локализованный текст ошибки.
+}
+
+func (r *ImportResult) ToProto() *admusrserv1.ImportUserResult {
+	res := &admusrserv1.ImportUserResult{
+		Row:       int32(r.Row),
+		Email:     r.Email,
+		Action:    r.Action,
+		ErrorCode: r.ErrorCode,
+		Error:     r.Error,
+	}
+	if !r.UserID.IsNil() {
+		res.UserId = r.UserID.String()
+	}
+	return res
+}
+
+// ImportReport итог импорта. При DryRun изменения не сохранены, но действия
+// рассчитаны так же, как при реальном импорте.
+type ImportReport struct {
+	DryRun  bool
+	Results []*ImportResult
+}
+
+func (r *ImportReport) ToProto() *admusrserv1.ImportUsersResponse {
+	res := &admusrserv1.ImportUsersResponse{
+		DryRun:  r.DryRun,
+		Results: make([]*admusrserv1.ImportUserResult, len(r.Results)),
+	}
+	for i, result := range r.Results {
+		res.Results[i] = result.ToProto()
+		switch result.Action {
+		case ImportCreated:
+			res.Created++
+		case ImportUpdated:
+			res.Updated++
+		case ImportUnchanged:
+			res.Unchanged++
+		case ImportFailed:
+			res.Failed++
+		}
+	}
+	return res
+}
@@ -0,0 +1,41 @@
+package dto
+
+import (
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// Виды уведомлений WatchPermissionChanges. Значения стабильны и предназначены
+// для разбора клиентами.
+const (
+	PermissionChangeHeartbeat    = "heartbeat" // PermissionChangeHeartbeat подписка жива, ResumeToken актуален.
+	PermissionChangeRoleUpdated  = "role_updated"
+	PermissionChangeRoleDeleted  = "role_deleted"
+	PermissionChangeMembership   = "membership_changed"
+	PermissionChangeUserDisabled = "user_disabled" // PermissionChangeUserDisabled пользователь заблокирован, удален или стерт.
+	PermissionChangeUserRestored = "user_restored"
+)
+
+// PermissionChange уведомление об изменении, влияющем на доступы. ResumeToken
+// передается в WatchPermissionChanges при переподключении, чтобы продолжить
+// с уведомления, следующего за этим.
+type PermissionChange struct {
+	ResumeToken string
+	Kind        string
+	UserID      string
+	DomainID    string
+	RoleID      string
+	Time        time.Time
+}
+
+func (c *PermissionChange) ToProto() *perserv1.WatchPermissionChangesResponse {
+	return &perserv1.WatchPermissionChangesResponse{
+		ResumeToken: c.ResumeToken,
+		Kind:        c.Kind,
+		UserId:      c.UserID,
+		DomainId:    c.DomainID,
+		RoleId:      c.RoleID,
+		Time:        timestamppb.New(c.Time),
+	}
+}
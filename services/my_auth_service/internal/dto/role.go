@@ -47,6 +47,7 @@ type Role struct {
 	Description string
 	Permissions []string
 	DomainId    xid.ID
+	Version     int // Version версия роли для оптимистичной блокировки; 0 - не проверять.
 }
 
 func RoleFromProto(p *rolserv1.Role) *Role {
@@ -58,6 +59,7 @@ func RoleFromProto(p *rolserv1.Role) *Role {
 		Description: p.Description,
 		Permissions: p.Permissions,
 		DomainId:    domainId,
+		Version:     int(p.Version),
 	}
 }
 
@@ -68,6 +70,7 @@ func RoleFromEnt(e *dbauth.Role) *Role {
 		Description: e.Description,
 		Permissions: e.Permissions,
 		DomainId:    e.DomainID,
+		Version:     e.Version,
 	}
 }
 
@@ -78,6 +81,7 @@ func (r *Role) ToProto() *rolserv1.Role {
 		Description: r.Description,
 		Permissions: r.Permissions,
 		DomainId:    r.DomainId.String(),
+		Version:     int64(r.Version),
 	}
 }
 
@@ -102,3 +106,43 @@ func (l DomainRolesList) ToProto() []*admrolserv1.DomainRoles {
 	return roles
 
 }
+
+// RoleStalePermissions доступы роли, отсутствующие в каталоге acman.
+type RoleStalePermissions struct {
+	RoleID      xid.ID
+	RoleName    string
+	DomainID    xid.ID
+	Permissions []string
+}
+
+func (r *RoleStalePermissions) ToProto() *admrolserv1.RoleStalePermissions {
+	return &admrolserv1.RoleStalePermissions{
+		RoleId:      r.RoleID.String(),
+		RoleName:    r.RoleName,
+		DomainId:    r.DomainID.String(),
+		Permissions: r.Permissions,
+	}
+}
+
+type RoleStalePermissionsList []*RoleStalePermissions
+
+func (l RoleStalePermissionsList) ToProto() []*admrolserv1.RoleStalePermissions {
+	res := make([]*admrolserv1.RoleStalePermissions, len(l))
+	for i, r := range l {
+		res[i] = r.ToProto()
+	}
+	return res
+}
+
+// RoleDeletion результат удаления роли.
+type RoleDeletion struct {
+	DomainRoles     *DomainRoles
+	ReassignedUsers int // ReassignedUsers число пользователей, переведенных на другую роль.
+}
+
+func (d *RoleDeletion) ToProto() *admrolserv1.DeleteRoleResponse {
+	return &admrolserv1.DeleteRoleResponse{
+		DomainRoles:     d.DomainRoles.ToProto(),
+		ReassignedUsers: int32(d.ReassignedUsers),
+	}
+}
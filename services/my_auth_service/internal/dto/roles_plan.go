@@ -0,0 +1,127 @@
+package dto
+
+import (
+	"bytes"
+	"fmt"
+	admrolserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/roles/v1"
+	"github.com/rs/xid"
+	"gopkg.in/yaml.v3"
+)
+
+// Действия плана сверки ролей.
+const (
+	RolePlanCreate = "create"
+	RolePlanUpdate = "update"
+	RolePlanDelete = "delete"
+)
+
+// RolesDocument желаемое состояние ролей, хранимое в git. Для каждого
+// перечисленного домена список ролей полный: роли домена, отсутствующие в
+// документе, будут удалены. Домены, которых нет в документе, не затрагиваются.
+//
+//	domains:
+//	  - domain: Main
+//	    roles:
+//	      - name: admin
+//	        description: Администратор
+//	        permissions: ["*"]
+type RolesDocument struct {
+	Domains []*DomainRolesSpec `yaml:"domains"`
+}
+
+// DomainRolesSpec роли одного домена. Домен задается именем, чтобы документ
+// не зависел от идентификаторов конкретного окружения.
+type DomainRolesSpec struct {
+	Domain string      `yaml:"domain"`
+	Roles  []*RoleSpec `yaml:"roles"`
+}
+
+// RoleSpec желаемое состояние роли. Роль сопоставляется с существующей по имени.
+type RoleSpec struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Permissions []string `yaml:"permissions"`
+}
+
+// ParseRolesDocument разбирает YAML документ ролей. Неизвестные поля считаются
+// ошибкой, чтобы опечатка не превращалась в тихое удаление доступов.
+func ParseRolesDocument(data []byte) (*RolesDocument, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	doc := new(RolesDocument)
+	if err := decoder.Decode(doc); err != nil {
+		return nil, fmt.Errorf("parse roles document: %w", err)
+	}
+	return doc, nil
+}
+
+func RolesDocumentFromProto(domains []*admrolserv1.DomainRolesSpec) *RolesDocument {
+	doc := &RolesDocument{Domains: make([]*DomainRolesSpec, len(domains))}
+	for i, domain := range domains {
+		roles := make([]*RoleSpec, len(domain.GetRoles()))
+		for j, role := range domain.GetRoles() {
+			roles[j] = &RoleSpec{
+				Name:        role.GetName(),
+				Description: role.GetDescription(),
+				Permissions: role.GetPermissions(),
+			}
+		}
+		doc.Domains[i] = &DomainRolesSpec{
+			Domain: domain.GetDomain(),
+			Roles:  roles,
+		}
+	}
+	return doc
+}
+
+// RoleChange изменение одной роли в плане сверки.
+type RoleChange struct {
+	Action             string
+	DomainID           xid.ID
+	DomainName         string
+	RoleID             xid.ID // RoleID пуст для создаваемой роли до применения плана.
+	RoleName           string
+	Description        string   // Description желаемое описание роли.
+	Permissions        []string // Permissions желаемые доступы роли.
+	AddedPermissions   []string
+	RemovedPermissions []string
+	DescriptionChanged bool
+	AssignedUsers      int // AssignedUsers число пользователей с удаляемой ролью.
+}
+
+func (c *RoleChange) ToProto() *admrolserv1.RoleChange {
+	res := &admrolserv1.RoleChange{
+		Action:             c.Action,
+		DomainId:           c.DomainID.String(),
+		DomainName:         c.DomainName,
+		RoleName:           c.RoleName,
+		Description:        c.Description,
+		Permissions:        c.Permissions,
+		AddedPermissions:   c.AddedPermissions,
+		RemovedPermissions: c.RemovedPermissions,
+		DescriptionChanged: c.DescriptionChanged,
+		AssignedUsers:      int32(c.AssignedUsers),
+	}
+	if !c.RoleID.IsNil() {
+		res.RoleId = c.RoleID.String()
+	}
+	return res
+}
+
+// RolesPlan план сверки ролей с документом. Applied - план был применен.
+type RolesPlan struct {
+	Applied bool
+	Changes []*RoleChange
+}
+
+func (p *RolesPlan) ToProto() *admrolserv1.ReconcileRolesResponse {
+	changes := make([]*admrolserv1.RoleChange, len(p.Changes))
+	for i, change := range p.Changes {
+		changes[i] = change.ToProto()
+	}
+	return &admrolserv1.ReconcileRolesResponse{
+		Applied: p.Applied,
+		Changes: changes,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
 	usrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/users/v1"
 	"github.com/rs/xid"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type User struct {
@@ -43,6 +44,14 @@ func (u *User) ToProto() *admusrserv1.UserDomains {
 		Email:           u.Email,
 		PasswordHash:    "***",
 		CurrentDomainId: u.CurrentDomainID.String(),
+		Status:          string(u.Status),
+		Version:         int64(u.Version),
+	}
+	if u.DisabledAt != nil {
+		user.DisabledAt = timestamppb.New(*u.DisabledAt)
+	}
+	if u.DeletedAt != nil {
+		user.DeletedAt = timestamppb.New(*u.DeletedAt)
 	}
 
 	domainRoles := make([]*admusrserv1.DomainRole, len(u.Edges.UserDomain))
@@ -66,6 +75,7 @@ func (u *User) FromProto(p *usrserv1.User) *User {
 	u.Name = p.Name
 	u.Email = p.Email
 	u.CurrentDomainID, _ = xid.FromString(p.CurrentDomainId)
+	u.Version = int(p.Version)
 
 	return u
 }
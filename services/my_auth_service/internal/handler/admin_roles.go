@@ -2,10 +2,8 @@ package handler
 
 import (
 	"context"
-	"errors"
 	"github.com/hughbliss/my_auth_service/internal/dto"
 	admrolserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/roles/v1"
-	"github.com/hughbliss/my_toolkit/fault"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
 )
@@ -25,7 +23,9 @@ type RolesUsecase interface {
 	GetDomainsRoles(ctx context.Context) (dto.DomainRolesList, error)
 	CreateRole(ctx context.Context, role *dto.Role) (*dto.DomainRoles, error)
 	UpdateRole(ctx context.Context, role *dto.Role) (*dto.DomainRoles, error)
-	DeleteRole(ctx context.Context, roleID xid.ID) (*dto.DomainRoles, error)
+	DeleteRole(ctx context.Context, roleID, reassignTo xid.ID) (*dto.RoleDeletion, error)
+	PruneStalePermissions(ctx context.Context, apply bool) (dto.RoleStalePermissionsList, error)
+	ReconcileRoles(ctx context.Context, doc *dto.RolesDocument, apply bool) (*dto.RolesPlan, error)
 }
 
 func (r AdminRolesHandler) CreateRole(ctx context.Context, request *admrolserv1.CreateRoleRequest) (*admrolserv1.CreateRoleResponse, error) {
@@ -34,11 +34,7 @@ func (r AdminRolesHandler) CreateRole(ctx context.Context, request *admrolserv1.
 
 	domainRoles, err := r.usecase.CreateRole(ctx, dto.RoleFromProto(request.Role))
 	if err != nil {
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admrolserv1.CreateRoleResponse{
@@ -52,11 +48,7 @@ func (r AdminRolesHandler) UpdateRole(ctx context.Context, request *admrolserv1.
 
 	domainRoles, err := r.usecase.UpdateRole(ctx, dto.RoleFromProto(request.Role))
 	if err != nil {
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admrolserv1.UpdateRoleResponse{
@@ -70,21 +62,22 @@ func (r AdminRolesHandler) DeleteRole(ctx context.Context, request *admrolserv1.
 
 	roleXID, err := xid.FromString(request.GetRoleId())
 	if err != nil {
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
-	domainRoles, err := r.usecase.DeleteRole(ctx, roleXID)
-	if err != nil {
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
+	var reassignXID xid.ID
+	if request.GetReassignToRoleId() != "" {
+		if reassignXID, err = xid.FromString(request.GetReassignToRoleId()); err != nil {
+			return nil, InvalidIDErr.Err()
 		}
-		return nil, fault.UnhandledError.Err().ToProto()
 	}
 
-	return &admrolserv1.DeleteRoleResponse{
-		DomainRoles: domainRoles.ToProto(),
-	}, nil
+	deletion, err := r.usecase.DeleteRole(ctx, roleXID, reassignXID)
+	if err != nil {
+		return nil, err
+	}
+
+	return deletion.ToProto(), nil
 }
 
 func (r AdminRolesHandler) GetAllRoles(ctx context.Context, _ *admrolserv1.GetAllRolesRequest) (*admrolserv1.GetAllRolesResponse, error) {
@@ -93,14 +86,37 @@ func (r AdminRolesHandler) GetAllRoles(ctx context.Context, _ *admrolserv1.GetAl
 
 	roles, err := r.usecase.GetDomainsRoles(ctx)
 	if err != nil {
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admrolserv1.GetAllRolesResponse{
 		DomainRoles: roles.ToProto(),
 	}, nil
 }
+
+func (r AdminRolesHandler) PruneStalePermissions(ctx context.Context, request *admrolserv1.PruneStalePermissionsRequest) (*admrolserv1.PruneStalePermissionsResponse, error) {
+	ctx, _, end := r.rep.Start(ctx, "PruneStalePermissions")
+	defer end()
+
+	stale, err := r.usecase.PruneStalePermissions(ctx, request.GetApply())
+	if err != nil {
+		return nil, err
+	}
+
+	return &admrolserv1.PruneStalePermissionsResponse{
+		Roles:   stale.ToProto(),
+		Applied: request.GetApply(),
+	}, nil
+}
+
+func (r AdminRolesHandler) ReconcileRoles(ctx context.Context, request *admrolserv1.ReconcileRolesRequest) (*admrolserv1.ReconcileRolesResponse, error) {
+	ctx, _, end := r.rep.Start(ctx, "ReconcileRoles")
+	defer end()
+
+	plan, err := r.usecase.ReconcileRoles(ctx, dto.RolesDocumentFromProto(request.GetDomains()), request.GetApply())
+	if err != nil {
+		return nil, err
+	}
+
+	return plan.ToProto(), nil
+}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"errors"
 	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/usecase"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth"
 	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
-	"github.com/hughbliss/my_toolkit/fault"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
+	"io"
 )
 
 func NewAdminUserHandler(uc UsersUsecase) admusrserv1.AdminUsersServiceServer {
@@ -24,10 +25,16 @@ type AdminUserHandler struct {
 }
 
 type UsersUsecase interface {
-	AdminGetUsers(ctx context.Context) (dto.UserList, error)
+	AdminGetUsers(ctx context.Context, includeDeleted bool) (dto.UserList, error)
 	CreateUser(ctx context.Context, user *dto.User) (*dto.User, error)
 	UpdateUser(ctx context.Context, user *dto.User) (*dto.User, error)
 	DeleteUser(ctx context.Context, user *dto.User) error
+	DisableUser(ctx context.Context, userID xid.ID) (*dto.User, error)
+	RestoreUser(ctx context.Context, userID xid.ID) (*dto.User, error)
+	PurgeUser(ctx context.Context, userID xid.ID) error
+
+	ImportUsers(ctx context.Context, records []*dto.ImportRecord, dryRun bool) (*dto.ImportReport, error)
+	ExportUsers(ctx context.Context, includeDeleted bool, send func(*dto.User) error) error
 
 	AssignUserToDomain(ctx context.Context, userID, domainID, roleID xid.ID) (*dto.User, error)
 	RemoveUserFromDomain(ctx context.Context, userID, domainID xid.ID) (*dto.User, error)
@@ -35,19 +42,14 @@ type UsersUsecase interface {
 }
 
 func (a AdminUserHandler) CreateUser(ctx context.Context, request *admusrserv1.CreateUserRequest) (*admusrserv1.CreateUserResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "CreateUser")
+	ctx, _, end := a.rep.Start(ctx, "CreateUser")
 	defer end()
 
 	u := new(dto.User).FromProto(request.GetUser())
 
 	user, err := a.uc.CreateUser(ctx, u)
 	if err != nil {
-		log.Error().Err(err).Msg("CreateUser")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admusrserv1.CreateUserResponse{
@@ -56,52 +58,39 @@ func (a AdminUserHandler) CreateUser(ctx context.Context, request *admusrserv1.C
 
 }
 func (a AdminUserHandler) AssignUserToDomain(ctx context.Context, request *admusrserv1.AssignUserToDomainRequest) (*admusrserv1.AssignUserToDomainResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "AssignUser")
+	ctx, _, end := a.rep.Start(ctx, "AssignUser")
 	defer end()
 
 	userID, err := xid.FromString(request.UserId)
 	if err != nil {
-		log.Error().Err(err).Msg("AssignUser")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 	domainID, err := xid.FromString(request.DomainId)
 	if err != nil {
-		log.Error().Err(err).Msg("AssignUser")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 	roleID, err := xid.FromString(request.RoleId)
 	if err != nil {
-		log.Error().Err(err).Msg("AssignUser")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	user, err := a.uc.AssignUserToDomain(ctx, userID, domainID, roleID)
 	if err != nil {
-		log.Error().Err(err).Msg("AssignUser")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admusrserv1.AssignUserToDomainResponse{UserDomains: user.ToProto()}, nil
 
 }
 func (a AdminUserHandler) UpdateUser(ctx context.Context, request *admusrserv1.UpdateUserRequest) (*admusrserv1.UpdateUserResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "UpdateUser")
+	ctx, _, end := a.rep.Start(ctx, "UpdateUser")
 	defer end()
 
 	u := new(dto.User).FromProto(request.GetUser())
 
 	user, err := a.uc.UpdateUser(ctx, u)
 	if err != nil {
-		log.Error().Err(err).Msg("UpdateUser")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admusrserv1.UpdateUserResponse{
@@ -110,40 +99,83 @@ func (a AdminUserHandler) UpdateUser(ctx context.Context, request *admusrserv1.U
 }
 
 func (a AdminUserHandler) DeleteUser(ctx context.Context, request *admusrserv1.DeleteUserRequest) (*admusrserv1.DeleteUserResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "DeleteUser")
+	ctx, _, end := a.rep.Start(ctx, "DeleteUser")
 	defer end()
 
 	userID, err := xid.FromString(request.UserId)
 	if err != nil {
-		log.Error().Err(err).Msg("DeleteUser")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	err = a.uc.DeleteUser(ctx, &dto.User{User: dbauth.User{ID: userID}})
 	if err != nil {
-		log.Error().Err(err).Msg("DeleteUser")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admusrserv1.DeleteUserResponse{}, nil
 }
 
-func (a AdminUserHandler) GetUsers(ctx context.Context, _ *admusrserv1.GetUsersRequest) (*admusrserv1.GetUsersResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "GetUsers")
+func (a AdminUserHandler) DisableUser(ctx context.Context, request *admusrserv1.DisableUserRequest) (*admusrserv1.DisableUserResponse, error) {
+	ctx, _, end := a.rep.Start(ctx, "DisableUser")
 	defer end()
 
-	users, err := a.uc.AdminGetUsers(ctx)
+	userID, err := xid.FromString(request.UserId)
 	if err != nil {
-		log.Error().Err(err).Msg("GetUsers")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
+	}
+
+	user, err := a.uc.DisableUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &admusrserv1.DisableUserResponse{
+		UserDomains: user.ToProto(),
+	}, nil
+}
+
+func (a AdminUserHandler) RestoreUser(ctx context.Context, request *admusrserv1.RestoreUserRequest) (*admusrserv1.RestoreUserResponse, error) {
+	ctx, _, end := a.rep.Start(ctx, "RestoreUser")
+	defer end()
+
+	userID, err := xid.FromString(request.UserId)
+	if err != nil {
+		return nil, InvalidIDErr.Err()
+	}
+
+	user, err := a.uc.RestoreUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &admusrserv1.RestoreUserResponse{
+		UserDomains: user.ToProto(),
+	}, nil
+}
+
+func (a AdminUserHandler) PurgeUser(ctx context.Context, request *admusrserv1.PurgeUserRequest) (*admusrserv1.PurgeUserResponse, error) {
+	ctx, _, end := a.rep.Start(ctx, "PurgeUser")
+	defer end()
+
+	userID, err := xid.FromString(request.UserId)
+	if err != nil {
+		return nil, InvalidIDErr.Err()
+	}
+
+	if err := a.uc.PurgeUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	return &admusrserv1.PurgeUserResponse{}, nil
+}
+
+func (a AdminUserHandler) GetUsers(ctx context.Context, request *admusrserv1.GetUsersRequest) (*admusrserv1.GetUsersResponse, error) {
+	ctx, _, end := a.rep.Start(ctx, "GetUsers")
+	defer end()
+
+	users, err := a.uc.AdminGetUsers(ctx, request.GetIncludeDeleted())
+	if err != nil {
+		return nil, err
 	}
 
 	return &admusrserv1.GetUsersResponse{
@@ -152,29 +184,22 @@ func (a AdminUserHandler) GetUsers(ctx context.Context, _ *admusrserv1.GetUsersR
 }
 
 func (a AdminUserHandler) RemoveUserFromDomain(ctx context.Context, request *admusrserv1.RemoveUserFromDomainRequest) (*admusrserv1.RemoveUserFromDomainResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "RemoveUserFromDomain")
+	ctx, _, end := a.rep.Start(ctx, "RemoveUserFromDomain")
 	defer end()
 
 	userID, err := xid.FromString(request.UserId)
 	if err != nil {
-		log.Error().Err(err).Msg("RemoveUserFromDomain")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	domainID, err := xid.FromString(request.DomainId)
 	if err != nil {
-		log.Error().Err(err).Msg("RemoveUserFromDomain")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	user, err := a.uc.RemoveUserFromDomain(ctx, userID, domainID)
 	if err != nil {
-		log.Error().Err(err).Msg("RemoveUserFromDomain")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admusrserv1.RemoveUserFromDomainResponse{
@@ -183,38 +208,69 @@ func (a AdminUserHandler) RemoveUserFromDomain(ctx context.Context, request *adm
 }
 
 func (a AdminUserHandler) UpdateUserDomainRole(ctx context.Context, request *admusrserv1.UpdateUserDomainRoleRequest) (*admusrserv1.UpdateUserDomainRoleResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "UpdateUserDomainRole")
+	ctx, _, end := a.rep.Start(ctx, "UpdateUserDomainRole")
 	defer end()
 
 	userID, err := xid.FromString(request.UserId)
 	if err != nil {
-		log.Error().Err(err).Msg("UpdateUserDomainRole")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	domainID, err := xid.FromString(request.DomainId)
 	if err != nil {
-		log.Error().Err(err).Msg("UpdateUserDomainRole")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	roleID, err := xid.FromString(request.RoleId)
 	if err != nil {
-		log.Error().Err(err).Msg("UpdateUserDomainRole")
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, InvalidIDErr.Err()
 	}
 
 	user, err := a.uc.UpdateRole(ctx, userID, domainID, roleID)
 	if err != nil {
-		log.Error().Err(err).Msg("UpdateUserDomainRole")
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &admusrserv1.UpdateUserDomainRoleResponse{
 		UserDomains: user.ToProto(),
 	}, nil
 }
+
+func (a AdminUserHandler) ImportUsers(stream admusrserv1.AdminUsersService_ImportUsersServer) error {
+	ctx, _, end := a.rep.Start(stream.Context(), "ImportUsers")
+	defer end()
+
+	var records []*dto.ImportRecord
+	var dryRun bool
+	for {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		dryRun = dryRun || request.GetDryRun()
+		records = append(records, dto.ImportRecordFromProto(len(records)+1, request.GetRecord()))
+		// Остаток потока не читается: импорт больше лимита отклоняется целиком.
+		if len(records) > usecase.MaxImportRows {
+			return usecase.InvalidImportErr.Err()
+		}
+	}
+
+	report, err := a.uc.ImportUsers(ctx, records, dryRun)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(report.ToProto())
+}
+
+func (a AdminUserHandler) ExportUsers(request *admusrserv1.ExportUsersRequest, stream admusrserv1.AdminUsersService_ExportUsersServer) error {
+	ctx, _, end := a.rep.Start(stream.Context(), "ExportUsers")
+	defer end()
+
+	return a.uc.ExportUsers(ctx, request.GetIncludeDeleted(), func(user *dto.User) error {
+		return stream.Send(&admusrserv1.ExportUsersResponse{UserDomains: user.ToProto()})
+	})
+}
@@ -2,10 +2,8 @@ package handler
 
 import (
 	"context"
-	"errors"
 	"github.com/hughbliss/my_auth_service/internal/service/authn"
 	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
-	"github.com/hughbliss/my_toolkit/fault"
 	"github.com/hughbliss/my_toolkit/reporter"
 )
 
@@ -22,7 +20,7 @@ type AuthenticationHandler struct {
 }
 
 func (a AuthenticationHandler) SignUp(ctx context.Context, request *authnv1.SignUpRequest) (*authnv1.SignUpResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "SignUp")
+	ctx, _, end := a.rep.Start(ctx, "SignUp")
 	defer end()
 
 	tokens, err := a.service.SignUp(ctx, &authn.SignUp{
@@ -31,12 +29,7 @@ func (a AuthenticationHandler) SignUp(ctx context.Context, request *authnv1.Sign
 		Name:     request.Name,
 	})
 	if err != nil {
-		log.Error().Err(err).Send()
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &authnv1.SignUpResponse{
@@ -46,7 +39,7 @@ func (a AuthenticationHandler) SignUp(ctx context.Context, request *authnv1.Sign
 }
 
 func (a AuthenticationHandler) SignIn(ctx context.Context, request *authnv1.SignInRequest) (*authnv1.SignInResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "SignIn")
+	ctx, _, end := a.rep.Start(ctx, "SignIn")
 	defer end()
 
 	tokens, err := a.service.SignIn(ctx, &authn.SignIn{
@@ -54,12 +47,7 @@ func (a AuthenticationHandler) SignIn(ctx context.Context, request *authnv1.Sign
 		Password: request.Password,
 	})
 	if err != nil {
-		log.Error().Err(err).Send()
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &authnv1.SignInResponse{
@@ -69,17 +57,12 @@ func (a AuthenticationHandler) SignIn(ctx context.Context, request *authnv1.Sign
 }
 
 func (a AuthenticationHandler) RefreshToken(ctx context.Context, request *authnv1.RefreshTokenRequest) (*authnv1.RefreshTokenResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "RefreshToken")
+	ctx, _, end := a.rep.Start(ctx, "RefreshToken")
 	defer end()
 
 	tokens, err := a.service.RefreshToken(ctx, request.RefreshToken)
 	if err != nil {
-		log.Error().Err(err).Send()
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &authnv1.RefreshTokenResponse{
@@ -89,17 +72,12 @@ func (a AuthenticationHandler) RefreshToken(ctx context.Context, request *authnv
 }
 
 func (a AuthenticationHandler) Authorize(ctx context.Context, request *authnv1.AuthorizeRequest) (*authnv1.AuthorizeResponse, error) {
-	ctx, log, end := a.rep.Start(ctx, "Authorize")
+	ctx, _, end := a.rep.Start(ctx, "Authorize")
 	defer end()
 
 	meta, err := a.service.Authorize(ctx, request.AccessToken)
 	if err != nil {
-		log.Error().Err(err).Send()
-		f := new(fault.Fault)
-		if errors.As(err, &f) {
-			return nil, f.ToProto()
-		}
-		return nil, fault.UnhandledError.Err().ToProto()
+		return nil, err
 	}
 
 	return &authnv1.AuthorizeResponse{
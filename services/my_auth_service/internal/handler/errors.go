@@ -0,0 +1,20 @@
+package handler
+
+import (
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"google.golang.org/grpc/codes"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	InvalidIDErr fault.Code = "InvalidIDErr" // InvalidIDErr: "некорректный идентификатор"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidIDErr)
+}
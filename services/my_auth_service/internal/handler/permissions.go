@@ -2,20 +2,28 @@ package handler
 
 import (
 	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
 	"github.com/hughbliss/my_protobuf/go/pkg/gen/acman"
 	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
-
 	"github.com/hughbliss/my_toolkit/reporter"
 )
 
-func NewPermissionsHandler() perserv1.PermissionsServiceServer {
+func NewPermissionsHandler(uc AccessUsecase) perserv1.PermissionsServiceServer {
 	return &PermissionsHandler{
 		rep: reporter.InitReporter("PermissionsHandler"),
+		uc:  uc,
 	}
 }
 
 type PermissionsHandler struct {
 	rep reporter.Reporter
+	uc  AccessUsecase
+}
+
+type AccessUsecase interface {
+	CheckAccess(ctx context.Context, check *dto.AccessCheck) (*dto.AccessDecision, error)
+	BatchCheckAccess(ctx context.Context, checks []*dto.AccessCheck) (dto.AccessDecisionList, error)
+	WatchPermissionChanges(ctx context.Context, resumeToken string, send func(*dto.PermissionChange) error) error
 }
 
 func (p PermissionsHandler) GetAllPermissions(ctx context.Context, request *perserv1.GetAllPermissionsRequest) (*perserv1.GetAllPermissionsResponse, error) {
@@ -26,3 +34,53 @@ func (p PermissionsHandler) GetAllPermissions(ctx context.Context, request *pers
 		Permissions: acman.Permissions,
 	}, nil
 }
+
+func (p PermissionsHandler) CheckAccess(ctx context.Context, request *perserv1.CheckAccessRequest) (*perserv1.CheckAccessResponse, error) {
+	ctx, _, end := p.rep.Start(ctx, "CheckAccess")
+	defer end()
+
+	check, err := dto.AccessCheckFromProto(request)
+	if err != nil {
+		return nil, err
+	}
+
+	decision, err := p.uc.CheckAccess(ctx, check)
+	if err != nil {
+		return nil, err
+	}
+
+	return decision.ToProto(), nil
+}
+
+func (p PermissionsHandler) BatchCheckAccess(ctx context.Context, request *perserv1.BatchCheckAccessRequest) (*perserv1.BatchCheckAccessResponse, error) {
+	ctx, _, end := p.rep.Start(ctx, "BatchCheckAccess")
+	defer end()
+
+	checks := make([]*dto.AccessCheck, len(request.GetChecks()))
+	for i, check := range request.GetChecks() {
+		var err error
+		if checks[i], err = dto.AccessCheckFromProto(check); err != nil {
+			return nil, err
+		}
+	}
+
+	decisions, err := p.uc.BatchCheckAccess(ctx, checks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &perserv1.BatchCheckAccessResponse{
+		Results: decisions.ToProto(),
+	}, nil
+}
+
+// WatchPermissionChanges держит поток уведомлений об изменениях доступов, по
+// которым клиенты сбрасывают закэшированные решения авторизации.
+func (p PermissionsHandler) WatchPermissionChanges(request *perserv1.WatchPermissionChangesRequest, stream perserv1.PermissionsService_WatchPermissionChangesServer) error {
+	ctx, _, end := p.rep.Start(stream.Context(), "WatchPermissionChanges")
+	defer end()
+
+	return p.uc.WatchPermissionChanges(ctx, request.GetResumeToken(), func(change *dto.PermissionChange) error {
+		return stream.Send(change.ToProto())
+	})
+}
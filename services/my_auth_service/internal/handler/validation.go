@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"github.com/hughbliss/my_auth_service/internal/usecase"
+	admrolserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/roles/v1"
+	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
+	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"github.com/hughbliss/my_toolkit/validate"
+)
+
+// Ограничения длины полей в символах. Пароль ограничен в байтах: bcrypt
+// учитывает только первые 72 байта.
+const (
+	emailMaxLen       = 254
+	passwordMinLen    = 8
+	passwordMaxLen    = 72
+	nameMaxLen        = 128
+	descriptionMaxLen = 512
+)
+
+// Ограничения запросов проверяются validate.UnaryServerInterceptor и
+// validate.StreamServerInterceptor до вызова обработчиков.
+func init() {
+	email := []validate.Rule{validate.Required(), validate.Email(), validate.MaxLen(emailMaxLen)}
+	id := []validate.Rule{validate.Required(), validate.XID()}
+
+	// AuthenticationService
+	validate.Register(&authnv1.SignUpRequest{}, validate.Fields{
+		"email":    email,
+		"password": {validate.Required(), validate.MinLen(passwordMinLen), validate.MaxBytes(passwordMaxLen)},
+		"name":     {validate.Required(), validate.MaxLen(nameMaxLen)},
+	})
+	validate.Register(&authnv1.SignInRequest{}, validate.Fields{
+		"email":    email,
+		"password": {validate.Required(), validate.MaxBytes(passwordMaxLen)},
+	})
+	validate.Register(&authnv1.RefreshTokenRequest{}, validate.Fields{
+		"refresh_token": {validate.Required()},
+	})
+	validate.Register(&authnv1.AuthorizeRequest{}, validate.Fields{
+		"access_token": {validate.Required()},
+	})
+
+	// AdminRolesService
+	role := validate.Fields{
+		"id":          {validate.XID()},
+		"domain_id":   id,
+		"name":        {validate.Required(), validate.MaxLen(nameMaxLen)},
+		"description": {validate.MaxLen(descriptionMaxLen)},
+	}
+	validate.Register(&admrolserv1.CreateRoleRequest{}, validate.Fields{
+		"role": {validate.Required(), validate.Nested(role)},
+	})
+	validate.Register(&admrolserv1.UpdateRoleRequest{}, validate.Fields{
+		"role": {validate.Required(), validate.Nested(validate.Fields{
+			"id":          id,
+			"domain_id":   {validate.XID()},
+			"name":        {validate.Required(), validate.MaxLen(nameMaxLen)},
+			"description": {validate.MaxLen(descriptionMaxLen)},
+		})},
+	})
+	validate.Register(&admrolserv1.DeleteRoleRequest{}, validate.Fields{
+		"role_id":             id,
+		"reassign_to_role_id": {validate.XID()},
+	})
+	validate.Register(&admrolserv1.ReconcileRolesRequest{}, validate.Fields{
+		"domains": {validate.Each(validate.Nested(validate.Fields{
+			"domain": {validate.Required()},
+			"roles": {validate.Each(validate.Nested(validate.Fields{
+				"name":        {validate.Required(), validate.MaxLen(nameMaxLen)},
+				"description": {validate.MaxLen(descriptionMaxLen)},
+			}))},
+		}))},
+	})
+
+	// AdminUsersService
+	validate.Register(&admusrserv1.CreateUserRequest{}, validate.Fields{
+		"user": {validate.Required(), validate.Nested(validate.Fields{
+			"email":             email,
+			"name":              {validate.Required(), validate.MaxLen(nameMaxLen)},
+			"current_domain_id": {validate.XID()},
+		})},
+	})
+	validate.Register(&admusrserv1.UpdateUserRequest{}, validate.Fields{
+		"user": {validate.Required(), validate.Nested(validate.Fields{
+			"id":                id,
+			"email":             email,
+			"name":              {validate.Required(), validate.MaxLen(nameMaxLen)},
+			"current_domain_id": {validate.XID()},
+		})},
+	})
+	membership := validate.Fields{
+		"user_id":   id,
+		"domain_id": id,
+		"role_id":   id,
+	}
+	validate.Register(&admusrserv1.AssignUserToDomainRequest{}, membership)
+	validate.Register(&admusrserv1.UpdateUserDomainRoleRequest{}, membership)
+	validate.Register(&admusrserv1.RemoveUserFromDomainRequest{}, validate.Fields{
+		"user_id":   id,
+		"domain_id": id,
+	})
+	user := validate.Fields{"user_id": id}
+	validate.Register(&admusrserv1.DeleteUserRequest{}, user)
+	validate.Register(&admusrserv1.DisableUserRequest{}, user)
+	validate.Register(&admusrserv1.RestoreUserRequest{}, user)
+	validate.Register(&admusrserv1.PurgeUserRequest{}, user)
+
+	// PermissionsService
+	check := validate.Fields{
+		"user_id":    {validate.XID()},
+		"domain_id":  {validate.XID()},
+		"permission": {validate.Required()},
+	}
+	validate.Register(&perserv1.CheckAccessRequest{}, check)
+	validate.Register(&perserv1.BatchCheckAccessRequest{}, validate.Fields{
+		"checks": {validate.Required(), validate.MaxItems(usecase.MaxBatchAccessChecks), validate.Each(validate.Nested(check))},
+	})
+}
@@ -0,0 +1,127 @@
+// Package migration применяет версионные миграции из каталога в формате
+// golang-migrate (<version>_<name>.up.sql и <version>_<name>.down.sql).
+// Текущая версия хранится в таблице schema_migrations той же структуры, что у
+// golang-migrate, поэтому базу можно обслуживать и его CLI.
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+)
+
+// Migration одна версия схемы.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Load читает миграции из fsys и возвращает их по возрастанию версии. Для
+// каждой версии обязателен up файл; down файл нужен только для отката.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration, len(names)/2)
+	for _, fileName := range names {
+		var base string
+		var up bool
+		switch {
+		case strings.HasSuffix(fileName, upSuffix):
+			base, up = strings.TrimSuffix(fileName, upSuffix), true
+		case strings.HasSuffix(fileName, downSuffix):
+			base = strings.TrimSuffix(fileName, downSuffix)
+		default:
+			return nil, fmt.Errorf("migration %q: expected %s or %s suffix", fileName, upSuffix, downSuffix)
+		}
+
+		rawVersion, name, _ := strings.Cut(base, "_")
+		version, err := strconv.ParseUint(rawVersion, 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("migration %q: invalid version %q", fileName, rawVersion)
+		}
+
+		content, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %q: version %d already used by %q", fileName, version, m.Name)
+		}
+		if up {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s: missing %s file", m, upSuffix)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ErrSchemaBehind база данных отстает от миграций, встроенных в бинарь.
+var ErrSchemaBehind = errors.New("database schema is behind, run `migrate up` or enable migrate.auto")
+
+// ErrUntracked в базе есть таблицы, но нет версии схемы: база создана
+// автомиграцией ent до перехода на версионные миграции.
+var ErrUntracked = errors.New("database has tables but no schema version, run `migrate baseline` first")
+
+// DirtyError предыдущая миграция завершилась ошибкой на версии Version, и
+// схему нужно исправить вручную.
+type DirtyError struct {
+	Version uint64
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("database is dirty at version %d, fix it manually", e.Version)
+}
+
+// Status состояние схемы относительно миграций.
+type Status struct {
+	Version uint64 // Version текущая версия; 0 - миграции не применялись.
+	Dirty   bool
+	Applied []*Migration
+	Pending []*Migration
+}
+
+func newStatus(migrations []*Migration, version uint64, dirty bool) *Status {
+	status := &Status{Version: version, Dirty: dirty}
+	for _, m := range migrations {
+		if m.Version <= version {
+			status.Applied = append(status.Applied, m)
+		} else {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return status
+}
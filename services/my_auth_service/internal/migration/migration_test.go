@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("миграции упорядочены по версии", func(t *testing.T) {
+		migrations, err := Load(fstest.MapFS{
+			"20250702000000_outbox.up.sql":     {Data: []byte("CREATE TABLE outbox ();")},
+			"20250702000000_outbox.down.sql":   {Data: []byte("DROP TABLE outbox;")},
+			"20250701000000_baseline.up.sql":   {Data: []byte("CREATE TABLE users ();")},
+			"20250701000000_baseline.down.sql": {Data: []byte("DROP TABLE users;")},
+		})
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, uint64(20250701000000), migrations[0].Version)
+		assert.Equal(t, "baseline", migrations[0].Name)
+		assert.Equal(t, "DROP TABLE users;", migrations[0].Down)
+		assert.Equal(t, "20250702000000_outbox", migrations[1].String())
+	})
+
+	t.Run("встроенные миграции", func(t *testing.T) {
+		list, err := Load(migrations.FS)
+		require.NoError(t, err)
+		require.NotEmpty(t, list)
+		assert.Equal(t, "20250701000000_baseline", list[0].String())
+		for _, m := range list {
+			assert.NotEmpty(t, m.Down, m.String())
+		}
+	})
+
+	t.Run("нет up файла", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"20250701000000_baseline.down.sql": {Data: []byte("DROP TABLE users;")},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("версия занята другой миграцией", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"20250701000000_first.up.sql":  {Data: []byte("SELECT 1;")},
+			"20250701000000_second.up.sql": {Data: []byte("SELECT 2;")},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("некорректное имя файла", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{
+			"baseline.up.sql": {Data: []byte("SELECT 1;")},
+		})
+		assert.Error(t, err)
+	})
+}
+
+func TestNewStatus(t *testing.T) {
+	migrations := []*Migration{{Version: 1, Up: "a"}, {Version: 2, Up: "b"}, {Version: 3, Up: "c"}}
+
+	status := newStatus(migrations, 2, false)
+	assert.Len(t, status.Applied, 2)
+	require.Len(t, status.Pending, 1)
+	assert.Equal(t, uint64(3), status.Pending[0].Version)
+
+	status = newStatus(migrations, 0, false)
+	assert.Empty(t, status.Applied)
+	assert.Len(t, status.Pending, 3)
+}
+
+// TestSchemaInSync проверяет, что миграции приводят базу к текущей ent схеме:
+// diff на dev базе не должен создавать новых файлов. Нужна пустая база
+// Postgres в MIGRATE_DEVURL, без нее тест пропускается.
+func TestSchemaInSync(t *testing.T) {
+	devURL := os.Getenv("MIGRATE_DEVURL")
+	if devURL == "" {
+		t.Skip("MIGRATE_DEVURL is not set")
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, os.DirFS(filepath.Join("..", "..", "migrations"))))
+	before, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, Diff(context.Background(), dir, "drift", devURL))
+
+	after, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, after, len(before), "ent schema differs from migrations, run `migrate diff <name>`")
+}
@@ -0,0 +1,303 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"io/fs"
+	"slices"
+)
+
+// lockID ключ pg_advisory_xact_lock, под которым применяется каждая миграция,
+// чтобы несколько реплик, стартующих одновременно, не применили ее дважды.
+const lockID = 7_211_937_466
+
+const createVersionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (version bigint NOT NULL PRIMARY KEY, dirty boolean NOT NULL)`
+
+// hasTablesQuery проверяет, есть ли в схеме таблицы кроме schema_migrations.
+const hasTablesQuery = `SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name <> 'schema_migrations')`
+
+// Migrator применяет миграции через ent клиент. Для сырых запросов клиент
+// должен быть сгенерирован с фичей sql/execquery.
+type Migrator struct {
+	db         *dbauth.Client
+	migrations []*Migration
+}
+
+func New(db *dbauth.Client, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Status возвращает текущую версию схемы и списки примененных и ожидающих миграций.
+func (m *Migrator) Status(ctx context.Context) (*Status, error) {
+	if _, err := m.db.ExecContext(ctx, createVersionTable); err != nil {
+		return nil, err
+	}
+	rows, err := m.db.QueryContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	version, dirty, err := scanVersion(rows)
+	if err != nil {
+		return nil, err
+	}
+	return newStatus(m.migrations, version, dirty), nil
+}
+
+// Up применяет до n ожидающих миграций (все при n <= 0), каждую в своей
+// транзакции, и возвращает примененные. База без версии, в которой уже есть
+// таблицы, сначала должна быть отмечена через Baseline.
+func (m *Migrator) Up(ctx context.Context, n int) ([]*Migration, error) {
+	if err := m.checkTracked(ctx); err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+	for n <= 0 || len(applied) < n {
+		migration, err := m.step(ctx, func(status *Status) (*Migration, uint64, string) {
+			if len(status.Pending) == 0 {
+				return nil, 0, ""
+			}
+			next := status.Pending[0]
+			return next, next.Version, next.Up
+		})
+		if err != nil {
+			return applied, err
+		}
+		if migration == nil {
+			break
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// Down откатывает n последних примененных миграций (одну при n <= 0) и
+// возвращает откаченные.
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	if n <= 0 {
+		n = 1
+	}
+	var reverted []*Migration
+	for len(reverted) < n {
+		migration, err := m.step(ctx, func(status *Status) (*Migration, uint64, string) {
+			if len(status.Applied) == 0 {
+				return nil, 0, ""
+			}
+			last := status.Applied[len(status.Applied)-1]
+			var previous uint64
+			if len(status.Applied) > 1 {
+				previous = status.Applied[len(status.Applied)-2].Version
+			}
+			return last, previous, last.Down
+		})
+		if err != nil {
+			return reverted, err
+		}
+		if migration == nil {
+			break
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// EnsureCurrent проверяет при старте сервиса, что схема не отстает от
+// миграций. При auto ожидающие миграции применяются, иначе возвращается
+// ErrSchemaBehind.
+func (m *Migrator) EnsureCurrent(ctx context.Context, auto bool) (*Status, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Dirty {
+		return status, &DirtyError{Version: status.Version}
+	}
+	if len(status.Pending) == 0 {
+		return status, nil
+	}
+	if err := m.checkTracked(ctx); err != nil {
+		return status, err
+	}
+	if !auto {
+		return status, ErrSchemaBehind
+	}
+	if _, err := m.Up(ctx, 0); err != nil {
+		return status, err
+	}
+	return m.Status(ctx)
+}
+
+// Baseline отмечает первую миграцию примененной, не выполняя ее. Нужна один
+// раз для базы, созданной автомиграцией ent до перехода на версионные
+// миграции: базовая миграция описывает именно эти таблицы, а следующие
+// миграции затем применяет Up.
+func (m *Migrator) Baseline(ctx context.Context) (*Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, errors.New("no migrations to baseline")
+	}
+	status, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.Version != 0 {
+		return nil, fmt.Errorf("database is already at version %d", status.Version)
+	}
+
+	baseline := m.migrations[0]
+	return baseline, m.Force(ctx, baseline.Version)
+}
+
+// Force записывает версию схемы и снимает отметку dirty, не выполняя
+// миграций, как force в golang-migrate. Версия 0 - миграции не применялись.
+func (m *Migrator) Force(ctx context.Context, version uint64) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration *Migration) bool {
+		return migration.Version == version
+	}) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	_, err := m.inTx(ctx, func(tx *dbauth.Tx) (*Migration, error) {
+		if err := lock(ctx, tx); err != nil {
+			return nil, err
+		}
+		return nil, writeVersion(ctx, tx, version)
+	})
+	return err
+}
+
+// checkTracked возвращает ErrUntracked, если версии схемы нет, а таблицы уже
+// есть: без Baseline базовая миграция попыталась бы создать их повторно.
+func (m *Migrator) checkTracked(ctx context.Context) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Version != 0 {
+		return nil
+	}
+
+	rows, err := m.db.QueryContext(ctx, hasTablesQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var hasTables bool
+	if rows.Next() {
+		if err := rows.Scan(&hasTables); err != nil {
+			return err
+		}
+	}
+	if err := errors.Join(rows.Err(), rows.Close()); err != nil {
+		return err
+	}
+	if hasTables {
+		return ErrUntracked
+	}
+	return nil
+}
+
+// step под блокировкой перечитывает версию схемы, выбирает через pick миграцию,
+// целевую версию и SQL, выполняет его и записывает новую версию в той же
+// транзакции. Возвращает nil, если pick ничего не выбрал.
+func (m *Migrator) step(ctx context.Context, pick func(*Status) (*Migration, uint64, string)) (*Migration, error) {
+	return m.inTx(ctx, func(tx *dbauth.Tx) (*Migration, error) {
+		return m.stepTx(ctx, tx, pick)
+	})
+}
+
+// inTx выполняет fn в транзакции, создав таблицу версий при необходимости.
+func (m *Migrator) inTx(ctx context.Context, fn func(tx *dbauth.Tx) (*Migration, error)) (*Migration, error) {
+	if _, err := m.db.ExecContext(ctx, createVersionTable); err != nil {
+		return nil, err
+	}
+
+	tx, err := m.db.Tx(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migration, err := fn(tx)
+	if err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			err = fmt.Errorf("%w: rolling back migration: %v", err, rerr)
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+func (m *Migrator) stepTx(ctx context.Context, tx *dbauth.Tx, pick func(*Status) (*Migration, uint64, string)) (*Migration, error) {
+	if err := lock(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err != nil {
+		return nil, err
+	}
+	version, dirty, err := scanVersion(rows)
+	if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, &DirtyError{Version: version}
+	}
+
+	migration, target, script := pick(newStatus(m.migrations, version, dirty))
+	if migration == nil {
+		return nil, nil
+	}
+	if script == "" {
+		return nil, fmt.Errorf("migration %s: missing %s file", migration, downSuffix)
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return nil, fmt.Errorf("migration %s: %w", migration, err)
+	}
+	if err := writeVersion(ctx, tx, target); err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+func lock(ctx context.Context, tx *dbauth.Tx) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, lockID)
+	return err
+}
+
+// writeVersion заменяет версию схемы на version; 0 очищает таблицу версий.
+func writeVersion(ctx context.Context, tx *dbauth.Tx, version uint64) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version)
+	return err
+}
+
+func scanVersion(rows *sql.Rows) (version uint64, dirty bool, err error) {
+	defer rows.Close()
+	if rows.Next() {
+		var v int64
+		if err := rows.Scan(&v, &dirty); err != nil {
+			return 0, false, err
+		}
+		version = uint64(v)
+	}
+	return version, dirty, errors.Join(rows.Err(), rows.Close())
+}
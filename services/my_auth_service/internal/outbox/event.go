@@ -0,0 +1,113 @@
+// Package outbox реализует transactional outbox: события об изменении
+// пользователей и ролей записываются в таблицу outbox_events в той же
+// транзакции, что и само изменение, а Relay публикует их через Publisher в
+// формате CloudEvents с гарантией доставки at-least-once.
+package outbox
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Типы событий. Потребители должны быть идемпотентны: при сбое между
+// публикацией и отметкой в outbox событие будет опубликовано повторно.
+const (
+	UserCreated  = "auth.user.created"
+	UserUpdated  = "auth.user.updated"
+	UserDisabled = "auth.user.disabled"
+	UserDeleted  = "auth.user.deleted"
+	UserRestored = "auth.user.restored"
+	UserPurged   = "auth.user.purged"
+
+	MembershipAssigned = "auth.user.domain.assigned"
+	MembershipRemoved  = "auth.user.domain.removed"
+	MembershipChanged  = "auth.user.domain.role_changed"
+
+	RoleCreated = "auth.role.created"
+	RoleUpdated = "auth.role.updated"
+	RoleDeleted = "auth.role.deleted"
+)
+
+// Source источник событий в терминах CloudEvents.
+const Source = "urn:my_auth_service"
+
+const specVersion = "1.0"
+
+// Event событие outbox. Data содержит JSON одной из структур *Data этого пакета.
+type Event struct {
+	ID      string
+	Type    string
+	Source  string
+	Subject string // Subject идентификатор пользователя или роли.
+	Time    time.Time
+	Data    json.RawMessage
+}
+
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data,omitempty"`
+}
+
+// MarshalJSON кодирует событие в структурированный режим CloudEvents 1.0.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cloudEvent{
+		SpecVersion:     specVersion,
+		ID:              e.ID,
+		Source:          e.Source,
+		Type:            e.Type,
+		Subject:         e.Subject,
+		Time:            e.Time.UTC(),
+		DataContentType: "application/json",
+		Data:            e.Data,
+	})
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var ce cloudEvent
+	if err := json.Unmarshal(data, &ce); err != nil {
+		return err
+	}
+	*e = Event{
+		ID:      ce.ID,
+		Type:    ce.Type,
+		Source:  ce.Source,
+		Subject: ce.Subject,
+		Time:    ce.Time,
+		Data:    ce.Data,
+	}
+	return nil
+}
+
+// UserData данные событий auth.user.*.
+type UserData struct {
+	UserID string `json:"user_id"`
+	Email  string `json:"email"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// MembershipData данные событий auth.user.domain.*. PreviousRoleID заполнен
+// только при смене роли.
+type MembershipData struct {
+	UserID         string `json:"user_id"`
+	DomainID       string `json:"domain_id"`
+	RoleID         string `json:"role_id,omitempty"`
+	PreviousRoleID string `json:"previous_role_id,omitempty"`
+}
+
+// RoleData данные событий auth.role.*. ReassignedTo заполнен при удалении
+// роли с переназначением пользователей.
+type RoleData struct {
+	RoleID       string   `json:"role_id"`
+	DomainID     string   `json:"domain_id"`
+	Name         string   `json:"name"`
+	Permissions  []string `json:"permissions"`
+	Version      int      `json:"version"`
+	ReassignedTo string   `json:"reassigned_to,omitempty"`
+}
@@ -0,0 +1,73 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+)
+
+// Publisher доставляет событие брокеру. Ошибка означает, что событие не
+// доставлено, и Relay повторит его позже.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// MemoryBroker брокер в памяти процесса для тестов и локального запуска.
+// Publish блокируется, пока каждый подписчик не примет событие, поэтому
+// события не теряются, а медленный подписчик замедляет Relay.
+type MemoryBroker struct {
+	mu          sync.RWMutex
+	subscribers map[*subscription]struct{}
+	buffer      int
+}
+
+type subscription struct {
+	events chan Event
+	done   chan struct{}
+}
+
+func NewMemoryBroker(buffer int) *MemoryBroker {
+	return &MemoryBroker{
+		subscribers: map[*subscription]struct{}{},
+		buffer:      buffer,
+	}
+}
+
+// Subscribe возвращает канал событий и функцию отписки, после вызова которой
+// канал закрывается.
+func (b *MemoryBroker) Subscribe() (<-chan Event, func()) {
+	sub := &subscription{
+		events: make(chan Event, b.buffer),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			// Сначала освобождаем Publish, ожидающий этого подписчика.
+			close(sub.done)
+			b.mu.Lock()
+			delete(b.subscribers, sub)
+			b.mu.Unlock()
+			close(sub.events)
+		})
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subscribers {
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package outbox
+
+import (
+	"context"
+	"entgo.io/ent/dialect/sql"
+	"fmt"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entOutbox "github.com/hughbliss/my_database/pkg/gen/dbauth/outboxevent"
+	"github.com/hughbliss/my_toolkit/reporter"
+	"time"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultInterval    = time.Second
+	defaultRetention   = 7 * 24 * time.Hour
+	defaultMaxAttempts = 10
+)
+
+// Relay переносит события из outbox в Publisher. Событие отмечается
+// опубликованным только после успешного Publish, поэтому при сбое оно будет
+// опубликовано повторно (at-least-once). События публикуются по порядку
+// записи; на первой ошибке пакет прерывается, чтобы не нарушать порядок.
+//
+// Событие, которое не удалось опубликовать maxAttempts раз, откладывается в
+// dead letter (dead_lettered_at) и больше не задерживает следующие события.
+// Такие события не удаляются по retention и ждут разбора вручную.
+type Relay struct {
+	rep         reporter.Reporter
+	db          *dbauth.Client
+	publisher   Publisher
+	batchSize   int
+	interval    time.Duration
+	retention   time.Duration
+	maxAttempts int
+	rowLocks    bool
+}
+
+type Option func(*Relay)
+
+// WithBatchSize задает число событий, публикуемых за одну транзакцию.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		if n > 0 {
+			r.batchSize = n
+		}
+	}
+}
+
+// WithInterval задает паузу между опросами outbox, когда новых событий нет.
+func WithInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		if d > 0 {
+			r.interval = d
+		}
+	}
+}
+
+// WithRetention задает, сколько хранить опубликованные события; 0 - не удалять.
+func WithRetention(d time.Duration) Option {
+	return func(r *Relay) {
+		r.retention = d
+	}
+}
+
+// WithMaxAttempts задает число попыток публикации события, после которого оно
+// откладывается в dead letter.
+func WithMaxAttempts(n int) Option {
+	return func(r *Relay) {
+		if n > 0 {
+			r.maxAttempts = n
+		}
+	}
+}
+
+// WithoutRowLocks отключает SELECT ... FOR UPDATE SKIP LOCKED для баз данных,
+// которые его не поддерживают (SQLite в тестах). Без блокировок несколько
+// реплик могут опубликовать одно событие дважды.
+func WithoutRowLocks() Option {
+	return func(r *Relay) {
+		r.rowLocks = false
+	}
+}
+
+func NewRelay(db *dbauth.Client, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		rep:         reporter.InitReporter("OutboxRelay"),
+		db:          db,
+		publisher:   publisher,
+		batchSize:   defaultBatchSize,
+		interval:    defaultInterval,
+		retention:   defaultRetention,
+		maxAttempts: defaultMaxAttempts,
+		rowLocks:    true,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run публикует события до отмены ctx. Пока в outbox есть события, пакеты
+// обрабатываются без пауз.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := r.RelayOnce(ctx)
+		if err == nil && published == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce публикует один пакет событий и возвращает число опубликованных.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	ctx, log, end := r.rep.Start(ctx, "RelayOnce")
+	defer end()
+
+	tx, err := r.db.Tx(ctx)
+	if err != nil {
+		log.Err(err).Stack().Msg("failed to begin outbox transaction")
+		return 0, err
+	}
+
+	published, dead, failed, err := r.relay(ctx, tx)
+	if err != nil {
+		log.Err(err).Stack().Msg("failed to relay outbox events")
+		if rerr := tx.Rollback(); rerr != nil {
+			err = fmt.Errorf("%w: rolling back transaction: %v", err, rerr)
+		}
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Err(err).Stack().Msg("failed to commit outbox transaction")
+		return 0, err
+	}
+	for _, event := range dead {
+		log.Error().
+			Str("event_id", event.EventID).
+			Str("type", event.Type).
+			Int("attempts", event.Attempts+1).
+			Str("last_error", event.LastError).
+			Msg("outbox event moved to dead letter")
+	}
+	if failed != nil {
+		log.Warn().Err(failed).Int("published", published).Msg("failed to publish outbox event, will retry")
+	}
+
+	if r.retention > 0 {
+		if _, err := r.db.OutboxEvent.Delete().
+			Where(entOutbox.PublishedAtLT(time.Now().Add(-r.retention))).
+			Exec(ctx); err != nil {
+			log.Warn().Err(err).Msg("failed to delete published outbox events")
+		}
+	}
+
+	return published, nil
+}
+
+// relay публикует пакет в транзакции tx. dead - события, отложенные в dead
+// letter; failed - ошибка Publisher, на которой пакет прерван; err - ошибка
+// базы данных, при которой транзакция откатывается.
+func (r *Relay) relay(ctx context.Context, tx *dbauth.Tx) (published int, dead []*dbauth.OutboxEvent, failed error, err error) {
+	query := tx.OutboxEvent.Query().
+		Where(entOutbox.PublishedAtIsNil(), entOutbox.DeadLetteredAtIsNil()).
+		Order(entOutbox.ByID()).
+		Limit(r.batchSize)
+	if r.rowLocks {
+		query = query.ForUpdate(sql.WithLockAction(sql.SkipLocked))
+	}
+
+	rows, err := query.All(ctx)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	for _, row := range rows {
+		event := Event{
+			ID:      row.EventID,
+			Type:    row.Type,
+			Source:  row.Source,
+			Subject: row.Subject,
+			Time:    row.Time,
+			Data:    row.Data,
+		}
+
+		if failed = r.publisher.Publish(ctx, event); failed != nil {
+			update := tx.OutboxEvent.UpdateOne(row).
+				AddAttempts(1).
+				SetLastError(failed.Error())
+			if row.Attempts+1 < r.maxAttempts {
+				// Ошибку публикации сохраняем, а уже опубликованные события пакета фиксируем.
+				return published, dead, failed, update.Exec(ctx)
+			}
+
+			if err := update.SetDeadLetteredAt(time.Now()).Exec(ctx); err != nil {
+				return published, nil, nil, err
+			}
+			row.LastError = failed.Error()
+			dead = append(dead, row)
+			failed = nil
+			continue
+		}
+
+		if err := tx.OutboxEvent.UpdateOne(row).
+			SetPublishedAt(time.Now()).
+			AddAttempts(1).
+			Exec(ctx); err != nil {
+			return published, nil, nil, err
+		}
+		published++
+	}
+	return published, dead, nil, nil
+}
@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/hughbliss/my_database/pkg/dbauthclient"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entOutbox "github.com/hughbliss/my_database/pkg/gen/dbauth/outboxevent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// flakyPublisher отклоняет первые failures событий, остальные передает дальше.
+type flakyPublisher struct {
+	failures int
+	next     Publisher
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, event Event) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	return p.next.Publish(ctx, event)
+}
+
+func writeEvents(t *testing.T, ctx context.Context, client *dbauth.Client, subjects ...string) {
+	tx, err := client.Tx(ctx)
+	require.NoError(t, err)
+	for _, subject := range subjects {
+		require.NoError(t, Write(ctx, tx, UserCreated, subject, UserData{UserID: subject}))
+	}
+	require.NoError(t, tx.Commit())
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	client := dbauthclient.Mock(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	broker := NewMemoryBroker(10)
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	publisher := &flakyPublisher{next: broker}
+	relay := NewRelay(client, publisher, WithoutRowLocks(), WithBatchSize(10))
+
+	writeEvents(t, ctx, client, "first", "second")
+
+	t.Run("ошибка брокера оставляет события в outbox", func(t *testing.T) {
+		publisher.failures = 1
+		published, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, published)
+
+		row, err := client.OutboxEvent.Query().Order(entOutbox.ByID()).First(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, row.PublishedAt)
+		assert.Equal(t, 1, row.Attempts)
+		assert.NotEmpty(t, row.LastError)
+	})
+
+	t.Run("события публикуются по порядку", func(t *testing.T) {
+		published, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, published)
+
+		first, second := <-events, <-events
+		assert.Equal(t, "first", first.Subject)
+		assert.Equal(t, "second", second.Subject)
+		assert.Equal(t, UserCreated, first.Type)
+
+		pending, err := client.OutboxEvent.Query().Where(entOutbox.PublishedAtIsNil()).Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, pending)
+	})
+
+	t.Run("опубликованные события не повторяются", func(t *testing.T) {
+		published, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, published)
+	})
+}
+
+func TestRelay_DeadLetter(t *testing.T) {
+	client := dbauthclient.Mock(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	broker := NewMemoryBroker(10)
+	events, unsubscribe := broker.Subscribe()
+	defer unsubscribe()
+
+	publisher := &flakyPublisher{next: broker}
+	relay := NewRelay(client, publisher, WithoutRowLocks(), WithBatchSize(10), WithMaxAttempts(2))
+
+	writeEvents(t, ctx, client, "poison", "next")
+
+	publisher.failures = 1
+	published, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+
+	// Вторая неудачная попытка исчерпывает лимит: событие уходит в dead letter,
+	// а следующее за ним публикуется в том же пакете.
+	publisher.failures = 1
+	published, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, "next", (<-events).Subject)
+
+	poison, err := client.OutboxEvent.Query().Where(entOutbox.Subject("poison")).Only(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, poison.PublishedAt)
+	assert.NotNil(t, poison.DeadLetteredAt)
+	assert.Equal(t, 2, poison.Attempts)
+
+	// Отложенное событие больше не выбирается.
+	published, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+}
+
+func TestEvent_MarshalJSON(t *testing.T) {
+	client := dbauthclient.Mock(t)
+	defer client.Close()
+	ctx := context.Background()
+
+	writeEvents(t, ctx, client, "user")
+	row, err := client.OutboxEvent.Query().Only(ctx)
+	require.NoError(t, err)
+
+	content, err := json.Marshal(Event{
+		ID:      row.EventID,
+		Type:    row.Type,
+		Source:  row.Source,
+		Subject: row.Subject,
+		Time:    row.Time,
+		Data:    row.Data,
+	})
+	require.NoError(t, err)
+
+	var envelope map[string]any
+	require.NoError(t, json.Unmarshal(content, &envelope))
+	assert.Equal(t, "1.0", envelope["specversion"])
+	assert.Equal(t, Source, envelope["source"])
+	assert.Equal(t, "application/json", envelope["datacontenttype"])
+	assert.Equal(t, map[string]any{"user_id": "user", "email": "", "name": "", "status": ""}, envelope["data"])
+
+	var decoded Event
+	require.NoError(t, json.Unmarshal(content, &decoded))
+	assert.Equal(t, row.EventID, decoded.ID)
+	assert.JSONEq(t, string(row.Data), string(decoded.Data))
+}
@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/rs/xid"
+	"time"
+)
+
+// Write добавляет событие в outbox в транзакции tx. Вызывается в той же
+// транзакции, что и изменение, поэтому событие сохраняется тогда и только
+// тогда, когда сохраняется изменение.
+func Write(ctx context.Context, tx *dbauth.Tx, eventType, subject string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return tx.OutboxEvent.Create().
+		SetEventID(xid.New().String()).
+		SetType(eventType).
+		SetSource(Source).
+		SetSubject(subject).
+		SetTime(time.Now()).
+		SetData(payload).
+		Exec(ctx)
+}
+
+// User собирает UserData из пользователя.
+func User(u *dbauth.User) UserData {
+	return UserData{
+		UserID: u.ID.String(),
+		Email:  u.Email,
+		Name:   u.Name,
+		Status: string(u.Status),
+	}
+}
+
+// Role собирает RoleData из роли.
+func Role(r *dbauth.Role) RoleData {
+	return RoleData{
+		RoleID:      r.ID.String(),
+		DomainID:    r.DomainID.String(),
+		Name:        r.Name,
+		Permissions: r.Permissions,
+		Version:     r.Version,
+	}
+}
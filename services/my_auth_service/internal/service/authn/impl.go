@@ -6,9 +6,12 @@ import (
 	"github.com/hughbliss/my_database/pkg/gen/dbauth"
 	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
 	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/hughbliss/my_toolkit/reload"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
 
 	"time"
 )
@@ -34,13 +37,22 @@ const (
 	InvalidToken         fault.Code = "InvalidToken"         // InvalidToken: "не валидный токен"
 	UserNotFound         fault.Code = "UserNotFound"         // UserNotFound: "пользователь не найден"
 	DomainNotFound       fault.Code = "DomainNotFound"       // DomainNotFound: "Домен по умолчанию не найден"
+	UserDisabled         fault.Code = "UserDisabled"         // UserDisabled: "учетная запись пользователя заблокирована"
+	UserDeleted          fault.Code = "UserDeleted"          // UserDeleted: "учетная запись пользователя удалена"
 )
 
+func init() {
+	faultstatus.Register(codes.Unauthenticated, WrongEmailOrPassword, InvalidToken)
+	faultstatus.Register(codes.AlreadyExists, UserAlreadyExists)
+	faultstatus.Register(codes.NotFound, UserNotFound, DomainNotFound)
+	faultstatus.Register(codes.PermissionDenied, UserDisabled, UserDeleted)
+}
+
 var (
 	cfgGroup             = zfg.NewGroup("auth")
 	secret               = zfg.Str("secret", "", "AUTH_SECRET", zfg.Required(), zfg.Secret(), zfg.Group(cfgGroup))
-	refreshTokenLifetime = zfg.Dur("refresh_token_lifetime", 14*24*time.Hour, "AUTH_REFRESHTOKENLIFETIME", zfg.Group(cfgGroup))
-	accessTokenLifetime  = zfg.Dur("access_token_lifetime", 15*time.Minute, "AUTH_ACCESSTOKENLIFETIME", zfg.Group(cfgGroup))
+	refreshTokenLifetime = reload.Dur("auth.refresh_token_lifetime", zfg.Dur("refresh_token_lifetime", 14*24*time.Hour, "AUTH_REFRESHTOKENLIFETIME", zfg.Group(cfgGroup)))
+	accessTokenLifetime  = reload.Dur("auth.access_token_lifetime", zfg.Dur("access_token_lifetime", 15*time.Minute, "AUTH_ACCESSTOKENLIFETIME", zfg.Group(cfgGroup)))
 )
 
 func (i impl) SignUp(ctx context.Context, request *SignUp) (*TokenPair, error) {
@@ -58,7 +70,7 @@ func (i impl) SignUp(ctx context.Context, request *SignUp) (*TokenPair, error) {
 	}
 
 	// Хэшируем пароль
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	hashedPassword, err := i.hashPassword(ctx, request.Password)
 	if err != nil {
 		log.Error().Err(err).Stack().Msg("failed to hash password")
 		return nil, err
@@ -85,9 +97,10 @@ func (i impl) SignUp(ctx context.Context, request *SignUp) (*TokenPair, error) {
 	return i.generateTokenPair(ctx, user)
 }
 
-func (i impl) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair, error) {
+func (i impl) RefreshToken(ctx context.Context, refreshToken string) (_ *TokenPair, err error) {
 	ctx, log, end := i.rep.Start(ctx, "RefreshToken")
 	defer end()
+	defer func() { recordResult(ctx, tokenRefreshes, err) }()
 
 	// Парсим refresh token
 	token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (interface{}, error) {
@@ -131,6 +144,10 @@ func (i impl) RefreshToken(ctx context.Context, refreshToken string) (*TokenPair
 		return nil, UserDBErr.Err()
 	}
 
+	if err := checkStatus(user); err != nil {
+		return nil, err
+	}
+
 	return i.generateTokenPair(ctx, user)
 }
 
@@ -182,6 +199,10 @@ func (i impl) Authorize(ctx context.Context, accessToken string) (*UserMeta, err
 		return nil, UserDBErr.Err()
 	}
 
+	if err := checkStatus(user); err != nil {
+		return nil, err
+	}
+
 	// Собираем permissions из роли
 	var permissions []string
 	var roleID xid.ID
@@ -202,9 +223,10 @@ func (i impl) Authorize(ctx context.Context, accessToken string) (*UserMeta, err
 	}, nil
 }
 
-func (i impl) SignIn(ctx context.Context, request *SignIn) (*TokenPair, error) {
+func (i impl) SignIn(ctx context.Context, request *SignIn) (_ *TokenPair, err error) {
 	ctx, log, end := i.rep.Start(ctx, "SignIn")
 	defer end()
+	defer func() { recordResult(ctx, signIns, err) }()
 
 	user, err := i.db.User.Query().WithUserDomain(func(query *dbauth.UserDomainQuery) {
 		query.WithDomain().WithRole()
@@ -217,15 +239,36 @@ func (i impl) SignIn(ctx context.Context, request *SignIn) (*TokenPair, error) {
 		return nil, UserDBErr.Err()
 	}
 
-	if err := i.verifyPassword(user.PasswordHash, request.Password); err != nil {
+	if err := i.verifyPassword(ctx, user.PasswordHash, request.Password); err != nil {
 		return nil, WrongEmailOrPassword.Err()
 	}
 
+	if err := checkStatus(user); err != nil {
+		return nil, err
+	}
+
 	return i.generateTokenPair(ctx, user)
 
 }
 
-func (i impl) verifyPassword(hashedPassword, password string) error {
+// checkStatus отклоняет заблокированных и удаленных пользователей.
+func checkStatus(user *dbauth.User) error {
+	switch user.Status {
+	case entUser.StatusDisabled:
+		return UserDisabled.Err()
+	case entUser.StatusDeleted:
+		return UserDeleted.Err()
+	}
+	return nil
+}
+
+func (i impl) hashPassword(ctx context.Context, password string) ([]byte, error) {
+	defer recordBcrypt(ctx, bcryptHash, time.Now())
+	return bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+}
+
+func (i impl) verifyPassword(ctx context.Context, hashedPassword, password string) error {
+	defer recordBcrypt(ctx, bcryptCompare, time.Now())
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
 func (i impl) generateTokenPair(ctx context.Context, user *dbauth.User) (*TokenPair, error) {
@@ -237,14 +280,14 @@ func (i impl) generateTokenPair(ctx context.Context, user *dbauth.User) (*TokenP
 	accessClaims := jwt.MapClaims{
 		"user_id":    user.ID.String(),
 		"email":      user.Email,
-		"exp":        now.Add(*accessTokenLifetime).Unix(), // access token живет 15 минут
+		"exp":        now.Add(accessTokenLifetime.Get()).Unix(),
 		"iat":        now.Unix(),
 		"token_type": "access",
 	}
 
 	refreshClaims := jwt.MapClaims{
 		"user_id":    user.ID.String(),
-		"exp":        now.Add(*refreshTokenLifetime).Unix(),
+		"exp":        now.Add(refreshTokenLifetime.Get()).Unix(),
 		"iat":        now.Unix(),
 		"token_type": "refresh",
 	}
@@ -0,0 +1,50 @@
+package authn
+
+import (
+	"context"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/hughbliss/my_toolkit/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"time"
+)
+
+var (
+	meter          = metrics.Meter("github.com/hughbliss/my_auth_service/authn")
+	signIns        = metrics.Counter(meter, "auth.sign_ins", "Sign-in attempts by result and failure reason")
+	tokenRefreshes = metrics.Counter(meter, "auth.token_refreshes", "Token refreshes by result and failure reason")
+	bcryptDuration = metrics.DurationHistogram(meter, "auth.bcrypt.duration", "Duration of bcrypt password hashing and comparison")
+)
+
+// Операции bcrypt для метки operation.
+const (
+	bcryptHash    = "hash"
+	bcryptCompare = "compare"
+)
+
+// recordResult увеличивает counter с результатом операции. Причина неудачи -
+// код fault ошибки, прочие ошибки учитываются как fault.UnhandledError.
+func recordResult(ctx context.Context, counter metric.Int64Counter, err error) {
+	if err == nil {
+		counter.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("result", "success"),
+		))
+		return
+	}
+
+	reason, ok := faultstatus.FaultCode(err)
+	if !ok {
+		reason = fault.UnhandledError
+	}
+	counter.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("result", "failure"),
+		attribute.String("reason", string(reason)),
+	))
+}
+
+func recordBcrypt(ctx context.Context, operation string, start time.Time) {
+	bcryptDuration.Record(ctx, metrics.Since(start), metric.WithAttributes(
+		attribute.String("operation", operation),
+	))
+}
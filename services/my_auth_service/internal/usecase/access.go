@@ -0,0 +1,155 @@
+package usecase
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/service/authn"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/hughbliss/my_toolkit/permission"
+	"github.com/hughbliss/my_toolkit/reporter"
+	"google.golang.org/grpc/codes"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	AccessCheckDBErr      fault.Code = "AccessCheckDBErr"      // AccessCheckDBErr: "ошибка проверки доступа в базе данных"
+	InvalidAccessCheckErr fault.Code = "InvalidAccessCheckErr" // InvalidAccessCheckErr: "некорректный запрос проверки доступа"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidAccessCheckErr)
+}
+
+// MaxBatchAccessChecks максимальное число проверок в одном BatchCheckAccess.
+const MaxBatchAccessChecks = 100
+
+func NewAccessUsecase(db *dbauth.Client, authnService authn.AuthenticationService) *AccessUsecase {
+	return &AccessUsecase{
+		rep:   reporter.InitReporter("AccessUsecase"),
+		db:    db,
+		authn: authnService,
+		watch: defaultWatchOptions,
+	}
+}
+
+type AccessUsecase struct {
+	rep   reporter.Reporter
+	db    *dbauth.Client
+	authn authn.AuthenticationService
+	watch watchOptions
+}
+
+// CheckAccess отвечает, выдан ли пользователю доступ check.Permission в домене
+// check.DomainID. Отказ возвращается решением с причиной, ошибка - только
+// при некорректном запросе или сбое базы данных.
+func (a AccessUsecase) CheckAccess(ctx context.Context, check *dto.AccessCheck) (*dto.AccessDecision, error) {
+	decision, err := a.decide(ctx, check)
+	if err == nil && !decision.Allowed {
+		recordDenial(ctx, check, decision)
+	}
+	return decision, err
+}
+
+func (a AccessUsecase) decide(ctx context.Context, check *dto.AccessCheck) (*dto.AccessDecision, error) {
+	ctx, log, end := a.rep.Start(ctx, "CheckAccess")
+	defer end()
+
+	if check.Permission == "" || permission.IsPattern(check.Permission) ||
+		(check.UserID.IsNil() && check.AccessToken == "") {
+		log.Warn().Msg("invalid access check")
+		return nil, InvalidAccessCheckErr.Err()
+	}
+
+	decision := &dto.AccessDecision{UserID: check.UserID}
+
+	if check.AccessToken != "" {
+		meta, err := a.authn.Authorize(ctx, check.AccessToken)
+		if err != nil {
+			log.Debug().Err(err).Msg("access token rejected")
+			decision.Reason = dto.AccessInvalidToken
+			return decision, nil
+		}
+		decision.UserID = meta.UserId
+	}
+
+	if !knownPermission(check.Permission) {
+		decision.Reason = dto.AccessUnknownPermission
+		return decision, nil
+	}
+
+	user, err := a.db.User.Query().
+		Where(entUser.ID(decision.UserID)).
+		WithUserDomain(func(query *dbauth.UserDomainQuery) {
+			query.WithRole()
+		}).
+		Only(ctx)
+	if err != nil {
+		if dbauth.IsNotFound(err) {
+			decision.Reason = dto.AccessUserNotFound
+			return decision, nil
+		}
+		log.Err(err).Stack().Msg("failed to query user")
+		return nil, AccessCheckDBErr.Err()
+	}
+
+	if user.Status != entUser.StatusActive {
+		decision.Reason = dto.AccessUserInactive
+		return decision, nil
+	}
+
+	decision.DomainID = check.DomainID
+	if decision.DomainID.IsNil() {
+		decision.DomainID = user.CurrentDomainID
+	}
+
+	if resourceDomain, ok := check.Resource[dto.ResourceDomainAttr]; ok && resourceDomain != decision.DomainID.String() {
+		decision.Reason = dto.AccessResourceDomainMismatch
+		return decision, nil
+	}
+
+	for _, membership := range user.Edges.UserDomain {
+		if membership.DomainID != decision.DomainID {
+			continue
+		}
+		decision.RoleID = membership.RoleID
+		if permission.Any(membership.Edges.Role.Permissions, check.Permission) {
+			decision.Allowed = true
+			decision.Reason = dto.AccessGranted
+		} else {
+			decision.Reason = dto.AccessPermissionMissing
+		}
+		return decision, nil
+	}
+
+	decision.Reason = dto.AccessNotAMember
+	return decision, nil
+}
+
+// BatchCheckAccess выполняет CheckAccess для каждой проверки и возвращает
+// решения в том же порядке. Некорректная проверка отклоняет весь пакет.
+func (a AccessUsecase) BatchCheckAccess(ctx context.Context, checks []*dto.AccessCheck) (dto.AccessDecisionList, error) {
+	ctx, log, end := a.rep.Start(ctx, "BatchCheckAccess")
+	defer end()
+
+	if len(checks) == 0 || len(checks) > MaxBatchAccessChecks {
+		log.Warn().Int("checks", len(checks)).Msg("invalid batch size")
+		return nil, InvalidAccessCheckErr.Err()
+	}
+
+	decisions := make(dto.AccessDecisionList, len(checks))
+	for i, check := range checks {
+		decision, err := a.CheckAccess(ctx, check)
+		if err != nil {
+			return nil, err
+		}
+		decisions[i] = decision
+	}
+	return decisions, nil
+}
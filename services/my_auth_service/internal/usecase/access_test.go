@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/service/authn"
+	"github.com/hughbliss/my_database/pkg/dbauthclient"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/reporter"
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+// tokenAuthn заглушка AuthenticationService, принимающая единственный токен.
+type tokenAuthn struct {
+	authn.AuthenticationService
+	token  string
+	userID xid.ID
+}
+
+func (s tokenAuthn) Authorize(_ context.Context, accessToken string) (*authn.UserMeta, error) {
+	if accessToken != s.token {
+		return nil, authn.InvalidToken.Err()
+	}
+	return &authn.UserMeta{UserId: s.userID}, nil
+}
+
+func setupAccessTest(t *testing.T) (*AccessUsecase, *dbauth.Client, context.Context) {
+	client := dbauthclient.Mock(t)
+	usecase := &AccessUsecase{
+		rep: reporter.InitReporter("test"),
+		db:  client,
+		watch: watchOptions{
+			poll:      10 * time.Millisecond,
+			heartbeat: time.Hour,
+			batch:     2,
+			horizon: func(context.Context, *dbauth.Client) (int64, error) {
+				return math.MaxInt64, nil
+			},
+		},
+	}
+	return usecase, client, context.Background()
+}
+
+func TestAccessUsecase_CheckAccess(t *testing.T) {
+	usecase, client, ctx := setupAccessTest(t)
+	defer client.Close()
+
+	permissions := catalogPermissions(t, 2)
+	granted, missing := permissions[0], permissions[1]
+
+	domain := createTestDomain(t, ctx, client)
+	role, err := client.Role.Create().
+		SetName("Reader").
+		SetDescription("Reader").
+		SetPermissions([]string{granted}).
+		SetDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+	user, err := client.User.Create().
+		SetName("TestUser").
+		SetEmail("access@example.com").
+		SetPasswordHash("hash").
+		SetCurrentDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+	_, err = client.UserDomain.Create().
+		SetUserID(user.ID).
+		SetDomainID(domain.ID).
+		SetRoleID(role.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	otherDomain, err := client.Domain.Create().SetName("OtherDomain").Save(ctx)
+	require.NoError(t, err)
+
+	usecase.authn = tokenAuthn{token: "valid", userID: user.ID}
+
+	cases := []struct {
+		name    string
+		check   *dto.AccessCheck
+		allowed bool
+		reason  string
+	}{
+		{"доступ выдан", &dto.AccessCheck{UserID: user.ID, Permission: granted}, true, dto.AccessGranted},
+		{"доступ по токену", &dto.AccessCheck{AccessToken: "valid", Permission: granted}, true, dto.AccessGranted},
+		{"невалидный токен", &dto.AccessCheck{AccessToken: "invalid", Permission: granted}, false, dto.AccessInvalidToken},
+		{"доступ не выдан", &dto.AccessCheck{UserID: user.ID, Permission: missing}, false, dto.AccessPermissionMissing},
+		{"неизвестный доступ", &dto.AccessCheck{UserID: user.ID, Permission: "perm.unknown"}, false, dto.AccessUnknownPermission},
+		{"пользователь не найден", &dto.AccessCheck{UserID: xid.New(), Permission: granted}, false, dto.AccessUserNotFound},
+		{"не состоит в домене", &dto.AccessCheck{UserID: user.ID, Permission: granted, DomainID: otherDomain.ID}, false, dto.AccessNotAMember},
+		{
+			"ресурс другого домена",
+			&dto.AccessCheck{UserID: user.ID, Permission: granted, Resource: map[string]string{dto.ResourceDomainAttr: otherDomain.ID.String()}},
+			false, dto.AccessResourceDomainMismatch,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			decision, err := usecase.CheckAccess(ctx, c.check)
+			require.NoError(t, err)
+			assert.Equal(t, c.allowed, decision.Allowed)
+			assert.Equal(t, c.reason, decision.Reason)
+		})
+	}
+
+	t.Run("некорректный запрос", func(t *testing.T) {
+		_, err := usecase.CheckAccess(ctx, &dto.AccessCheck{Permission: granted})
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), InvalidAccessCheckErr.Err().Error())
+
+		_, err = usecase.CheckAccess(ctx, &dto.AccessCheck{UserID: user.ID, Permission: "*"})
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), InvalidAccessCheckErr.Err().Error())
+	})
+
+	t.Run("пакетная проверка", func(t *testing.T) {
+		decisions, err := usecase.BatchCheckAccess(ctx, []*dto.AccessCheck{
+			{UserID: user.ID, Permission: granted},
+			{UserID: user.ID, Permission: missing},
+		})
+		require.NoError(t, err)
+		require.Len(t, decisions, 2)
+		assert.True(t, decisions[0].Allowed)
+		assert.Equal(t, role.ID, decisions[0].RoleID)
+		assert.False(t, decisions[1].Allowed)
+
+		_, err = usecase.BatchCheckAccess(ctx, nil)
+		assert.Error(t, err)
+	})
+}
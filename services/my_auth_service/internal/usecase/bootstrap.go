@@ -0,0 +1,221 @@
+package usecase
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/domain"
+	entRole "github.com/hughbliss/my_database/pkg/gen/dbauth/role"
+	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/userdomain"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/hughbliss/my_toolkit/reporter"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"net/mail"
+	"strings"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	InvalidBootstrapDataErr fault.Code = "InvalidBootstrapDataErr" // InvalidBootstrapDataErr: "некорректные параметры начальной настройки: нужны домен, роль, email и пароль администратора"
+	BootstrapDBErr          fault.Code = "BootstrapDBErr"          // BootstrapDBErr: "ошибка начальной настройки базы данных"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidBootstrapDataErr)
+}
+
+// MinBootstrapPasswordLength минимальная длина пароля создаваемого администратора.
+const MinBootstrapPasswordLength = 8
+
+func NewBootstrapUsecase(db *dbauth.Client) *BootstrapUsecase {
+	return &BootstrapUsecase{
+		rep: reporter.InitReporter("BootstrapUsecase"),
+		db:  db,
+	}
+}
+
+type BootstrapUsecase struct {
+	rep reporter.Reporter
+	db  *dbauth.Client
+}
+
+// Bootstrap создает домен, роль супер-администратора со всеми доступами
+// каталога acman.Permissions и администратора с этой ролью в домене.
+// Существующие сущности переиспользуются, поэтому повторный запуск безопасен:
+// в роль лишь добавляются появившиеся в каталоге доступы, а пароль
+// существующего администратора не меняется. Заблокированный или удаленный
+// администратор снова становится активным.
+func (b BootstrapUsecase) Bootstrap(ctx context.Context, params *dto.Bootstrap) (*dto.BootstrapResult, error) {
+	ctx, log, end := b.rep.Start(ctx, "Bootstrap")
+	defer end()
+
+	email := strings.ToLower(strings.TrimSpace(params.AdminEmail))
+	if params.DomainName == "" || params.RoleName == "" {
+		log.Warn().Msg("invalid bootstrap data")
+		return nil, InvalidBootstrapDataErr.Err()
+	}
+	if _, err := mail.ParseAddress(email); err != nil {
+		log.Warn().Msg("invalid admin email")
+		return nil, InvalidBootstrapDataErr.Err()
+	}
+
+	result := new(dto.BootstrapResult)
+	err := withTx(ctx, b.db, func(tx *dbauth.Tx) error {
+		dom, err := tx.Domain.Query().Where(domain.Name(params.DomainName)).Only(ctx)
+		if dbauth.IsNotFound(err) {
+			dom, err = tx.Domain.Create().SetName(params.DomainName).Save(ctx)
+			result.DomainCreated = true
+		}
+		if err != nil {
+			return err
+		}
+		result.DomainID = dom.ID
+
+		role, err := b.superAdminRole(ctx, tx, dom, params, result)
+		if err != nil {
+			return err
+		}
+		result.RoleID = role.ID
+
+		admin, err := tx.User.Query().Where(entUser.EmailEqualFold(email)).Only(ctx)
+		switch {
+		case err == nil && admin.Status != entUser.StatusActive:
+			// Повторный запуск восстанавливает доступ администратора, который
+			// был заблокирован или удален после первого запуска.
+			admin, err = tx.User.UpdateOne(admin).
+				SetStatus(entUser.StatusActive).
+				ClearDisabledAt().
+				ClearDeletedAt().
+				AddVersion(1).
+				Save(ctx)
+			if err != nil {
+				return err
+			}
+			result.AdminRestored = true
+			err = outbox.Write(ctx, tx, outbox.UserRestored, admin.ID.String(), outbox.User(admin))
+		case dbauth.IsNotFound(err):
+			if len(params.AdminPassword) < MinBootstrapPasswordLength {
+				return InvalidBootstrapDataErr.Err()
+			}
+			hash, herr := bcrypt.GenerateFromPassword([]byte(params.AdminPassword), bcrypt.DefaultCost)
+			if herr != nil {
+				return herr
+			}
+			name := params.AdminName
+			if name == "" {
+				name = email
+			}
+			admin, err = tx.User.Create().
+				SetEmail(email).
+				SetName(name).
+				SetPasswordHash(string(hash)).
+				SetCurrentDomainID(dom.ID).
+				Save(ctx)
+			if err != nil {
+				return err
+			}
+			result.AdminCreated = true
+			err = outbox.Write(ctx, tx, outbox.UserCreated, admin.ID.String(), outbox.User(admin))
+		}
+		if err != nil {
+			return err
+		}
+		result.AdminID = admin.ID
+
+		membership, err := tx.UserDomain.Query().
+			Where(userdomain.UserID(admin.ID), userdomain.DomainID(dom.ID)).
+			Only(ctx)
+		event := outbox.MembershipData{
+			UserID:   admin.ID.String(),
+			DomainID: dom.ID.String(),
+			RoleID:   role.ID.String(),
+		}
+		switch {
+		case dbauth.IsNotFound(err):
+			result.MembershipChanged = true
+			if err := tx.UserDomain.Create().
+				SetUserID(admin.ID).
+				SetDomainID(dom.ID).
+				SetRoleID(role.ID).
+				Exec(ctx); err != nil {
+				return err
+			}
+			return outbox.Write(ctx, tx, outbox.MembershipAssigned, admin.ID.String(), event)
+		case err != nil:
+			return err
+		case membership.RoleID != role.ID:
+			result.MembershipChanged = true
+			if err := tx.UserDomain.UpdateOne(membership).SetRoleID(role.ID).Exec(ctx); err != nil {
+				return err
+			}
+			event.PreviousRoleID = membership.RoleID.String()
+			return outbox.Write(ctx, tx, outbox.MembershipChanged, admin.ID.String(), event)
+		}
+		return nil
+	})
+	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Msg("bootstrap rejected")
+			return nil, err
+		}
+		log.Err(err).Stack().Msg("failed to bootstrap")
+		return nil, BootstrapDBErr.Err()
+	}
+
+	log.Info().
+		Bool("domain_created", result.DomainCreated).
+		Bool("role_created", result.RoleCreated).
+		Bool("role_updated", result.RoleUpdated).
+		Bool("admin_created", result.AdminCreated).
+		Bool("admin_restored", result.AdminRestored).
+		Bool("membership_changed", result.MembershipChanged).
+		Msg("bootstrap finished")
+	return result, nil
+}
+
+// superAdminRole находит роль params.RoleName в домене и дополняет ее доступами
+// каталога, которых в ней нет, либо создает роль со всеми доступами, включая
+// доступы, которые проверяют сами сервисы.
+func (b BootstrapUsecase) superAdminRole(ctx context.Context, tx *dbauth.Tx, dom *dbauth.Domain, params *dto.Bootstrap, result *dto.BootstrapResult) (*dbauth.Role, error) {
+	all := catalogAliases()
+
+	role, err := tx.Role.Query().
+		Where(entRole.DomainID(dom.ID), entRole.Name(params.RoleName)).
+		Only(ctx)
+	eventType := outbox.RoleUpdated
+	switch {
+	case dbauth.IsNotFound(err):
+		result.RoleCreated = true
+		eventType = outbox.RoleCreated
+		role, err = tx.Role.Create().
+			SetName(params.RoleName).
+			SetDescription("Супер-администратор со всеми доступами").
+			SetPermissions(all).
+			SetDomainID(dom.ID).
+			Save(ctx)
+	case err != nil:
+		return nil, err
+	default:
+		missing, _ := permissionsDiff(role.Permissions, all)
+		if len(missing) == 0 {
+			return role, nil
+		}
+		result.RoleUpdated = true
+		role, err = tx.Role.UpdateOne(role).
+			SetPermissions(append(role.Permissions, missing...)).
+			AddVersion(1).
+			Save(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return role, outbox.Write(ctx, tx, eventType, role.ID.String(), outbox.Role(role))
+}
@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_database/pkg/dbauthclient"
+	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/userdomain"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/reload"
+	"github.com/hughbliss/my_toolkit/reporter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"testing"
+	"time"
+)
+
+func TestBootstrapUsecase_Bootstrap(t *testing.T) {
+	client := dbauthclient.Mock(t)
+	defer client.Close()
+	usecase := &BootstrapUsecase{
+		rep: reporter.InitReporter("test"),
+		db:  client,
+	}
+	ctx := context.Background()
+
+	params := &dto.Bootstrap{
+		DomainName:    "Main",
+		RoleName:      "super-admin",
+		AdminEmail:    "Admin@Example.com",
+		AdminName:     "Admin",
+		AdminPassword: "secret-password",
+	}
+
+	t.Run("первый запуск создает домен, роль и администратора", func(t *testing.T) {
+		result, err := usecase.Bootstrap(ctx, params)
+		require.NoError(t, err)
+		assert.True(t, result.DomainCreated)
+		assert.True(t, result.RoleCreated)
+		assert.True(t, result.AdminCreated)
+		assert.True(t, result.MembershipChanged)
+
+		role, err := client.Role.Get(ctx, result.RoleID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, catalogAliases(), role.Permissions)
+		assert.Contains(t, role.Permissions, reload.ConfigPermission)
+
+		admin, err := client.User.Get(ctx, result.AdminID)
+		require.NoError(t, err)
+		assert.Equal(t, "admin@example.com", admin.Email)
+		assert.Equal(t, result.DomainID, admin.CurrentDomainID)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(params.AdminPassword)))
+	})
+
+	t.Run("повторный запуск ничего не меняет", func(t *testing.T) {
+		result, err := usecase.Bootstrap(ctx, &dto.Bootstrap{
+			DomainName: params.DomainName,
+			RoleName:   params.RoleName,
+			AdminEmail: params.AdminEmail,
+		})
+		require.NoError(t, err)
+		assert.False(t, result.DomainCreated)
+		assert.False(t, result.RoleCreated)
+		assert.False(t, result.RoleUpdated)
+		assert.False(t, result.AdminCreated)
+		assert.False(t, result.MembershipChanged)
+
+		count, err := client.UserDomain.Query().Where(userdomain.UserID(result.AdminID)).Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("роль дополняется новыми доступами", func(t *testing.T) {
+		result, err := usecase.Bootstrap(ctx, params)
+		require.NoError(t, err)
+		require.NoError(t, client.Role.UpdateOneID(result.RoleID).SetPermissions(catalogPermissions(t, 1)).Exec(ctx))
+
+		result, err = usecase.Bootstrap(ctx, params)
+		require.NoError(t, err)
+		assert.True(t, result.RoleUpdated)
+
+		role, err := client.Role.Get(ctx, result.RoleID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, catalogAliases(), role.Permissions)
+	})
+
+	t.Run("удаленный администратор восстанавливается", func(t *testing.T) {
+		result, err := usecase.Bootstrap(ctx, params)
+		require.NoError(t, err)
+		require.NoError(t, client.User.UpdateOneID(result.AdminID).
+			SetStatus(entUser.StatusDeleted).
+			SetDeletedAt(time.Now()).
+			Exec(ctx))
+
+		result, err = usecase.Bootstrap(ctx, params)
+		require.NoError(t, err)
+		assert.True(t, result.AdminRestored)
+		assert.False(t, result.AdminCreated)
+
+		admin, err := client.User.Get(ctx, result.AdminID)
+		require.NoError(t, err)
+		assert.Equal(t, entUser.StatusActive, admin.Status)
+		assert.Nil(t, admin.DeletedAt)
+	})
+
+	t.Run("новый администратор без пароля", func(t *testing.T) {
+		_, err := usecase.Bootstrap(ctx, &dto.Bootstrap{
+			DomainName: params.DomainName,
+			RoleName:   params.RoleName,
+			AdminEmail: "other@example.com",
+		})
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), InvalidBootstrapDataErr.Err().Error())
+	})
+}
@@ -0,0 +1,40 @@
+package usecase
+
+import (
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"google.golang.org/protobuf/proto"
+)
+
+// VersionConflictError отказ в обновлении сущности, измененной после того, как
+// клиент прочитал ее версию. Current содержит актуальное состояние сущности,
+// чтобы клиент мог объединить изменения и повторить запрос.
+type VersionConflictError struct {
+	*fault.Fault
+	Current proto.Message
+}
+
+func newVersionConflictError(code fault.Code, current proto.Message) *VersionConflictError {
+	return &VersionConflictError{
+		Fault:   code.Err(),
+		Current: current,
+	}
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return e.Fault
+}
+
+// ToProto дополняет статус ошибки актуальным состоянием сущности в деталях.
+func (e *VersionConflictError) ToProto() error {
+	st := faultstatus.Status(e.Fault)
+
+	if e.Current == nil {
+		return st.Err()
+	}
+	detailed, err := st.WithDetails(e.Current)
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
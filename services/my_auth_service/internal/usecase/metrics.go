@@ -0,0 +1,27 @@
+package usecase
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_toolkit/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	meter         = metrics.Meter("github.com/hughbliss/my_auth_service/usecase")
+	accessDenials = metrics.Counter(meter, "auth.access_denials", "Denied access checks by permission and reason")
+)
+
+// recordDenial учитывает отказ в доступе. Неизвестные доступы учитываются
+// без алиаса, чтобы произвольные строки из запросов не раздували число рядов.
+func recordDenial(ctx context.Context, check *dto.AccessCheck, decision *dto.AccessDecision) {
+	alias := check.Permission
+	if decision.Reason == dto.AccessUnknownPermission {
+		alias = "unknown"
+	}
+	accessDenials.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("permission", alias),
+		attribute.String("reason", decision.Reason),
+	))
+}
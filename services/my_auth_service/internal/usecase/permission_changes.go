@@ -0,0 +1,311 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"entgo.io/ent/dialect/sql"
+	"errors"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entOutbox "github.com/hughbliss/my_database/pkg/gen/dbauth/outboxevent"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/predicate"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"google.golang.org/grpc/codes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	InvalidResumeTokenErr  fault.Code = "InvalidResumeTokenErr"  // InvalidResumeTokenErr: "некорректный токен возобновления подписки на изменения доступов"
+	ResumeTokenExpiredErr  fault.Code = "ResumeTokenExpiredErr"  // ResumeTokenExpiredErr: "токен возобновления устарел: сбросьте кэш доступов и подпишитесь заново"
+	PermissionChangesDBErr fault.Code = "PermissionChangesDBErr" // PermissionChangesDBErr: "ошибка чтения изменений доступов из базы данных"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidResumeTokenErr)
+	faultstatus.Register(codes.OutOfRange, ResumeTokenExpiredErr)
+}
+
+// watchOptions параметры опроса outbox в WatchPermissionChanges.
+type watchOptions struct {
+	// poll пауза между опросами outbox, когда новых событий нет.
+	poll time.Duration
+	// heartbeat период уведомлений heartbeat, которые не дают балансировщикам
+	// закрыть простаивающий поток и продвигают токен клиента.
+	heartbeat time.Duration
+	// batch число событий, читаемых за один запрос.
+	batch int
+	// horizon возвращает горизонт снимка, см. cursor.
+	horizon func(ctx context.Context, db *dbauth.Client) (int64, error)
+}
+
+var defaultWatchOptions = watchOptions{
+	poll:      500 * time.Millisecond,
+	heartbeat: 15 * time.Second,
+	batch:     500,
+	horizon:   snapshotHorizon,
+}
+
+// cursor позиция в outbox: транзакция, записавшая событие, и идентификатор
+// события. Идентификаторы выдаются при вставке, а строки видны после
+// фиксации, поэтому порядок идентификаторов не совпадает с порядком
+// фиксации. Подписчикам отдаются только события транзакций ниже горизонта
+// снимка (pg_snapshot_xmin): все такие транзакции уже завершены, и позади
+// отданного cursor новых событий не появится, сколько бы ни шла транзакция.
+type cursor struct {
+	txID int64
+	id   int
+}
+
+func cursorOf(row *dbauth.OutboxEvent) cursor {
+	return cursor{txID: row.TxID, id: row.ID}
+}
+
+// parseCursor разбирает токен возобновления вида "<tx_id>.<id>".
+func parseCursor(token string) (cursor, bool) {
+	rawTxID, rawID, ok := strings.Cut(token, ".")
+	if !ok {
+		return cursor{}, false
+	}
+	txID, err := strconv.ParseInt(rawTxID, 10, 64)
+	if err != nil || txID < 0 {
+		return cursor{}, false
+	}
+	id, err := strconv.Atoi(rawID)
+	if err != nil || id < 0 {
+		return cursor{}, false
+	}
+	return cursor{txID: txID, id: id}, true
+}
+
+func (c cursor) String() string {
+	return strconv.FormatInt(c.txID, 10) + "." + strconv.Itoa(c.id)
+}
+
+func (c cursor) less(other cursor) bool {
+	return c.txID < other.txID || (c.txID == other.txID && c.id < other.id)
+}
+
+// after отбирает события, следующие за c.
+func (c cursor) after() predicate.OutboxEvent {
+	return entOutbox.Or(
+		entOutbox.TxIDGT(c.txID),
+		entOutbox.And(entOutbox.TxID(c.txID), entOutbox.IDGT(c.id)),
+	)
+}
+
+// snapshotHorizon возвращает идентификатор самой старой незавершенной
+// транзакции: транзакции с меньшими идентификаторами уже завершены.
+func snapshotHorizon(ctx context.Context, db *dbauth.Client) (int64, error) {
+	rows, err := db.QueryContext(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var horizon int64
+	if !rows.Next() {
+		return 0, errors.Join(errors.New("snapshot horizon: no rows"), rows.Err())
+	}
+	if err := rows.Scan(&horizon); err != nil {
+		return 0, err
+	}
+	return horizon, rows.Close()
+}
+
+// watchedEvents типы событий outbox, влияющие на доступы.
+var watchedEvents = []string{
+	outbox.RoleUpdated,
+	outbox.RoleDeleted,
+	outbox.MembershipAssigned,
+	outbox.MembershipRemoved,
+	outbox.MembershipChanged,
+	outbox.UserDisabled,
+	outbox.UserDeleted,
+	outbox.UserPurged,
+	outbox.UserRestored,
+}
+
+// WatchPermissionChanges передает в send изменения ролей, членства в доменах и
+// статусов пользователей до отмены ctx или ошибки send. Первым уведомлением
+// всегда идет heartbeat с текущим токеном. С resumeToken поток продолжается с
+// события, следующего за токеном; без него - с текущего момента.
+func (a AccessUsecase) WatchPermissionChanges(ctx context.Context, resumeToken string, send func(*dto.PermissionChange) error) error {
+	ctx, log, end := a.rep.Start(ctx, "WatchPermissionChanges")
+	defer end()
+
+	last, err := a.watchStart(ctx, resumeToken)
+	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Str("resume_token", resumeToken).Msg("watch rejected")
+			return err
+		}
+		log.Err(err).Stack().Msg("failed to start watch")
+		return PermissionChangesDBErr.Err()
+	}
+	if err := send(heartbeat(last)); err != nil {
+		return err
+	}
+
+	poll := time.NewTicker(a.watch.poll)
+	defer poll.Stop()
+	beat := time.NewTicker(a.watch.heartbeat)
+	defer beat.Stop()
+
+	for {
+		for {
+			horizon, err := a.watch.horizon(ctx, a.db)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Err(err).Stack().Msg("failed to read snapshot horizon")
+				return PermissionChangesDBErr.Err()
+			}
+			rows, err := a.db.OutboxEvent.Query().
+				Where(
+					last.after(),
+					entOutbox.TxIDLT(horizon),
+					entOutbox.TypeIn(watchedEvents...),
+				).
+				Order(entOutbox.ByTxID(), entOutbox.ByID()).
+				Limit(a.watch.batch).
+				All(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Err(err).Stack().Msg("failed to read outbox events")
+				return PermissionChangesDBErr.Err()
+			}
+
+			for _, row := range rows {
+				last = cursorOf(row)
+				change, ok := permissionChange(row)
+				if !ok {
+					log.Warn().Str("event_id", row.EventID).Str("type", row.Type).Msg("malformed outbox event skipped")
+					continue
+				}
+				if err := send(change); err != nil {
+					return err
+				}
+			}
+			if len(rows) < a.watch.batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-poll.C:
+		case <-beat.C:
+			if err := send(heartbeat(last)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watchStart возвращает позицию, после которой начинается поток.
+func (a AccessUsecase) watchStart(ctx context.Context, resumeToken string) (cursor, error) {
+	if resumeToken == "" {
+		horizon, err := a.watch.horizon(ctx, a.db)
+		if err != nil {
+			return cursor{}, err
+		}
+		newest, err := a.db.OutboxEvent.Query().
+			Where(entOutbox.TxIDLT(horizon)).
+			Order(entOutbox.ByTxID(sql.OrderDesc()), entOutbox.ByID(sql.OrderDesc())).
+			First(ctx)
+		if dbauth.IsNotFound(err) {
+			return cursor{}, nil
+		}
+		if err != nil {
+			return cursor{}, err
+		}
+		return cursorOf(newest), nil
+	}
+
+	last, ok := parseCursor(resumeToken)
+	if !ok {
+		if _, err := strconv.Atoi(resumeToken); err == nil {
+			// Токен до перехода на cursor: продолжить с него нельзя, клиент
+			// должен сбросить кэш и начать заново.
+			return cursor{}, ResumeTokenExpiredErr.Err()
+		}
+		return cursor{}, InvalidResumeTokenErr.Err()
+	}
+
+	// Срок хранения удаляет самые старые события. Если самое старое из
+	// оставшихся идет после токена, удалены и события, которые клиент не
+	// получил. Пропуски идентификаторов от откаченных транзакций на это не
+	// влияют.
+	oldest, err := a.db.OutboxEvent.Query().Order(entOutbox.ByTxID(), entOutbox.ByID()).First(ctx)
+	if dbauth.IsNotFound(err) {
+		return last, nil
+	}
+	if err != nil {
+		return cursor{}, err
+	}
+	if last.less(cursorOf(oldest)) {
+		return cursor{}, ResumeTokenExpiredErr.Err()
+	}
+	return last, nil
+}
+
+func heartbeat(last cursor) *dto.PermissionChange {
+	return &dto.PermissionChange{
+		ResumeToken: last.String(),
+		Kind:        dto.PermissionChangeHeartbeat,
+		Time:        time.Now(),
+	}
+}
+
+// permissionChange переводит событие outbox в уведомление подписчикам.
+func permissionChange(row *dbauth.OutboxEvent) (*dto.PermissionChange, bool) {
+	change := &dto.PermissionChange{
+		ResumeToken: cursorOf(row).String(),
+		Time:        row.Time,
+	}
+
+	switch row.Type {
+	case outbox.RoleUpdated, outbox.RoleDeleted:
+		var data outbox.RoleData
+		if err := json.Unmarshal(row.Data, &data); err != nil {
+			return nil, false
+		}
+		change.Kind = dto.PermissionChangeRoleUpdated
+		if row.Type == outbox.RoleDeleted {
+			change.Kind = dto.PermissionChangeRoleDeleted
+		}
+		change.RoleID = data.RoleID
+		change.DomainID = data.DomainID
+	case outbox.MembershipAssigned, outbox.MembershipRemoved, outbox.MembershipChanged:
+		var data outbox.MembershipData
+		if err := json.Unmarshal(row.Data, &data); err != nil {
+			return nil, false
+		}
+		change.Kind = dto.PermissionChangeMembership
+		change.UserID = data.UserID
+		change.DomainID = data.DomainID
+		change.RoleID = data.RoleID
+	case outbox.UserDisabled, outbox.UserDeleted, outbox.UserPurged:
+		change.Kind = dto.PermissionChangeUserDisabled
+		change.UserID = row.Subject
+	case outbox.UserRestored:
+		change.Kind = dto.PermissionChangeUserRestored
+		change.UserID = row.Subject
+	default:
+		return nil, false
+	}
+	return change, true
+}
@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entOutbox "github.com/hughbliss/my_database/pkg/gen/dbauth/outboxevent"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync/atomic"
+	"testing"
+)
+
+var errStopWatch = errors.New("stop watch")
+
+// collectChanges читает поток WatchPermissionChanges, пока не получит n
+// уведомлений помимо начального heartbeat.
+func collectChanges(t *testing.T, ctx context.Context, usecase *AccessUsecase, token string, n int) []*dto.PermissionChange {
+	var changes []*dto.PermissionChange
+	err := usecase.WatchPermissionChanges(ctx, token, func(change *dto.PermissionChange) error {
+		changes = append(changes, change)
+		if len(changes) == n+1 {
+			return errStopWatch
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStopWatch)
+	return changes
+}
+
+func writeOutbox(t *testing.T, ctx context.Context, client *dbauth.Client, eventType, subject string, data any) {
+	tx, err := client.Tx(ctx)
+	require.NoError(t, err)
+	require.NoError(t, outbox.Write(ctx, tx, eventType, subject, data))
+	require.NoError(t, tx.Commit())
+}
+
+// writeOutboxTx пишет событие как записанное транзакцией txID.
+func writeOutboxTx(t *testing.T, ctx context.Context, client *dbauth.Client, txID int64, eventType, subject string, data any) {
+	writeOutbox(t, ctx, client, eventType, subject, data)
+	_, err := client.OutboxEvent.Update().Where(entOutbox.Subject(subject)).SetTxID(txID).Save(ctx)
+	require.NoError(t, err)
+}
+
+func TestAccessUsecase_WatchPermissionChanges(t *testing.T) {
+	usecase, client, ctx := setupAccessTest(t)
+	defer client.Close()
+
+	writeOutbox(t, ctx, client, outbox.UserCreated, "before", outbox.UserData{UserID: "before"})
+
+	start := collectChanges(t, ctx, usecase, "", 0)
+	require.Len(t, start, 1)
+	assert.Equal(t, dto.PermissionChangeHeartbeat, start[0].Kind)
+	token := start[0].ResumeToken
+
+	writeOutbox(t, ctx, client, outbox.RoleUpdated, "role", outbox.RoleData{RoleID: "role", DomainID: "domain"})
+	writeOutbox(t, ctx, client, outbox.UserUpdated, "user", outbox.UserData{UserID: "user"})
+	writeOutbox(t, ctx, client, outbox.MembershipChanged, "user", outbox.MembershipData{UserID: "user", DomainID: "domain", RoleID: "role"})
+	writeOutbox(t, ctx, client, outbox.UserDisabled, "user", outbox.UserData{UserID: "user"})
+
+	t.Run("изменения после токена", func(t *testing.T) {
+		changes := collectChanges(t, ctx, usecase, token, 3)[1:]
+		assert.Equal(t, dto.PermissionChangeRoleUpdated, changes[0].Kind)
+		assert.Equal(t, "role", changes[0].RoleID)
+		assert.Equal(t, dto.PermissionChangeMembership, changes[1].Kind)
+		assert.Equal(t, "user", changes[1].UserID)
+		assert.Equal(t, "domain", changes[1].DomainID)
+		assert.Equal(t, dto.PermissionChangeUserDisabled, changes[2].Kind)
+		assert.Equal(t, "user", changes[2].UserID)
+
+		resumed := collectChanges(t, ctx, usecase, changes[1].ResumeToken, 1)
+		assert.Equal(t, changes[1].ResumeToken, resumed[0].ResumeToken)
+		assert.Equal(t, changes[2].ResumeToken, resumed[1].ResumeToken)
+	})
+
+	t.Run("поток завершается с отменой контекста", func(t *testing.T) {
+		watchCtx, cancel := context.WithCancel(ctx)
+		err := usecase.WatchPermissionChanges(watchCtx, token, func(change *dto.PermissionChange) error {
+			if change.Kind == dto.PermissionChangeUserDisabled {
+				cancel()
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("некорректный токен", func(t *testing.T) {
+		err := usecase.WatchPermissionChanges(ctx, "abc", func(*dto.PermissionChange) error { return nil })
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, InvalidResumeTokenErr.Err().Error(), f.Error())
+	})
+
+	t.Run("устаревший токен", func(t *testing.T) {
+		_, err := client.OutboxEvent.Delete().Exec(ctx)
+		require.NoError(t, err)
+		writeOutbox(t, ctx, client, outbox.UserRestored, "user", outbox.UserData{UserID: "user"})
+
+		err = usecase.WatchPermissionChanges(ctx, token, func(*dto.PermissionChange) error { return nil })
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, ResumeTokenExpiredErr.Err().Error(), f.Error())
+	})
+}
+
+func TestAccessUsecase_WatchPermissionChanges_Horizon(t *testing.T) {
+	usecase, client, ctx := setupAccessTest(t)
+	defer client.Close()
+
+	var horizon, polls atomic.Int64
+	horizon.Store(10)
+	watchCtx, cancel := context.WithCancel(ctx)
+	usecase.watch.horizon = func(context.Context, *dbauth.Client) (int64, error) {
+		if polls.Add(1) > 3 {
+			cancel()
+		}
+		return horizon.Load(), nil
+	}
+
+	writeOutboxTx(t, ctx, client, 5, outbox.UserDisabled, "first", outbox.UserData{UserID: "first"})
+	start := collectChanges(t, ctx, usecase, "", 0)
+	token := start[0].ResumeToken
+	assert.Equal(t, "5.1", token)
+
+	// Транзакция 11 не ниже горизонта: транзакция 10 могла еще не завершиться
+	// и записать событие с меньшим идентификатором.
+	writeOutboxTx(t, ctx, client, 11, outbox.RoleUpdated, "late", outbox.RoleData{RoleID: "role"})
+	err := usecase.WatchPermissionChanges(watchCtx, token, func(change *dto.PermissionChange) error {
+		if change.Kind != dto.PermissionChangeHeartbeat {
+			return errStopWatch
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	writeOutboxTx(t, ctx, client, 10, outbox.UserRestored, "early", outbox.UserData{UserID: "early"})
+	horizon.Store(12)
+	changes := collectChanges(t, ctx, usecase, token, 2)[1:]
+	assert.Equal(t, dto.PermissionChangeUserRestored, changes[0].Kind)
+	assert.Equal(t, "10.3", changes[0].ResumeToken)
+	assert.Equal(t, dto.PermissionChangeRoleUpdated, changes[1].Kind)
+	assert.Equal(t, "11.2", changes[1].ResumeToken)
+
+	t.Run("токен старого формата", func(t *testing.T) {
+		err := usecase.WatchPermissionChanges(ctx, "1", func(*dto.PermissionChange) error { return nil })
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, ResumeTokenExpiredErr.Err().Error(), f.Error())
+	})
+}
@@ -0,0 +1,103 @@
+package usecase
+
+import (
+	"fmt"
+	"github.com/hughbliss/my_protobuf/go/pkg/gen/acman"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/hughbliss/my_toolkit/permission"
+	"github.com/hughbliss/my_toolkit/reload"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// UnknownPermissionsError ошибка валидации роли, содержащая алиасы доступов,
+// отсутствующие в каталоге acman.Permissions.
+type UnknownPermissionsError struct {
+	*fault.Fault
+	Aliases []string
+}
+
+func newUnknownPermissionsError(aliases []string) *UnknownPermissionsError {
+	return &UnknownPermissionsError{
+		Fault:   UnknownPermissionsErr.Err(),
+		Aliases: aliases,
+	}
+}
+
+func (e *UnknownPermissionsError) Unwrap() error {
+	return e.Fault
+}
+
+// ToProto дополняет статус ошибки списком неизвестных алиасов в виде
+// errdetails.BadRequest, по одному нарушению на каждый алиас.
+func (e *UnknownPermissionsError) ToProto() error {
+	st := faultstatus.Status(e.Fault)
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(e.Aliases))
+	for i, alias := range e.Aliases {
+		violations[i] = &errdetails.BadRequest_FieldViolation{
+			Field:       fmt.Sprintf("role.permissions[%q]", alias),
+			Description: "unknown permission " + alias,
+		}
+	}
+
+	detailed, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// serviceAliases доступы, которые проверяют сами сервисы, а не gRPC методы,
+// поэтому их нет в каталоге acman.Permissions.
+var serviceAliases = []string{reload.ConfigPermission}
+
+// catalogAliases возвращает алиасы каталога acman.Permissions и serviceAliases.
+func catalogAliases() []string {
+	aliases := make([]string, 0, len(acman.Permissions)+len(serviceAliases))
+	for _, p := range acman.Permissions {
+		aliases = append(aliases, p.Alias)
+	}
+	return append(aliases, serviceAliases...)
+}
+
+// knownPermission проверяет, что доступ покрывает хотя бы один алиас из
+// catalogAliases. Точный алиас должен быть объявлен в каталоге, шаблон вида
+// "admin.users.*" или "*" - совпасть хотя бы с одним из них.
+func knownPermission(grant string) bool {
+	if !permission.Valid(grant) {
+		return false
+	}
+	for _, alias := range catalogAliases() {
+		if permission.Match(grant, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownPermissions возвращает алиасы из permissions, которых нет в каталоге,
+// в порядке их появления и без повторов.
+func unknownPermissions(permissions []string) []string {
+	var unknown []string
+	seen := make(map[string]struct{}, len(permissions))
+	for _, alias := range permissions {
+		if _, ok := seen[alias]; ok {
+			continue
+		}
+		seen[alias] = struct{}{}
+		if !knownPermission(alias) {
+			unknown = append(unknown, alias)
+		}
+	}
+	return unknown
+}
+
+// validatePermissions возвращает *UnknownPermissionsError, если среди
+// permissions есть алиасы, отсутствующие в каталоге.
+func validatePermissions(permissions []string) error {
+	if unknown := unknownPermissions(permissions); len(unknown) > 0 {
+		return newUnknownPermissionsError(unknown)
+	}
+	return nil
+}
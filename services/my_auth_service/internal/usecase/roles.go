@@ -2,13 +2,19 @@ package usecase
 
 import (
 	"context"
+	"fmt"
 	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth/domain"
 	entRole "github.com/hughbliss/my_database/pkg/gen/dbauth/role"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/userdomain"
 	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 )
 
 func NewRolesUsecase(db *dbauth.Client) *RolesUsecase {
@@ -31,8 +37,57 @@ const (
 	RoleNotFoundErr    fault.Code = "RoleNotFoundErr"    // RoleNotFoundErr: "роль не найдена"
 	DomainNotFoundErr  fault.Code = "DomainNotFoundErr"  // DomainNotFoundErr: "домен не найден"
 	InvalidRoleDataErr fault.Code = "InvalidRoleDataErr" // InvalidRoleDataErr: "некорректные данные роли"
+
+	UnknownPermissionsErr     fault.Code = "UnknownPermissionsErr"     // UnknownPermissionsErr: "роль содержит неизвестные доступы"
+	RolePermissionsPruneDBErr fault.Code = "RolePermissionsPruneDBErr" // RolePermissionsPruneDBErr: "ошибка очистки устаревших доступов ролей"
+
+	RoleInUseErr                  fault.Code = "RoleInUseErr"                  // RoleInUseErr: "роль назначена пользователям, укажите роль для переназначения"
+	RoleReassignDomainMismatchErr fault.Code = "RoleReassignDomainMismatchErr" // RoleReassignDomainMismatchErr: "роль для переназначения принадлежит другому домену"
+	RoleVersionConflictErr        fault.Code = "RoleVersionConflictErr"        // RoleVersionConflictErr: "роль была изменена другим пользователем, обновите данные"
 )
 
+func init() {
+	faultstatus.Register(codes.NotFound, RoleNotFoundErr, DomainNotFoundErr)
+	faultstatus.Register(codes.InvalidArgument, InvalidRoleDataErr, UnknownPermissionsErr, RoleReassignDomainMismatchErr)
+	faultstatus.Register(codes.FailedPrecondition, RoleInUseErr)
+	faultstatus.Register(codes.Aborted, RoleVersionConflictErr)
+}
+
+// RoleInUseError отказ в удалении роли, назначенной пользователям.
+type RoleInUseError struct {
+	*fault.Fault
+	Users int // Users число пользователей, которым назначена роль.
+}
+
+func newRoleInUseError(users int) *RoleInUseError {
+	return &RoleInUseError{
+		Fault: RoleInUseErr.Err(),
+		Users: users,
+	}
+}
+
+func (e *RoleInUseError) Unwrap() error {
+	return e.Fault
+}
+
+// ToProto дополняет статус ошибки числом затронутых пользователей в виде
+// errdetails.PreconditionFailure.
+func (e *RoleInUseError) ToProto() error {
+	st := faultstatus.Status(e.Fault)
+
+	detailed, err := st.WithDetails(&errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        "ROLE_IN_USE",
+			Subject:     "reassign_to_role_id",
+			Description: fmt.Sprintf("role is assigned to %d users", e.Users),
+		}},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
 type RolesUsecase struct {
 	rep reporter.Reporter
 	db  *dbauth.Client
@@ -74,18 +129,29 @@ func (r RolesUsecase) CreateRole(ctx context.Context, role *dto.Role) (*dto.Doma
 		return nil, InvalidRoleDataErr.Err()
 	}
 
+	if err := validatePermissions(role.Permissions); err != nil {
+		log.Warn().Err(err).Msg("invalid role permissions")
+		return nil, err
+	}
+
 	domain, err := r.db.Domain.Get(ctx, role.DomainId)
 	if err != nil {
 		log.Err(err).Stack().Msg("failed to get domain")
 		return nil, DomainNotFoundErr.Err()
 	}
 
-	if _, err := r.db.Role.Create().
-		SetName(role.Name).
-		SetDescription(role.Description).
-		SetPermissions(role.Permissions).
-		SetDomainID(domain.ID).
-		Save(ctx); err != nil {
+	if err := withTx(ctx, r.db, func(tx *dbauth.Tx) error {
+		created, err := tx.Role.Create().
+			SetName(role.Name).
+			SetDescription(role.Description).
+			SetPermissions(role.Permissions).
+			SetDomainID(domain.ID).
+			Save(ctx)
+		if err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, outbox.RoleCreated, created.ID.String(), outbox.Role(created))
+	}); err != nil {
 		log.Err(err).Stack().Msg("failed to create role")
 		return nil, RoleCreationDBErr.Err()
 	}
@@ -102,6 +168,11 @@ func (r RolesUsecase) UpdateRole(ctx context.Context, role *dto.Role) (*dto.Doma
 		return nil, InvalidRoleDataErr.Err()
 	}
 
+	if err := validatePermissions(role.Permissions); err != nil {
+		log.Warn().Err(err).Msg("invalid role permissions")
+		return nil, err
+	}
+
 	existingRole, err := r.db.Role.Query().
 		Where(entRole.DomainID(role.DomainId)).
 		Where(entRole.ID(role.ID)).First(ctx)
@@ -109,11 +180,31 @@ func (r RolesUsecase) UpdateRole(ctx context.Context, role *dto.Role) (*dto.Doma
 		log.Err(err).Stack().Msg("failed to find role")
 		return nil, RoleNotFoundErr.Err()
 	}
-	if _, err := r.db.Role.UpdateOne(existingRole).
-		SetName(role.Name).
-		SetDescription(role.Description).
-		SetPermissions(role.Permissions).
-		Save(ctx); err != nil {
+
+	if role.Version != 0 && role.Version != existingRole.Version {
+		log.Warn().Int("expected", role.Version).Int("actual", existingRole.Version).Msg("role version conflict")
+		return nil, newVersionConflictError(RoleVersionConflictErr, dto.RoleFromEnt(existingRole).ToProto())
+	}
+
+	if err := withTx(ctx, r.db, func(tx *dbauth.Tx) error {
+		update := tx.Role.UpdateOne(existingRole).
+			SetName(role.Name).
+			SetDescription(role.Description).
+			SetPermissions(role.Permissions).
+			AddVersion(1)
+		if role.Version != 0 {
+			update = update.Where(entRole.Version(role.Version))
+		}
+		updated, err := update.Save(ctx)
+		if err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, outbox.RoleUpdated, updated.ID.String(), outbox.Role(updated))
+	}); err != nil {
+		if dbauth.IsNotFound(err) {
+			// Роль изменили между чтением и обновлением.
+			return nil, r.roleConflict(ctx, role.ID)
+		}
 		log.Err(err).Stack().Msg("failed to update role")
 		return nil, RoleUpdateDBErr.Err()
 	}
@@ -121,7 +212,21 @@ func (r RolesUsecase) UpdateRole(ctx context.Context, role *dto.Role) (*dto.Doma
 	return r.GetDomainRoles(ctx, role.DomainId)
 }
 
-func (r RolesUsecase) DeleteRole(ctx context.Context, roleID xid.ID) (*dto.DomainRoles, error) {
+func (r RolesUsecase) roleConflict(ctx context.Context, roleID xid.ID) error {
+	current, err := r.db.Role.Get(ctx, roleID)
+	if err != nil {
+		if dbauth.IsNotFound(err) {
+			return RoleNotFoundErr.Err()
+		}
+		return RoleUpdateDBErr.Err()
+	}
+	return newVersionConflictError(RoleVersionConflictErr, dto.RoleFromEnt(current).ToProto())
+}
+
+// DeleteRole удаляет роль. Если роль назначена пользователям, удаление
+// отклоняется с RoleInUseError, пока не передан reassignTo - роль того же
+// домена, на которую эти пользователи будут переведены в той же транзакции.
+func (r RolesUsecase) DeleteRole(ctx context.Context, roleID, reassignTo xid.ID) (*dto.RoleDeletion, error) {
 	ctx, log, end := r.rep.Start(ctx, "DeleteRole")
 	defer end()
 
@@ -131,11 +236,130 @@ func (r RolesUsecase) DeleteRole(ctx context.Context, roleID xid.ID) (*dto.Domai
 		return nil, RoleNotFoundErr.Err()
 	}
 
-	domainID := role.DomainID
+	if reassignTo == roleID {
+		log.Warn().Msg("role can not be reassigned to itself")
+		return nil, InvalidRoleDataErr.Err()
+	}
+
+	var reassigned int
+	var target *dbauth.Role
+	err = withTx(ctx, r.db, func(tx *dbauth.Tx) error {
+		assigned, err := tx.UserDomain.Query().Where(userdomain.RoleID(role.ID)).Count(ctx)
+		if err != nil {
+			return err
+		}
+
+		if assigned > 0 {
+			if reassignTo.IsNil() {
+				return newRoleInUseError(assigned)
+			}
+
+			target, err = tx.Role.Get(ctx, reassignTo)
+			if err != nil {
+				if dbauth.IsNotFound(err) {
+					return RoleNotFoundErr.Err()
+				}
+				return err
+			}
+			if target.DomainID != role.DomainID {
+				return RoleReassignDomainMismatchErr.Err()
+			}
+
+			if reassigned, err = tx.UserDomain.Update().
+				Where(userdomain.RoleID(role.ID)).
+				SetRoleID(target.ID).
+				Save(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Role.DeleteOne(role).Exec(ctx); err != nil {
+			return err
+		}
 
-	if err = r.db.Role.DeleteOne(role).Exec(ctx); err != nil {
+		// Пользователям переназначенной роли отдельные события не пишутся:
+		// reassigned_to в событии удаления достаточно, чтобы их найти.
+		data := outbox.Role(role)
+		if target != nil {
+			data.ReassignedTo = target.ID.String()
+		}
+		return outbox.Write(ctx, tx, outbox.RoleDeleted, role.ID.String(), data)
+	})
+	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Msg("role deletion rejected")
+			return nil, err
+		}
 		log.Err(err).Stack().Msg("failed to delete role")
 		return nil, RoleDeletionDBErr.Err()
 	}
-	return r.GetDomainRoles(ctx, domainID)
+
+	domainRoles, err := r.GetDomainRoles(ctx, role.DomainID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.RoleDeletion{
+		DomainRoles:     domainRoles,
+		ReassignedUsers: reassigned,
+	}, nil
+}
+
+// PruneStalePermissions находит во всех ролях доступы, которых больше нет в
+// каталоге acman.Permissions. При apply == true эти доступы удаляются из ролей
+// в одной транзакции.
+func (r RolesUsecase) PruneStalePermissions(ctx context.Context, apply bool) (dto.RoleStalePermissionsList, error) {
+	ctx, log, end := r.rep.Start(ctx, "PruneStalePermissions")
+	defer end()
+
+	roles, err := r.db.Role.Query().All(ctx)
+	if err != nil {
+		log.Err(err).Stack().Msg("failed to query roles")
+		return nil, RolesGettingDBErr.Err()
+	}
+
+	var stale dto.RoleStalePermissionsList
+	for _, role := range roles {
+		if unknown := unknownPermissions(role.Permissions); len(unknown) > 0 {
+			stale = append(stale, &dto.RoleStalePermissions{
+				RoleID:      role.ID,
+				RoleName:    role.Name,
+				DomainID:    role.DomainID,
+				Permissions: unknown,
+			})
+		}
+	}
+
+	if !apply || len(stale) == 0 {
+		return stale, nil
+	}
+
+	err = withTx(ctx, r.db, func(tx *dbauth.Tx) error {
+		for _, role := range roles {
+			kept := make([]string, 0, len(role.Permissions))
+			for _, alias := range role.Permissions {
+				if knownPermission(alias) {
+					kept = append(kept, alias)
+				}
+			}
+			if len(kept) == len(role.Permissions) {
+				continue
+			}
+			updated, err := tx.Role.UpdateOneID(role.ID).SetPermissions(kept).AddVersion(1).Save(ctx)
+			if err != nil {
+				return err
+			}
+			if err := outbox.Write(ctx, tx, outbox.RoleUpdated, updated.ID.String(), outbox.Role(updated)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Stack().Msg("failed to prune role permissions")
+		return nil, RolePermissionsPruneDBErr.Err()
+	}
+
+	log.Info().Int("roles", len(stale)).Msg("stale permissions pruned")
+	return stale, nil
 }
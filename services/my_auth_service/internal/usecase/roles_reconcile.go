@@ -0,0 +1,249 @@
+package usecase
+
+import (
+	"context"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/domain"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/userdomain"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"google.golang.org/grpc/codes"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	InvalidRolesDocumentErr fault.Code = "InvalidRolesDocumentErr" // InvalidRolesDocumentErr: "некорректный документ ролей: пустые или повторяющиеся имена доменов и ролей"
+	RolesReconcileDBErr     fault.Code = "RolesReconcileDBErr"     // RolesReconcileDBErr: "ошибка применения плана ролей"
+	RolesReconcileInUseErr  fault.Code = "RolesReconcileInUseErr"  // RolesReconcileInUseErr: "план удаляет роли, назначенные пользователям; переназначьте пользователей перед применением"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidRolesDocumentErr)
+	faultstatus.Register(codes.FailedPrecondition, RolesReconcileInUseErr)
+}
+
+// ReconcileRoles сравнивает роли в базе данных с документом doc и возвращает
+// план изменений: создание, обновление и удаление ролей с разницей доступов.
+// При apply план выполняется в той же транзакции, в которой был рассчитан.
+// Применение отклоняется, если план удаляет роли, назначенные пользователям.
+func (r RolesUsecase) ReconcileRoles(ctx context.Context, doc *dto.RolesDocument, apply bool) (*dto.RolesPlan, error) {
+	ctx, log, end := r.rep.Start(ctx, "ReconcileRoles")
+	defer end()
+
+	if err := validateRolesDocument(doc); err != nil {
+		log.Warn().Err(err).Msg("invalid roles document")
+		return nil, err
+	}
+
+	plan := new(dto.RolesPlan)
+	err := withTx(ctx, r.db, func(tx *dbauth.Tx) error {
+		changes, err := planRoles(ctx, tx, doc)
+		if err != nil {
+			return err
+		}
+		plan.Changes = changes
+
+		if !apply || len(changes) == 0 {
+			return nil
+		}
+		for _, change := range changes {
+			if change.Action == dto.RolePlanDelete && change.AssignedUsers > 0 {
+				return RolesReconcileInUseErr.Err()
+			}
+		}
+		return applyRoleChanges(ctx, tx, changes)
+	})
+	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Msg("roles reconciliation rejected")
+			return nil, err
+		}
+		log.Err(err).Stack().Msg("failed to reconcile roles")
+		return nil, RolesReconcileDBErr.Err()
+	}
+
+	plan.Applied = apply && len(plan.Changes) > 0
+	log.Info().Int("changes", len(plan.Changes)).Bool("applied", plan.Applied).Msg("roles reconciled")
+	return plan, nil
+}
+
+// validateRolesDocument проверяет имена доменов и ролей и доступы всех ролей
+// документа по каталогу acman.Permissions.
+func validateRolesDocument(doc *dto.RolesDocument) error {
+	if doc == nil || len(doc.Domains) == 0 {
+		return InvalidRolesDocumentErr.Err()
+	}
+
+	var permissions []string
+	domains := make(map[string]struct{}, len(doc.Domains))
+	for _, spec := range doc.Domains {
+		if spec.Domain == "" {
+			return InvalidRolesDocumentErr.Err()
+		}
+		if _, ok := domains[spec.Domain]; ok {
+			return InvalidRolesDocumentErr.Err()
+		}
+		domains[spec.Domain] = struct{}{}
+
+		roles := make(map[string]struct{}, len(spec.Roles))
+		for _, role := range spec.Roles {
+			if role.Name == "" {
+				return InvalidRolesDocumentErr.Err()
+			}
+			if _, ok := roles[role.Name]; ok {
+				return InvalidRolesDocumentErr.Err()
+			}
+			roles[role.Name] = struct{}{}
+			permissions = append(permissions, role.Permissions...)
+		}
+	}
+
+	return validatePermissions(permissions)
+}
+
+// planRoles рассчитывает изменения в порядке документа: сначала создание и
+// обновление ролей домена, затем удаление ролей, которых нет в документе.
+func planRoles(ctx context.Context, tx *dbauth.Tx, doc *dto.RolesDocument) ([]*dto.RoleChange, error) {
+	var changes []*dto.RoleChange
+	for _, spec := range doc.Domains {
+		current, err := tx.Domain.Query().Where(domain.Name(spec.Domain)).WithRoles().Only(ctx)
+		if err != nil {
+			if dbauth.IsNotFound(err) {
+				return nil, DomainNotFoundErr.Err()
+			}
+			return nil, err
+		}
+
+		existing := make(map[string]*dbauth.Role, len(current.Edges.Roles))
+		for _, role := range current.Edges.Roles {
+			existing[role.Name] = role
+		}
+
+		desired := make(map[string]struct{}, len(spec.Roles))
+		for _, role := range spec.Roles {
+			desired[role.Name] = struct{}{}
+
+			change := &dto.RoleChange{
+				DomainID:    current.ID,
+				DomainName:  current.Name,
+				RoleName:    role.Name,
+				Description: role.Description,
+				Permissions: role.Permissions,
+			}
+
+			old, ok := existing[role.Name]
+			if !ok {
+				change.Action = dto.RolePlanCreate
+				change.AddedPermissions, _ = permissionsDiff(nil, role.Permissions)
+				changes = append(changes, change)
+				continue
+			}
+
+			change.RoleID = old.ID
+			change.AddedPermissions, change.RemovedPermissions = permissionsDiff(old.Permissions, role.Permissions)
+			change.DescriptionChanged = old.Description != role.Description
+			if len(change.AddedPermissions) == 0 && len(change.RemovedPermissions) == 0 && !change.DescriptionChanged {
+				continue
+			}
+			change.Action = dto.RolePlanUpdate
+			changes = append(changes, change)
+		}
+
+		for _, role := range current.Edges.Roles {
+			if _, ok := desired[role.Name]; ok {
+				continue
+			}
+			assigned, err := tx.UserDomain.Query().Where(userdomain.RoleID(role.ID)).Count(ctx)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, &dto.RoleChange{
+				Action:             dto.RolePlanDelete,
+				DomainID:           current.ID,
+				DomainName:         current.Name,
+				RoleID:             role.ID,
+				RoleName:           role.Name,
+				Description:        role.Description,
+				RemovedPermissions: role.Permissions,
+				AssignedUsers:      assigned,
+			})
+		}
+	}
+	return changes, nil
+}
+
+func applyRoleChanges(ctx context.Context, tx *dbauth.Tx, changes []*dto.RoleChange) error {
+	for _, change := range changes {
+		switch change.Action {
+		case dto.RolePlanCreate:
+			created, err := tx.Role.Create().
+				SetName(change.RoleName).
+				SetDescription(change.Description).
+				SetPermissions(change.Permissions).
+				SetDomainID(change.DomainID).
+				Save(ctx)
+			if err != nil {
+				return err
+			}
+			change.RoleID = created.ID
+			if err := outbox.Write(ctx, tx, outbox.RoleCreated, created.ID.String(), outbox.Role(created)); err != nil {
+				return err
+			}
+		case dto.RolePlanUpdate:
+			updated, err := tx.Role.UpdateOneID(change.RoleID).
+				SetDescription(change.Description).
+				SetPermissions(change.Permissions).
+				AddVersion(1).
+				Save(ctx)
+			if err != nil {
+				return err
+			}
+			if err := outbox.Write(ctx, tx, outbox.RoleUpdated, updated.ID.String(), outbox.Role(updated)); err != nil {
+				return err
+			}
+		case dto.RolePlanDelete:
+			role, err := tx.Role.Get(ctx, change.RoleID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Role.DeleteOne(role).Exec(ctx); err != nil {
+				return err
+			}
+			if err := outbox.Write(ctx, tx, outbox.RoleDeleted, role.ID.String(), outbox.Role(role)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// permissionsDiff возвращает доступы, которые есть в desired и нет в current, и
+// наоборот. Порядок доступов значения не имеет.
+func permissionsDiff(current, desired []string) (added, removed []string) {
+	have := make(map[string]struct{}, len(current))
+	for _, alias := range current {
+		have[alias] = struct{}{}
+	}
+	want := make(map[string]struct{}, len(desired))
+	for _, alias := range desired {
+		if _, ok := want[alias]; ok {
+			continue
+		}
+		want[alias] = struct{}{}
+		if _, ok := have[alias]; !ok {
+			added = append(added, alias)
+		}
+	}
+	for _, alias := range current {
+		if _, ok := want[alias]; !ok {
+			removed = append(removed, alias)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	entRole "github.com/hughbliss/my_database/pkg/gen/dbauth/role"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRolesUsecase_ReconcileRoles(t *testing.T) {
+	usecase, client, ctx := setupRolesTest(t)
+	defer client.Close()
+	domain := createTestDomain(t, ctx, client)
+	perms := catalogPermissions(t, 2)
+
+	_, err := client.Role.Create().
+		SetName("Editor").
+		SetDescription("Editor").
+		SetPermissions(perms[:1]).
+		SetDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+	_, err = client.Role.Create().
+		SetName("Obsolete").
+		SetDescription("Obsolete").
+		SetPermissions(perms[:1]).
+		SetDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	doc := &dto.RolesDocument{Domains: []*dto.DomainRolesSpec{{
+		Domain: domain.Name,
+		Roles: []*dto.RoleSpec{
+			{Name: "Editor", Description: "Editor", Permissions: perms[1:]},
+			{Name: "Viewer", Description: "Viewer", Permissions: perms[:1]},
+		},
+	}}}
+
+	t.Run("план без применения", func(t *testing.T) {
+		plan, err := usecase.ReconcileRoles(ctx, doc, false)
+		require.NoError(t, err)
+		assert.False(t, plan.Applied)
+		require.Len(t, plan.Changes, 3)
+
+		assert.Equal(t, dto.RolePlanUpdate, plan.Changes[0].Action)
+		assert.Equal(t, perms[1:], plan.Changes[0].AddedPermissions)
+		assert.Equal(t, perms[:1], plan.Changes[0].RemovedPermissions)
+		assert.Equal(t, dto.RolePlanCreate, plan.Changes[1].Action)
+		assert.Equal(t, "Viewer", plan.Changes[1].RoleName)
+		assert.Equal(t, dto.RolePlanDelete, plan.Changes[2].Action)
+		assert.Equal(t, "Obsolete", plan.Changes[2].RoleName)
+
+		count, err := client.Role.Query().Where(entRole.DomainID(domain.ID)).Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("применение плана", func(t *testing.T) {
+		plan, err := usecase.ReconcileRoles(ctx, doc, true)
+		require.NoError(t, err)
+		assert.True(t, plan.Applied)
+		assert.False(t, plan.Changes[1].RoleID.IsNil())
+
+		roles, err := client.Role.Query().Where(entRole.DomainID(domain.ID)).All(ctx)
+		require.NoError(t, err)
+		names := make([]string, len(roles))
+		for i, role := range roles {
+			names[i] = role.Name
+		}
+		assert.ElementsMatch(t, []string{"Editor", "Viewer"}, names)
+	})
+
+	t.Run("повторная сверка без изменений", func(t *testing.T) {
+		plan, err := usecase.ReconcileRoles(ctx, doc, true)
+		require.NoError(t, err)
+		assert.False(t, plan.Applied)
+		assert.Empty(t, plan.Changes)
+	})
+
+	t.Run("домен не найден", func(t *testing.T) {
+		_, err := usecase.ReconcileRoles(ctx, &dto.RolesDocument{Domains: []*dto.DomainRolesSpec{{
+			Domain: "MissingDomain",
+		}}}, false)
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), DomainNotFoundErr.Err().Error())
+	})
+
+	t.Run("повторяющиеся роли", func(t *testing.T) {
+		_, err := usecase.ReconcileRoles(ctx, &dto.RolesDocument{Domains: []*dto.DomainRolesSpec{{
+			Domain: domain.Name,
+			Roles:  []*dto.RoleSpec{{Name: "Editor"}, {Name: "Editor"}},
+		}}}, false)
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), InvalidRolesDocumentErr.Err().Error())
+	})
+
+	t.Run("неизвестные доступы", func(t *testing.T) {
+		_, err := usecase.ReconcileRoles(ctx, &dto.RolesDocument{Domains: []*dto.DomainRolesSpec{{
+			Domain: domain.Name,
+			Roles:  []*dto.RoleSpec{{Name: "Editor", Permissions: []string{"no.such.permission"}}},
+		}}}, false)
+		unknown := new(UnknownPermissionsError)
+		require.ErrorAs(t, err, &unknown)
+		assert.Equal(t, []string{"no.such.permission"}, unknown.Aliases)
+	})
+}
+
+func TestRolesUsecase_ReconcileRoles_InUse(t *testing.T) {
+	usecase, client, ctx := setupRolesTest(t)
+	defer client.Close()
+	domain := createTestDomain(t, ctx, client)
+
+	role, err := client.Role.Create().
+		SetName("Assigned").
+		SetPermissions(catalogPermissions(t, 1)).
+		SetDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+	user, err := client.User.Create().
+		SetName("user").
+		SetEmail("user@example.com").
+		SetPasswordHash("hash").
+		SetCurrentDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+	_, err = client.UserDomain.Create().
+		SetUserID(user.ID).
+		SetDomainID(domain.ID).
+		SetRoleID(role.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	doc := &dto.RolesDocument{Domains: []*dto.DomainRolesSpec{{Domain: domain.Name}}}
+
+	plan, err := usecase.ReconcileRoles(ctx, doc, false)
+	require.NoError(t, err)
+	require.Len(t, plan.Changes, 1)
+	assert.Equal(t, 1, plan.Changes[0].AssignedUsers)
+
+	_, err = usecase.ReconcileRoles(ctx, doc, true)
+	f := new(fault.Fault)
+	require.ErrorAs(t, err, &f)
+	assert.Equal(t, f.Error(), RolesReconcileInUseErr.Err().Error())
+
+	_, err = client.Role.Get(ctx, role.ID)
+	assert.NoError(t, err)
+}
@@ -5,7 +5,10 @@ import (
 	"github.com/hughbliss/my_auth_service/internal/dto"
 	"github.com/hughbliss/my_database/pkg/dbauthclient"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/userdomain"
+	"github.com/hughbliss/my_protobuf/go/pkg/gen/acman"
 	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/reload"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
 	"github.com/stretchr/testify/assert"
@@ -30,6 +33,16 @@ func createTestDomain(t *testing.T, ctx context.Context, client *dbauth.Client)
 	return domain
 }
 
+// catalogPermissions возвращает первые n алиасов из каталога acman.Permissions.
+func catalogPermissions(t *testing.T, n int) []string {
+	require.GreaterOrEqual(t, len(acman.Permissions), n)
+	aliases := make([]string, n)
+	for i := range aliases {
+		aliases[i] = acman.Permissions[i].Alias
+	}
+	return aliases
+}
+
 func TestRolesUsecase_CreateRole(t *testing.T) {
 	usecase, client, ctx := setupRolesTest(t)
 	defer client.Close()
@@ -39,7 +52,7 @@ func TestRolesUsecase_CreateRole(t *testing.T) {
 		role := &dto.Role{
 			Name:        "TestRole",
 			Description: "Test Description",
-			Permissions: []string{"perm1", "perm2"},
+			Permissions: catalogPermissions(t, 1),
 			DomainId:    domain.ID,
 		}
 
@@ -55,7 +68,7 @@ func TestRolesUsecase_CreateRole(t *testing.T) {
 		role := &dto.Role{
 			Name:        "TestRole",
 			Description: "Test Description",
-			Permissions: []string{"perm1"},
+			Permissions: catalogPermissions(t, 1),
 			DomainId:    xid.New(),
 		}
 
@@ -65,6 +78,55 @@ func TestRolesUsecase_CreateRole(t *testing.T) {
 		assert.ErrorAs(t, err, &f)
 		assert.Equal(t, f.Error(), DomainNotFoundErr.Err().Error())
 	})
+
+	t.Run("неизвестные доступы", func(t *testing.T) {
+		role := &dto.Role{
+			Name:        "TestRole",
+			Description: "Test Description",
+			Permissions: append(catalogPermissions(t, 1), "perm.unknown", "perm.unknown"),
+			DomainId:    domain.ID,
+		}
+
+		_, err := usecase.CreateRole(ctx, role)
+		assert.Error(t, err)
+		unknown := new(UnknownPermissionsError)
+		require.ErrorAs(t, err, &unknown)
+		assert.Equal(t, []string{"perm.unknown"}, unknown.Aliases)
+		f := new(fault.Fault)
+		assert.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), UnknownPermissionsErr.Err().Error())
+	})
+
+	t.Run("доступ к настройкам сервисов", func(t *testing.T) {
+		// Доступа нет в каталоге acman, но его проверяют сами сервисы.
+		role := &dto.Role{
+			Name:        "ConfigAdmin",
+			Description: "Config",
+			Permissions: []string{reload.ConfigPermission},
+			DomainId:    domain.ID,
+		}
+
+		_, err := usecase.CreateRole(ctx, role)
+		require.NoError(t, err)
+	})
+
+	t.Run("шаблонные доступы", func(t *testing.T) {
+		role := &dto.Role{
+			Name:        "SuperAdmin",
+			Description: "All permissions",
+			Permissions: []string{"*"},
+			DomainId:    domain.ID,
+		}
+
+		_, err := usecase.CreateRole(ctx, role)
+		require.NoError(t, err)
+
+		role.Permissions = []string{"perm.unknown.*", "admin.*.read"}
+		_, err = usecase.CreateRole(ctx, role)
+		unknown := new(UnknownPermissionsError)
+		require.ErrorAs(t, err, &unknown)
+		assert.Equal(t, []string{"perm.unknown.*", "admin.*.read"}, unknown.Aliases)
+	})
 }
 
 func TestRolesUsecase_UpdateRole(t *testing.T) {
@@ -85,7 +147,7 @@ func TestRolesUsecase_UpdateRole(t *testing.T) {
 			ID:          role.ID,
 			Name:        "UpdatedRole",
 			Description: "Updated Description",
-			Permissions: []string{"perm1", "perm2"},
+			Permissions: catalogPermissions(t, 1),
 			DomainId:    domain.ID,
 		}
 
@@ -96,6 +158,51 @@ func TestRolesUsecase_UpdateRole(t *testing.T) {
 		assert.Equal(t, updateRole.Description, result.Roles[0].Description)
 	})
 
+	t.Run("конфликт версий", func(t *testing.T) {
+		current, err := client.Role.Get(ctx, role.ID)
+		require.NoError(t, err)
+
+		stale := &dto.Role{
+			ID:          role.ID,
+			Name:        "StaleRole",
+			Description: "Stale Description",
+			DomainId:    domain.ID,
+			Version:     current.Version + 1,
+		}
+		_, err = usecase.UpdateRole(ctx, stale)
+		conflict := new(VersionConflictError)
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, RoleVersionConflictErr.Err().Error(), conflict.Error())
+		require.NotNil(t, conflict.Current)
+
+		stale.Version = current.Version
+		result, err := usecase.UpdateRole(ctx, stale)
+		require.NoError(t, err)
+		assert.Equal(t, current.Version+1, result.Roles[0].Version)
+	})
+
+	t.Run("устаревшая версия новой роли", func(t *testing.T) {
+		fresh, err := client.Role.Create().
+			SetName("FreshRole").
+			SetPermissions([]string{"perm1"}).
+			SetDomainID(domain.ID).
+			Save(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, fresh.Version)
+
+		// Два администратора открыли роль с версией 1, первый сохранил изменения.
+		edit := func(name string) *dto.Role {
+			return &dto.Role{ID: fresh.ID, Name: name, DomainId: domain.ID, Version: fresh.Version}
+		}
+		_, err = usecase.UpdateRole(ctx, edit("FirstAdmin"))
+		require.NoError(t, err)
+
+		_, err = usecase.UpdateRole(ctx, edit("SecondAdmin"))
+		conflict := new(VersionConflictError)
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, RoleVersionConflictErr.Err().Error(), conflict.Error())
+	})
+
 	t.Run("роль не найдена", func(t *testing.T) {
 		updateRole := &dto.Role{
 			ID:          xid.New(),
@@ -126,10 +233,11 @@ func TestRolesUsecase_DeleteRole(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("успешное удаление роли", func(t *testing.T) {
-		result, err := usecase.DeleteRole(ctx, role.ID)
+		result, err := usecase.DeleteRole(ctx, role.ID, xid.NilID())
 		require.NoError(t, err)
 		assert.NotNil(t, result)
-		assert.Empty(t, result.Roles)
+		assert.Empty(t, result.DomainRoles.Roles)
+		assert.Zero(t, result.ReassignedUsers)
 
 		// Проверяем что роль действительно удалена
 		_, err = client.Role.Get(ctx, role.ID)
@@ -137,7 +245,7 @@ func TestRolesUsecase_DeleteRole(t *testing.T) {
 	})
 
 	t.Run("роль не найдена", func(t *testing.T) {
-		_, err := usecase.DeleteRole(ctx, xid.New())
+		_, err := usecase.DeleteRole(ctx, xid.New(), xid.NilID())
 		assert.Error(t, err)
 		f := new(fault.Fault)
 		assert.ErrorAs(t, err, &f)
@@ -145,6 +253,75 @@ func TestRolesUsecase_DeleteRole(t *testing.T) {
 	})
 }
 
+func TestRolesUsecase_DeleteRole_InUse(t *testing.T) {
+	usecase, client, ctx := setupRolesTest(t)
+	defer client.Close()
+	domain := createTestDomain(t, ctx, client)
+
+	createRole := func(domainID xid.ID, name string) *dbauth.Role {
+		role, err := client.Role.Create().
+			SetName(name).
+			SetDescription(name).
+			SetPermissions([]string{"perm1"}).
+			SetDomainID(domainID).
+			Save(ctx)
+		require.NoError(t, err)
+		return role
+	}
+
+	role := createRole(domain.ID, "Assigned")
+	target := createRole(domain.ID, "Target")
+	foreignDomain, err := client.Domain.Create().SetName("ForeignDomain").Save(ctx)
+	require.NoError(t, err)
+	foreign := createRole(foreignDomain.ID, "Foreign")
+
+	for _, email := range []string{"first@example.com", "second@example.com"} {
+		user, err := client.User.Create().
+			SetName(email).
+			SetEmail(email).
+			SetPasswordHash("hash").
+			SetCurrentDomainID(domain.ID).
+			Save(ctx)
+		require.NoError(t, err)
+		_, err = client.UserDomain.Create().
+			SetUserID(user.ID).
+			SetDomainID(domain.ID).
+			SetRoleID(role.ID).
+			Save(ctx)
+		require.NoError(t, err)
+	}
+
+	t.Run("удаление назначенной роли отклонено", func(t *testing.T) {
+		_, err := usecase.DeleteRole(ctx, role.ID, xid.NilID())
+		inUse := new(RoleInUseError)
+		require.ErrorAs(t, err, &inUse)
+		assert.Equal(t, 2, inUse.Users)
+
+		_, err = client.Role.Get(ctx, role.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("переназначение на роль другого домена", func(t *testing.T) {
+		_, err := usecase.DeleteRole(ctx, role.ID, foreign.ID)
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), RoleReassignDomainMismatchErr.Err().Error())
+	})
+
+	t.Run("удаление с переназначением", func(t *testing.T) {
+		result, err := usecase.DeleteRole(ctx, role.ID, target.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.ReassignedUsers)
+
+		_, err = client.Role.Get(ctx, role.ID)
+		assert.Error(t, err)
+
+		moved, err := client.UserDomain.Query().Where(userdomain.RoleID(target.ID)).Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, moved)
+	})
+}
+
 func TestRolesUsecase_GetDomainsRoles(t *testing.T) {
 	usecase, client, ctx := setupRolesTest(t)
 	defer client.Close()
@@ -167,3 +344,44 @@ func TestRolesUsecase_GetDomainsRoles(t *testing.T) {
 		assert.Len(t, result[0].Roles, 1)
 	})
 }
+
+func TestRolesUsecase_PruneStalePermissions(t *testing.T) {
+	usecase, client, ctx := setupRolesTest(t)
+	defer client.Close()
+	domain := createTestDomain(t, ctx, client)
+
+	known := catalogPermissions(t, 1)
+	role, err := client.Role.Create().
+		SetName("StaleRole").
+		SetDescription("Role with removed permissions").
+		SetPermissions(append([]string{"perm.removed"}, known...)).
+		SetDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	t.Run("отчет без изменений", func(t *testing.T) {
+		stale, err := usecase.PruneStalePermissions(ctx, false)
+		require.NoError(t, err)
+		require.Len(t, stale, 1)
+		assert.Equal(t, role.ID, stale[0].RoleID)
+		assert.Equal(t, []string{"perm.removed"}, stale[0].Permissions)
+
+		stored, err := client.Role.Get(ctx, role.ID)
+		require.NoError(t, err)
+		assert.Contains(t, stored.Permissions, "perm.removed")
+	})
+
+	t.Run("удаление устаревших доступов", func(t *testing.T) {
+		stale, err := usecase.PruneStalePermissions(ctx, true)
+		require.NoError(t, err)
+		require.Len(t, stale, 1)
+
+		stored, err := client.Role.Get(ctx, role.ID)
+		require.NoError(t, err)
+		assert.Equal(t, known, stored.Permissions)
+
+		stale, err = usecase.PruneStalePermissions(ctx, false)
+		require.NoError(t, err)
+		assert.Empty(t, stale)
+	})
+}
@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_toolkit/fault"
+)
+
+// withTx выполняет fn в транзакции: откатывает ее при ошибке или панике и
+// фиксирует в остальных случаях.
+func withTx(ctx context.Context, db *dbauth.Client, fn func(tx *dbauth.Tx) error) error {
+	tx, err := db.Tx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if v := recover(); v != nil {
+			_ = tx.Rollback()
+			panic(v)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil {
+			return fmt.Errorf("%w: rolling back transaction: %v", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// isFault сообщает, что err уже является ошибкой fault и ее можно вернуть клиенту как есть.
+func isFault(err error) bool {
+	f := new(fault.Fault)
+	return errors.As(err, &f)
+}
@@ -3,12 +3,18 @@ package usecase
 import (
 	"context"
 	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth/domain"
 	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth/userdomain"
 	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+	"slices"
+	"time"
 )
 
 // Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
@@ -23,27 +29,57 @@ const (
 	UserDeletionDBErr  fault.Code = "UserDeletionDBErr"  // UserDeletionDBErr: "ошибка удаления пользователя из базы данных"
 	UserNotFoundErr    fault.Code = "UserNotFoundErr"    // UserNotFoundErr: "пользователь не найден"
 	InvalidUserDataErr fault.Code = "InvalidUserDataErr" // InvalidUserDataErr: "некорректные данные пользователя"
+
+	UserStatusConflictErr fault.Code = "UserStatusConflictErr" // UserStatusConflictErr: "действие недоступно в текущем статусе пользователя"
+	UserDeletedStatusErr  fault.Code = "UserDeletedStatusErr"  // UserDeletedStatusErr: "пользователь удален, его можно только восстановить или удалить окончательно"
+	UserPurgeDBErr        fault.Code = "UserPurgeDBErr"        // UserPurgeDBErr: "ошибка окончательного удаления пользователя"
+
+	UserVersionConflictErr fault.Code = "UserVersionConflictErr" // UserVersionConflictErr: "пользователь был изменен другим администратором, обновите данные"
+
+	RoleNotInDomainErr fault.Code = "RoleNotInDomainErr" // RoleNotInDomainErr: "роль принадлежит другому домену"
+	AlreadyMemberErr   fault.Code = "AlreadyMemberErr"   // AlreadyMemberErr: "пользователь уже состоит в домене"
+	NotAMemberErr      fault.Code = "NotAMemberErr"      // NotAMemberErr: "пользователь не состоит в домене"
+	LastMembershipErr  fault.Code = "LastMembershipErr"  // LastMembershipErr: "нельзя исключить пользователя из последнего домена"
 )
 
+func init() {
+	faultstatus.Register(codes.NotFound, UserNotFoundErr)
+	faultstatus.Register(codes.InvalidArgument, InvalidUserDataErr)
+	faultstatus.Register(codes.FailedPrecondition, UserStatusConflictErr, UserDeletedStatusErr, RoleNotInDomainErr, NotAMemberErr, LastMembershipErr)
+	faultstatus.Register(codes.AlreadyExists, AlreadyMemberErr)
+	faultstatus.Register(codes.Aborted, UserVersionConflictErr)
+}
+
 func NewUsersUsecase(db *dbauth.Client) *UsersUsecase {
 	return &UsersUsecase{
-		rep: reporter.InitReporter("UsersUsecase"),
-		db:  db,
+		rep:      reporter.InitReporter("UsersUsecase"),
+		db:       db,
+		rowLocks: true,
 	}
 }
 
 type UsersUsecase struct {
 	rep reporter.Reporter
 	db  *dbauth.Client
+	// rowLocks включает SELECT ... FOR UPDATE при чтении пользователя и его
+	// членств перед изменением. SQLite в тестах блокировки не поддерживает.
+	rowLocks bool
 }
 
-func (u UsersUsecase) AdminGetUsers(ctx context.Context) (dto.UserList, error) {
+// AdminGetUsers возвращает пользователей; удаленные пользователи возвращаются
+// только при includeDeleted.
+func (u UsersUsecase) AdminGetUsers(ctx context.Context, includeDeleted bool) (dto.UserList, error) {
 	ctx, log, end := u.rep.Start(ctx, "AdminGetUsers")
 	defer end()
 
-	users, err := u.db.User.Query().WithUserDomain(func(userDomainQuery *dbauth.UserDomainQuery) {
+	query := u.db.User.Query().WithUserDomain(func(userDomainQuery *dbauth.UserDomainQuery) {
 		userDomainQuery.WithDomain().WithRole()
-	}).All(ctx)
+	})
+	if !includeDeleted {
+		query = query.Where(entUser.StatusNEQ(entUser.StatusDeleted))
+	}
+
+	users, err := query.All(ctx)
 	if err != nil {
 		log.Error().Err(err).Stack().Msg("AdminGetUsers")
 		return nil, UsersGettingDBErr.Err()
@@ -61,13 +97,20 @@ func (u UsersUsecase) CreateUser(ctx context.Context, user *dto.User) (*dto.User
 		return nil, InvalidUserDataErr.Err()
 	}
 
-	created, err := u.db.User.Create().
-		SetName(user.Name).
-		SetEmail(user.Email).
-		SetCurrentDomainID(user.CurrentDomainID).
-		SetPasswordHash("todo: password hash").
-		Save(ctx)
-
+	var created *dbauth.User
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		var err error
+		created, err = tx.User.Create().
+			SetName(user.Name).
+			SetEmail(user.Email).
+			SetCurrentDomainID(user.CurrentDomainID).
+			SetPasswordHash("todo: password hash").
+			Save(ctx)
+		if err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, outbox.UserCreated, created.ID.String(), outbox.User(created))
+	})
 	if err != nil {
 		log.Err(err).Stack().Msg("failed to create user")
 		return nil, UserCreationDBErr.Err()
@@ -85,13 +128,47 @@ func (u UsersUsecase) UpdateUser(ctx context.Context, user *dto.User) (*dto.User
 		return nil, InvalidUserDataErr.Err()
 	}
 
-	updated, err := u.db.User.UpdateOneID(user.ID).
-		SetName(user.Name).
-		SetEmail(user.Email).
-		SetCurrentDomainID(user.CurrentDomainID).
-		Save(ctx)
-
+	var updated *dbauth.User
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		current, err := u.lockUser(ctx, tx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		update := tx.User.UpdateOneID(user.ID).
+			SetName(user.Name).
+			SetEmail(user.Email).
+			AddVersion(1)
+		if user.Version != 0 {
+			update = update.Where(entUser.Version(user.Version))
+		}
+
+		// Текущим можно сделать только домен, в котором пользователь состоит.
+		if !user.CurrentDomainID.IsNil() && current.CurrentDomainID != user.CurrentDomainID {
+			memberships, err := u.lockMemberships(ctx, tx, user.ID)
+			if err != nil {
+				return err
+			}
+			if !slices.ContainsFunc(memberships, inDomain(user.CurrentDomainID)) {
+				return NotAMemberErr.Err()
+			}
+			update = update.SetCurrentDomainID(user.CurrentDomainID)
+		}
+
+		if updated, err = update.Save(ctx); err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, outbox.UserUpdated, updated.ID.String(), outbox.User(updated))
+	})
 	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Msg("user update rejected")
+			return nil, err
+		}
+		if dbauth.IsNotFound(err) {
+			// Пользователь изменен после чтения версии клиентом.
+			return nil, u.userConflict(ctx, user.ID)
+		}
 		log.Err(err).Stack().Msg("failed to update user")
 		return nil, UserUpdateDBErr.Err()
 	}
@@ -99,6 +176,25 @@ func (u UsersUsecase) UpdateUser(ctx context.Context, user *dto.User) (*dto.User
 	return new(dto.User).FromEnt(updated), nil
 }
 
+func (u UsersUsecase) userConflict(ctx context.Context, userID xid.ID) error {
+	current, err := u.db.User.Query().
+		Where(entUser.ID(userID)).
+		WithUserDomain(func(query *dbauth.UserDomainQuery) {
+			query.WithDomain().WithRole()
+		}).
+		Only(ctx)
+	if err != nil {
+		if dbauth.IsNotFound(err) {
+			return UserNotFoundErr.Err()
+		}
+		return UserUpdateDBErr.Err()
+	}
+	return newVersionConflictError(UserVersionConflictErr, new(dto.User).FromEnt(current).ToProto())
+}
+
+// DeleteUser помечает пользователя удаленным, сохраняя запись и членство в
+// доменах. Удаленного пользователя можно восстановить через RestoreUser или
+// окончательно удалить через PurgeUser.
 func (u UsersUsecase) DeleteUser(ctx context.Context, user *dto.User) error {
 	ctx, log, end := u.rep.Start(ctx, "DeleteUser")
 	defer end()
@@ -108,8 +204,11 @@ func (u UsersUsecase) DeleteUser(ctx context.Context, user *dto.User) error {
 		return InvalidUserDataErr.Err()
 	}
 
-	err := u.db.User.DeleteOneID(user.ID).Exec(ctx)
+	_, err := u.setStatus(ctx, user.ID, entUser.StatusDeleted)
 	if err != nil {
+		if isFault(err) {
+			return err
+		}
 		log.Err(err).Stack().Msg("failed to delete user")
 		return UserDeletionDBErr.Err()
 	}
@@ -117,46 +216,231 @@ func (u UsersUsecase) DeleteUser(ctx context.Context, user *dto.User) error {
 	return nil
 }
 
-func (u UsersUsecase) AssignUserToDomain(ctx context.Context, userID, domainID, roleID xid.ID) (*dto.User, error) {
-	ctx, log, end := u.rep.Start(ctx, "AssignUserToDomain")
+// DisableUser блокирует пользователя: вход, обновление токенов и авторизация
+// отклоняются, пока пользователь не будет восстановлен.
+func (u UsersUsecase) DisableUser(ctx context.Context, userID xid.ID) (*dto.User, error) {
+	ctx, log, end := u.rep.Start(ctx, "DisableUser")
 	defer end()
 
-	user, err := u.db.User.Query().Where(entUser.ID(userID)).Only(ctx)
+	user, err := u.setStatus(ctx, userID, entUser.StatusDisabled)
 	if err != nil {
-		log.Err(err).Stack().Msg("failed to find user")
-		return nil, UserNotFoundErr.Err()
+		if isFault(err) {
+			return nil, err
+		}
+		log.Err(err).Stack().Msg("failed to disable user")
+		return nil, UserUpdateDBErr.Err()
 	}
 
-	_, err = u.db.UserDomain.Create().
-		SetUserID(userID).
-		SetDomainID(domainID).
-		SetRoleID(roleID).
-		Save(ctx)
+	return new(dto.User).FromEnt(user), nil
+}
+
+// RestoreUser возвращает заблокированного или удаленного пользователя в
+// активный статус.
+func (u UsersUsecase) RestoreUser(ctx context.Context, userID xid.ID) (*dto.User, error) {
+	ctx, log, end := u.rep.Start(ctx, "RestoreUser")
+	defer end()
 
+	user, err := u.setStatus(ctx, userID, entUser.StatusActive)
 	if err != nil {
-		log.Err(err).Stack().Msg("failed to assign user to domain")
+		if isFault(err) {
+			return nil, err
+		}
+		log.Err(err).Stack().Msg("failed to restore user")
 		return nil, UserUpdateDBErr.Err()
 	}
 
 	return new(dto.User).FromEnt(user), nil
 }
 
-func (u UsersUsecase) RemoveUserFromDomain(ctx context.Context, userID, domainID xid.ID) (*dto.User, error) {
-	ctx, log, end := u.rep.Start(ctx, "RemoveUserFromDomain")
+// PurgeUser окончательно удаляет пользователя вместе с членством в доменах.
+// Удалить можно только пользователя, ранее помеченного удаленным.
+func (u UsersUsecase) PurgeUser(ctx context.Context, userID xid.ID) error {
+	ctx, log, end := u.rep.Start(ctx, "PurgeUser")
 	defer end()
 
-	user, err := u.db.User.Query().Where(entUser.ID(userID)).Only(ctx)
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		user, err := u.lockUser(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.Status != entUser.StatusDeleted {
+			return UserStatusConflictErr.Err()
+		}
+		if _, err := tx.UserDomain.Delete().Where(userdomain.UserID(userID)).Exec(ctx); err != nil {
+			return err
+		}
+		if err := tx.User.DeleteOneID(userID).Exec(ctx); err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, outbox.UserPurged, userID.String(), outbox.User(user))
+	})
 	if err != nil {
-		log.Err(err).Stack().Msg("failed to find user")
-		return nil, UserNotFoundErr.Err()
+		if isFault(err) {
+			log.Warn().Err(err).Msg("user purge rejected")
+			return err
+		}
+		log.Err(err).Stack().Msg("failed to purge user")
+		return UserPurgeDBErr.Err()
 	}
 
-	_, err = u.db.UserDomain.Delete().
-		Where(userdomain.UserID(userID)).
-		Where(userdomain.DomainID(domainID)).
-		Exec(ctx)
+	return nil
+}
+
+// setStatus переводит пользователя в статус status, проставляя или очищая
+// соответствующие отметки времени. Повторный перевод в тот же статус - ошибка.
+// Удаленного пользователя можно только восстановить: блокировка оставила бы
+// его с DeletedAt, но вернула бы в списки пользователей.
+func (u UsersUsecase) setStatus(ctx context.Context, userID xid.ID, status entUser.Status) (*dbauth.User, error) {
+	var updated *dbauth.User
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		user, err := tx.User.Get(ctx, userID)
+		if err != nil {
+			if dbauth.IsNotFound(err) {
+				return UserNotFoundErr.Err()
+			}
+			return err
+		}
+		if user.Status == status {
+			return UserStatusConflictErr.Err()
+		}
+		if user.Status == entUser.StatusDeleted && status != entUser.StatusActive {
+			return UserDeletedStatusErr.Err()
+		}
+
+		now := time.Now()
+		update := tx.User.UpdateOne(user).SetStatus(status).AddVersion(1)
+		eventType := outbox.UserRestored
+		switch status {
+		case entUser.StatusActive:
+			update = update.ClearDisabledAt().ClearDeletedAt()
+		case entUser.StatusDisabled:
+			update = update.SetDisabledAt(now)
+			eventType = outbox.UserDisabled
+		case entUser.StatusDeleted:
+			update = update.SetDeletedAt(now)
+			eventType = outbox.UserDeleted
+		}
+
+		if updated, err = update.Save(ctx); err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, eventType, updated.ID.String(), outbox.User(updated))
+	})
+	return updated, err
+}
+
+// AssignUserToDomain добавляет пользователя в домен с ролью этого домена.
+// Пользователь, у которого текущий домен не входит в его членства, переводится
+// в новый домен.
+func (u UsersUsecase) AssignUserToDomain(ctx context.Context, userID, domainID, roleID xid.ID) (*dto.User, error) {
+	ctx, log, end := u.rep.Start(ctx, "AssignUserToDomain")
+	defer end()
+
+	var user *dbauth.User
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		var err error
+		if user, err = u.lockUser(ctx, tx, userID); err != nil {
+			return err
+		}
+		if err := checkRoleInDomain(ctx, tx, domainID, roleID); err != nil {
+			return err
+		}
+
+		memberships, err := u.lockMemberships(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(memberships, inDomain(domainID)) {
+			return AlreadyMemberErr.Err()
+		}
+
+		if err := tx.UserDomain.Create().
+			SetUserID(userID).
+			SetDomainID(domainID).
+			SetRoleID(roleID).
+			Exec(ctx); err != nil {
+			if dbauth.IsConstraintError(err) {
+				// Членство создано параллельным запросом.
+				return AlreadyMemberErr.Err()
+			}
+			return err
+		}
+		if err := outbox.Write(ctx, tx, outbox.MembershipAssigned, userID.String(), outbox.MembershipData{
+			UserID:   userID.String(),
+			DomainID: domainID.String(),
+			RoleID:   roleID.String(),
+		}); err != nil {
+			return err
+		}
+
+		if slices.ContainsFunc(memberships, inDomain(user.CurrentDomainID)) {
+			return nil
+		}
+		user, err = setCurrentDomain(ctx, tx, user, domainID)
+		return err
+	})
+	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Msg("assignment rejected")
+			return nil, err
+		}
+		log.Err(err).Stack().Msg("failed to assign user to domain")
+		return nil, UserUpdateDBErr.Err()
+	}
+
+	return new(dto.User).FromEnt(user), nil
+}
+
+// RemoveUserFromDomain исключает пользователя из домена. Если домен был
+// текущим, текущим становится другой домен пользователя. Последнее членство
+// исключить нельзя: текущий домен пользователя обязателен, а без членств он
+// указывал бы на домен, в котором пользователь уже не состоит.
+func (u UsersUsecase) RemoveUserFromDomain(ctx context.Context, userID, domainID xid.ID) (*dto.User, error) {
+	ctx, log, end := u.rep.Start(ctx, "RemoveUserFromDomain")
+	defer end()
 
+	var user *dbauth.User
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		var err error
+		if user, err = u.lockUser(ctx, tx, userID); err != nil {
+			return err
+		}
+		memberships, err := u.lockMemberships(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(memberships, inDomain(domainID))
+		if i < 0 {
+			return NotAMemberErr.Err()
+		}
+		if len(memberships) == 1 {
+			return LastMembershipErr.Err()
+		}
+
+		if _, err := tx.UserDomain.Delete().
+			Where(userdomain.UserID(userID), userdomain.DomainID(domainID)).
+			Exec(ctx); err != nil {
+			return err
+		}
+		if err := outbox.Write(ctx, tx, outbox.MembershipRemoved, userID.String(), outbox.MembershipData{
+			UserID:   userID.String(),
+			DomainID: domainID.String(),
+		}); err != nil {
+			return err
+		}
+
+		memberships = slices.Delete(memberships, i, i+1)
+		if user.CurrentDomainID != domainID {
+			return nil
+		}
+		user, err = setCurrentDomain(ctx, tx, user, memberships[0].DomainID)
+		return err
+	})
 	if err != nil {
+		if isFault(err) {
+			log.Warn().Err(err).Msg("removal rejected")
+			return nil, err
+		}
 		log.Err(err).Stack().Msg("failed to remove user from domain")
 		return nil, UserUpdateDBErr.Err()
 	}
@@ -164,26 +448,115 @@ func (u UsersUsecase) RemoveUserFromDomain(ctx context.Context, userID, domainID
 	return new(dto.User).FromEnt(user), nil
 }
 
+// UpdateRole меняет роль пользователя в домене на роль этого же домена.
 func (u UsersUsecase) UpdateRole(ctx context.Context, userID, domainID, roleID xid.ID) (*dto.User, error) {
 	ctx, log, end := u.rep.Start(ctx, "UpdateRole")
 	defer end()
 
-	user, err := u.db.User.Query().Where(entUser.ID(userID)).Only(ctx)
+	var user *dbauth.User
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		var err error
+		if user, err = u.lockUser(ctx, tx, userID); err != nil {
+			return err
+		}
+		if err := checkRoleInDomain(ctx, tx, domainID, roleID); err != nil {
+			return err
+		}
+
+		memberships, err := u.lockMemberships(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(memberships, inDomain(domainID))
+		if i < 0 {
+			return NotAMemberErr.Err()
+		}
+		membership := memberships[i]
+		if membership.RoleID == roleID {
+			return nil
+		}
+
+		if err := tx.UserDomain.UpdateOne(membership).SetRoleID(roleID).Exec(ctx); err != nil {
+			return err
+		}
+		return outbox.Write(ctx, tx, outbox.MembershipChanged, userID.String(), outbox.MembershipData{
+			UserID:         userID.String(),
+			DomainID:       domainID.String(),
+			RoleID:         roleID.String(),
+			PreviousRoleID: membership.RoleID.String(),
+		})
+	})
 	if err != nil {
-		log.Err(err).Stack().Msg("failed to find user")
+		if isFault(err) {
+			log.Warn().Err(err).Msg("role update rejected")
+			return nil, err
+		}
+		log.Err(err).Stack().Msg("failed to update user role")
+		return nil, UserUpdateDBErr.Err()
+	}
+
+	return new(dto.User).FromEnt(user), nil
+}
+
+// lockUser читает пользователя, блокируя строку до конца транзакции, чтобы
+// проверки по ней не устарели к моменту изменения.
+func (u UsersUsecase) lockUser(ctx context.Context, tx *dbauth.Tx, userID xid.ID) (*dbauth.User, error) {
+	query := tx.User.Query().Where(entUser.ID(userID))
+	if u.rowLocks {
+		query = query.ForUpdate()
+	}
+	user, err := query.Only(ctx)
+	if dbauth.IsNotFound(err) {
 		return nil, UserNotFoundErr.Err()
 	}
+	return user, err
+}
 
-	_, err = u.db.UserDomain.Update().
+// lockMemberships читает членства пользователя в порядке доменов, блокируя
+// строки до конца транзакции.
+func (u UsersUsecase) lockMemberships(ctx context.Context, tx *dbauth.Tx, userID xid.ID) ([]*dbauth.UserDomain, error) {
+	query := tx.UserDomain.Query().
 		Where(userdomain.UserID(userID)).
-		Where(userdomain.DomainID(domainID)).
-		SetRoleID(roleID).
-		Save(ctx)
+		Order(userdomain.ByDomainID())
+	if u.rowLocks {
+		query = query.ForUpdate()
+	}
+	return query.All(ctx)
+}
 
+func inDomain(domainID xid.ID) func(*dbauth.UserDomain) bool {
+	return func(membership *dbauth.UserDomain) bool {
+		return membership.DomainID == domainID
+	}
+}
+
+// checkRoleInDomain проверяет, что домен и роль существуют и роль принадлежит домену.
+func checkRoleInDomain(ctx context.Context, tx *dbauth.Tx, domainID, roleID xid.ID) error {
+	exists, err := tx.Domain.Query().Where(domain.ID(domainID)).Exist(ctx)
 	if err != nil {
-		log.Err(err).Stack().Msg("failed to update user role")
-		return nil, UserUpdateDBErr.Err()
+		return err
+	}
+	if !exists {
+		return DomainNotFoundErr.Err()
 	}
 
-	return new(dto.User).FromEnt(user), nil
+	role, err := tx.Role.Get(ctx, roleID)
+	if err != nil {
+		if dbauth.IsNotFound(err) {
+			return RoleNotFoundErr.Err()
+		}
+		return err
+	}
+	if role.DomainID != domainID {
+		return RoleNotInDomainErr.Err()
+	}
+	return nil
+}
+
+func setCurrentDomain(ctx context.Context, tx *dbauth.Tx, user *dbauth.User, domainID xid.ID) (*dbauth.User, error) {
+	updated, err := tx.User.UpdateOne(user).SetCurrentDomainID(domainID).AddVersion(1).Save(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return updated, outbox.Write(ctx, tx, outbox.UserUpdated, updated.ID.String(), outbox.User(updated))
 }
@@ -2,9 +2,13 @@ package usecase
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
 	"github.com/hughbliss/my_database/pkg/dbauthclient"
 	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entOutbox "github.com/hughbliss/my_database/pkg/gen/dbauth/outboxevent"
+	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
 	"github.com/hughbliss/my_toolkit/fault"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/rs/xid"
@@ -47,6 +51,12 @@ func createTestUserData(t *testing.T, ctx context.Context, client *dbauth.Client
 	return domain, role, user
 }
 
+func assertFault(t *testing.T, err error, code fault.Code) {
+	f := new(fault.Fault)
+	require.ErrorAs(t, err, &f)
+	assert.Equal(t, f.Error(), code.Err().Error())
+}
+
 func TestUsersUsecase_AdminGetUsers(t *testing.T) {
 	usecase, client, ctx := setupUsersTest(t)
 	defer client.Close()
@@ -61,12 +71,24 @@ func TestUsersUsecase_AdminGetUsers(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("успешное получение пользователей", func(t *testing.T) {
-		users, err := usecase.AdminGetUsers(ctx)
+		users, err := usecase.AdminGetUsers(ctx, false)
 		require.NoError(t, err)
 		assert.NotNil(t, users)
 		assert.Len(t, users, 1)
 		assert.Equal(t, user.Name, users[0].Name)
 	})
+
+	t.Run("удаленные пользователи скрыты", func(t *testing.T) {
+		require.NoError(t, usecase.DeleteUser(ctx, &dto.User{User: dbauth.User{ID: user.ID}}))
+
+		users, err := usecase.AdminGetUsers(ctx, false)
+		require.NoError(t, err)
+		assert.Empty(t, users)
+
+		users, err = usecase.AdminGetUsers(ctx, true)
+		require.NoError(t, err)
+		assert.Len(t, users, 1)
+	})
 }
 
 func TestUsersUsecase_CreateUser(t *testing.T) {
@@ -130,6 +152,76 @@ func TestUsersUsecase_UpdateUser(t *testing.T) {
 		assert.Equal(t, updateUser.Email, result.Email)
 	})
 
+	t.Run("конфликт версий", func(t *testing.T) {
+		current, err := client.User.Get(ctx, user.ID)
+		require.NoError(t, err)
+
+		stale := &dto.User{
+			User: dbauth.User{
+				ID:              user.ID,
+				Name:            "StaleUser",
+				Email:           "stale@example.com",
+				CurrentDomainID: domain.ID,
+				Version:         current.Version + 1,
+			},
+		}
+		_, err = usecase.UpdateUser(ctx, stale)
+		conflict := new(VersionConflictError)
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, UserVersionConflictErr.Err().Error(), conflict.Error())
+		require.NotNil(t, conflict.Current)
+
+		stale.Version = current.Version
+		result, err := usecase.UpdateUser(ctx, stale)
+		require.NoError(t, err)
+		assert.Equal(t, current.Version+1, result.Version)
+	})
+
+	t.Run("устаревшая версия нового пользователя", func(t *testing.T) {
+		fresh, err := client.User.Create().
+			SetName("FreshUser").
+			SetEmail("fresh@example.com").
+			SetPasswordHash("hash").
+			SetCurrentDomainID(domain.ID).
+			Save(ctx)
+		require.NoError(t, err)
+		require.Equal(t, 1, fresh.Version)
+
+		// Два администратора открыли пользователя с версией 1, первый сохранил
+		// изменения.
+		edit := func(name string) *dto.User {
+			return &dto.User{User: dbauth.User{
+				ID:              fresh.ID,
+				Name:            name,
+				Email:           fresh.Email,
+				CurrentDomainID: domain.ID,
+				Version:         fresh.Version,
+			}}
+		}
+		_, err = usecase.UpdateUser(ctx, edit("FirstAdmin"))
+		require.NoError(t, err)
+
+		_, err = usecase.UpdateUser(ctx, edit("SecondAdmin"))
+		conflict := new(VersionConflictError)
+		require.ErrorAs(t, err, &conflict)
+		assert.Equal(t, UserVersionConflictErr.Err().Error(), conflict.Error())
+	})
+
+	t.Run("текущий домен вне членства", func(t *testing.T) {
+		other, err := client.Domain.Create().SetName("OtherDomain").Save(ctx)
+		require.NoError(t, err)
+
+		_, err = usecase.UpdateUser(ctx, &dto.User{
+			User: dbauth.User{
+				ID:              user.ID,
+				Name:            "UpdatedUser",
+				Email:           "updated@example.com",
+				CurrentDomainID: other.ID,
+			},
+		})
+		assertFault(t, err, NotAMemberErr)
+	})
+
 	t.Run("некорректные данные пользователя", func(t *testing.T) {
 		invalidUser := &dto.User{
 			User: dbauth.User{
@@ -157,9 +249,18 @@ func TestUsersUsecase_DeleteUser(t *testing.T) {
 		err := usecase.DeleteUser(ctx, &dto.User{User: dbauth.User{ID: user.ID}})
 		require.NoError(t, err)
 
-		// Проверяем что пользователь действительно удален
-		_, err = client.User.Get(ctx, user.ID)
-		assert.Error(t, err)
+		// Проверяем что пользователь помечен удаленным, но запись сохранена
+		deleted, err := client.User.Get(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, entUser.StatusDeleted, deleted.Status)
+		assert.NotNil(t, deleted.DeletedAt)
+	})
+
+	t.Run("повторное удаление", func(t *testing.T) {
+		err := usecase.DeleteUser(ctx, &dto.User{User: dbauth.User{ID: user.ID}})
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), UserStatusConflictErr.Err().Error())
 	})
 
 	t.Run("некорректный ID пользователя", func(t *testing.T) {
@@ -171,6 +272,70 @@ func TestUsersUsecase_DeleteUser(t *testing.T) {
 	})
 }
 
+func TestUsersUsecase_UserStatus(t *testing.T) {
+	usecase, client, ctx := setupUsersTest(t)
+	defer client.Close()
+
+	domain, role, user := createTestUserData(t, ctx, client)
+	_, err := client.UserDomain.Create().
+		SetUserID(user.ID).
+		SetDomainID(domain.ID).
+		SetRoleID(role.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	t.Run("блокировка пользователя", func(t *testing.T) {
+		result, err := usecase.DisableUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, entUser.StatusDisabled, result.Status)
+		assert.NotNil(t, result.DisabledAt)
+
+		_, err = usecase.DisableUser(ctx, user.ID)
+		assertFault(t, err, UserStatusConflictErr)
+	})
+
+	t.Run("восстановление пользователя", func(t *testing.T) {
+		result, err := usecase.RestoreUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, entUser.StatusActive, result.Status)
+		assert.Nil(t, result.DisabledAt)
+		assert.Nil(t, result.DeletedAt)
+	})
+
+	t.Run("удаленного пользователя нельзя заблокировать", func(t *testing.T) {
+		require.NoError(t, usecase.DeleteUser(ctx, &dto.User{User: dbauth.User{ID: user.ID}}))
+
+		_, err := usecase.DisableUser(ctx, user.ID)
+		assertFault(t, err, UserDeletedStatusErr)
+
+		stored, err := client.User.Get(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, entUser.StatusDeleted, stored.Status)
+
+		_, err = usecase.RestoreUser(ctx, user.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("окончательное удаление только удаленного пользователя", func(t *testing.T) {
+		assertFault(t, usecase.PurgeUser(ctx, user.ID), UserStatusConflictErr)
+
+		require.NoError(t, usecase.DeleteUser(ctx, &dto.User{User: dbauth.User{ID: user.ID}}))
+		require.NoError(t, usecase.PurgeUser(ctx, user.ID))
+
+		_, err := client.User.Get(ctx, user.ID)
+		assert.True(t, dbauth.IsNotFound(err))
+		memberships, err := client.UserDomain.Query().Count(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, memberships)
+	})
+
+	t.Run("пользователь не найден", func(t *testing.T) {
+		_, err := usecase.DisableUser(ctx, xid.New())
+		assertFault(t, err, UserNotFoundErr)
+		assertFault(t, usecase.PurgeUser(ctx, xid.New()), UserNotFoundErr)
+	})
+}
+
 func TestUsersUsecase_AssignUserToDomain(t *testing.T) {
 	usecase, client, ctx := setupUsersTest(t)
 	defer client.Close()
@@ -182,6 +347,10 @@ func TestUsersUsecase_AssignUserToDomain(t *testing.T) {
 		require.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Equal(t, user.Name, result.Name)
+
+		event, err := client.OutboxEvent.Query().Where(entOutbox.Type(outbox.MembershipAssigned)).Only(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID.String(), event.Subject)
 	})
 
 	t.Run("пользователь не найден", func(t *testing.T) {
@@ -191,6 +360,68 @@ func TestUsersUsecase_AssignUserToDomain(t *testing.T) {
 		assert.ErrorAs(t, err, &f)
 		assert.Equal(t, f.Error(), UserNotFoundErr.Err().Error())
 	})
+
+	t.Run("повторное назначение", func(t *testing.T) {
+		_, err := usecase.AssignUserToDomain(ctx, user.ID, domain.ID, role.ID)
+		assertFault(t, err, AlreadyMemberErr)
+	})
+
+	other, err := client.Domain.Create().SetName("OtherDomain").Save(ctx)
+	require.NoError(t, err)
+	otherRole, err := client.Role.Create().
+		SetName("OtherRole").
+		SetDescription("OtherRole").
+		SetPermissions([]string{"read"}).
+		SetDomainID(other.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	t.Run("роль другого домена", func(t *testing.T) {
+		_, err := usecase.AssignUserToDomain(ctx, user.ID, other.ID, role.ID)
+		assertFault(t, err, RoleNotInDomainErr)
+	})
+
+	t.Run("домен не найден", func(t *testing.T) {
+		_, err := usecase.AssignUserToDomain(ctx, user.ID, xid.New(), role.ID)
+		assertFault(t, err, DomainNotFoundErr)
+	})
+
+	t.Run("исключение из текущего домена", func(t *testing.T) {
+		result, err := usecase.AssignUserToDomain(ctx, user.ID, other.ID, otherRole.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.ID, result.CurrentDomainID)
+
+		result, err = usecase.RemoveUserFromDomain(ctx, user.ID, domain.ID)
+		require.NoError(t, err)
+		assert.Equal(t, other.ID, result.CurrentDomainID)
+
+		_, err = usecase.RemoveUserFromDomain(ctx, user.ID, domain.ID)
+		assertFault(t, err, NotAMemberErr)
+	})
+
+	t.Run("последнее членство не исключается", func(t *testing.T) {
+		_, err := usecase.RemoveUserFromDomain(ctx, user.ID, other.ID)
+		assertFault(t, err, LastMembershipErr)
+
+		stored, err := client.User.Get(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, other.ID, stored.CurrentDomainID)
+	})
+
+	t.Run("назначение без текущего членства", func(t *testing.T) {
+		// Пользователь создан с текущим доменом, но без членства в нем.
+		orphan, err := client.User.Create().
+			SetName("orphan").
+			SetEmail("orphan@example.com").
+			SetPasswordHash("hash").
+			SetCurrentDomainID(domain.ID).
+			Save(ctx)
+		require.NoError(t, err)
+
+		result, err := usecase.AssignUserToDomain(ctx, orphan.ID, other.ID, otherRole.ID)
+		require.NoError(t, err)
+		assert.Equal(t, other.ID, result.CurrentDomainID)
+	})
 }
 
 func TestUsersUsecase_UpdateRole(t *testing.T) {
@@ -219,6 +450,31 @@ func TestUsersUsecase_UpdateRole(t *testing.T) {
 		require.NoError(t, err)
 		assert.NotNil(t, result)
 		assert.Equal(t, user.Name, result.Name)
+
+		event, err := client.OutboxEvent.Query().Where(entOutbox.Type(outbox.MembershipChanged)).Only(ctx)
+		require.NoError(t, err)
+		var data outbox.MembershipData
+		require.NoError(t, json.Unmarshal(event.Data, &data))
+		assert.Equal(t, newRole.ID.String(), data.RoleID)
+		assert.Equal(t, role.ID.String(), data.PreviousRoleID)
+	})
+
+	t.Run("роль другого домена", func(t *testing.T) {
+		other, err := client.Domain.Create().SetName("OtherDomain").Save(ctx)
+		require.NoError(t, err)
+		otherRole, err := client.Role.Create().
+			SetName("OtherRole").
+			SetDescription("OtherRole").
+			SetPermissions([]string{"read"}).
+			SetDomainID(other.ID).
+			Save(ctx)
+		require.NoError(t, err)
+
+		_, err = usecase.UpdateRole(ctx, user.ID, domain.ID, otherRole.ID)
+		assertFault(t, err, RoleNotInDomainErr)
+
+		_, err = usecase.UpdateRole(ctx, user.ID, other.ID, otherRole.ID)
+		assertFault(t, err, NotAMemberErr)
 	})
 
 	t.Run("пользователь не найден", func(t *testing.T) {
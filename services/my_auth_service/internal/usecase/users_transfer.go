@@ -0,0 +1,305 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	"github.com/hughbliss/my_auth_service/internal/outbox"
+	"github.com/hughbliss/my_database/pkg/gen/dbauth"
+	entDomain "github.com/hughbliss/my_database/pkg/gen/dbauth/domain"
+	entRole "github.com/hughbliss/my_database/pkg/gen/dbauth/role"
+	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/rs/xid"
+	"google.golang.org/grpc/codes"
+	"net/mail"
+	"strings"
+)
+
+// Документация к ошибкам должна быть такой, чтобы она была валидна для вставки в
+// ru.yaml и при этом удовлетворяла go-doc. Начало комментария должно
+// соответствовать названию сущности, затем двоеточие и тело комментария
+// обернутое в двойные кавычки
+
+const (
+	InvalidImportErr        fault.Code = "InvalidImportErr"        // InvalidImportErr: "некорректный файл импорта пользователей"
+	UserImportDBErr         fault.Code = "UserImportDBErr"         // UserImportDBErr: "ошибка импорта пользователей в базу данных"
+	ImportDuplicateEmailErr fault.Code = "ImportDuplicateEmailErr" // ImportDuplicateEmailErr: "email уже встречался в файле импорта"
+	UserExportDBErr         fault.Code = "UserExportDBErr"         // UserExportDBErr: "ошибка выгрузки пользователей из базы данных"
+)
+
+func init() {
+	faultstatus.Register(codes.InvalidArgument, InvalidImportErr, ImportDuplicateEmailErr)
+}
+
+const (
+	// MaxImportRows максимальное число строк в одном импорте.
+	MaxImportRows = 10_000
+
+	exportBatchSize = 500
+
+	// importedPasswordHash заведомо невалидный bcrypt хэш: импортированный
+	// пользователь не может войти, пока ему не зададут пароль.
+	importedPasswordHash = "!"
+)
+
+// errDryRun откатывает транзакцию пробного импорта.
+var errDryRun = errors.New("dry run")
+
+// ImportUsers создает или обновляет пользователей по email и назначает им роль
+// в домене. Строки с ошибками пропускаются и попадают в отчет, остальные
+// применяются в одной транзакции. При dryRun транзакция откатывается.
+func (u UsersUsecase) ImportUsers(ctx context.Context, records []*dto.ImportRecord, dryRun bool) (*dto.ImportReport, error) {
+	ctx, log, end := u.rep.Start(ctx, "ImportUsers")
+	defer end()
+
+	if len(records) == 0 || len(records) > MaxImportRows {
+		log.Warn().Int("rows", len(records)).Msg("invalid import size")
+		return nil, InvalidImportErr.Err()
+	}
+
+	report := &dto.ImportReport{DryRun: dryRun}
+	err := withTx(ctx, u.db, func(tx *dbauth.Tx) error {
+		importer := &userImporter{
+			tx:      tx,
+			domains: map[string]*dbauth.Domain{},
+			roles:   map[string]*dbauth.Role{},
+			emails:  map[string]int{},
+		}
+		report.Results = make([]*dto.ImportResult, 0, len(records))
+		for _, record := range records {
+			result, err := importer.importRecord(ctx, record)
+			if err != nil {
+				return err
+			}
+			report.Results = append(report.Results, result)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		log.Err(err).Stack().Msg("failed to import users")
+		return nil, UserImportDBErr.Err()
+	}
+
+	log.Info().Int("rows", len(records)).Bool("dry_run", dryRun).Msg("users imported")
+	return report, nil
+}
+
+type userImporter struct {
+	tx      *dbauth.Tx
+	domains map[string]*dbauth.Domain
+	roles   map[string]*dbauth.Role
+	emails  map[string]int
+}
+
+// importRecord обрабатывает строку. Ошибка данных строки возвращается в
+// результате, ошибка базы данных прерывает импорт.
+func (i *userImporter) importRecord(ctx context.Context, record *dto.ImportRecord) (*dto.ImportResult, error) {
+	email := strings.ToLower(strings.TrimSpace(record.Email))
+	name := strings.TrimSpace(record.Name)
+	result := &dto.ImportResult{Row: record.Row, Email: email}
+
+	reject := func(code fault.Code) (*dto.ImportResult, error) {
+		result.Action = dto.ImportFailed
+		result.ErrorCode = string(code)
+		result.Error = code.Err().Error()
+		return result, nil
+	}
+
+	if _, err := mail.ParseAddress(email); err != nil || name == "" {
+		return reject(InvalidUserDataErr)
+	}
+	if _, ok := i.emails[email]; ok {
+		return reject(ImportDuplicateEmailErr)
+	}
+	i.emails[email] = record.Row
+
+	domain, err := i.domain(ctx, strings.TrimSpace(record.Domain))
+	if err != nil {
+		if dbauth.IsNotFound(err) {
+			return reject(DomainNotFoundErr)
+		}
+		return nil, err
+	}
+	role, err := i.role(ctx, domain, strings.TrimSpace(record.Role))
+	if err != nil {
+		if dbauth.IsNotFound(err) {
+			return reject(RoleNotFoundErr)
+		}
+		return nil, err
+	}
+
+	// Email существующих пользователей мог быть сохранен без приведения к
+	// нижнему регистру.
+	user, err := i.tx.User.Query().
+		Where(entUser.EmailEqualFold(email)).
+		WithUserDomain().
+		Only(ctx)
+	if err != nil && !dbauth.IsNotFound(err) {
+		return nil, err
+	}
+
+	if user == nil {
+		created, err := i.tx.User.Create().
+			SetEmail(email).
+			SetName(name).
+			SetPasswordHash(importedPasswordHash).
+			SetCurrentDomainID(domain.ID).
+			Save(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := outbox.Write(ctx, i.tx, outbox.UserCreated, created.ID.String(), outbox.User(created)); err != nil {
+			return nil, err
+		}
+		if err := i.assign(ctx, created, domain, role); err != nil {
+			return nil, err
+		}
+		result.Action = dto.ImportCreated
+		result.UserID = created.ID
+		return result, nil
+	}
+
+	result.UserID = user.ID
+	if user.Status == entUser.StatusDeleted {
+		return reject(UserStatusConflictErr)
+	}
+
+	result.Action = dto.ImportUnchanged
+	if user.Name != name {
+		updated, err := i.tx.User.UpdateOne(user).SetName(name).AddVersion(1).Save(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := outbox.Write(ctx, i.tx, outbox.UserUpdated, updated.ID.String(), outbox.User(updated)); err != nil {
+			return nil, err
+		}
+		result.Action = dto.ImportUpdated
+	}
+
+	for _, membership := range user.Edges.UserDomain {
+		if membership.DomainID != domain.ID {
+			continue
+		}
+		if membership.RoleID != role.ID {
+			if err := i.tx.UserDomain.UpdateOne(membership).SetRoleID(role.ID).Exec(ctx); err != nil {
+				return nil, err
+			}
+			if err := outbox.Write(ctx, i.tx, outbox.MembershipChanged, user.ID.String(), outbox.MembershipData{
+				UserID:         user.ID.String(),
+				DomainID:       domain.ID.String(),
+				RoleID:         role.ID.String(),
+				PreviousRoleID: membership.RoleID.String(),
+			}); err != nil {
+				return nil, err
+			}
+			result.Action = dto.ImportUpdated
+		}
+		return result, nil
+	}
+
+	if err := i.assign(ctx, user, domain, role); err != nil {
+		return nil, err
+	}
+	result.Action = dto.ImportUpdated
+	return result, nil
+}
+
+// assign добавляет пользователя в домен с ролью.
+func (i *userImporter) assign(ctx context.Context, user *dbauth.User, domain *dbauth.Domain, role *dbauth.Role) error {
+	if err := i.tx.UserDomain.Create().
+		SetUserID(user.ID).
+		SetDomainID(domain.ID).
+		SetRoleID(role.ID).
+		Exec(ctx); err != nil {
+		return err
+	}
+	return outbox.Write(ctx, i.tx, outbox.MembershipAssigned, user.ID.String(), outbox.MembershipData{
+		UserID:   user.ID.String(),
+		DomainID: domain.ID.String(),
+		RoleID:   role.ID.String(),
+	})
+}
+
+// domain находит домен по идентификатору или имени.
+func (i *userImporter) domain(ctx context.Context, ref string) (*dbauth.Domain, error) {
+	if domain, ok := i.domains[ref]; ok {
+		return domain, nil
+	}
+
+	query := i.tx.Domain.Query().Where(entDomain.Name(ref))
+	if id, err := xid.FromString(ref); err == nil {
+		query = i.tx.Domain.Query().Where(entDomain.ID(id))
+	}
+	domain, err := query.Only(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	i.domains[ref] = domain
+	return domain, nil
+}
+
+// role находит роль домена по идентификатору или имени.
+func (i *userImporter) role(ctx context.Context, domain *dbauth.Domain, ref string) (*dbauth.Role, error) {
+	key := domain.ID.String() + "/" + ref
+	if role, ok := i.roles[key]; ok {
+		return role, nil
+	}
+
+	query := i.tx.Role.Query().Where(entRole.DomainID(domain.ID), entRole.Name(ref))
+	if id, err := xid.FromString(ref); err == nil {
+		query = i.tx.Role.Query().Where(entRole.DomainID(domain.ID), entRole.ID(id))
+	}
+	role, err := query.Only(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	i.roles[key] = role
+	return role, nil
+}
+
+// ExportUsers постранично выгружает пользователей с их ролями в доменах,
+// передавая каждого в send. Ошибка send прерывает выгрузку и возвращается как есть.
+func (u UsersUsecase) ExportUsers(ctx context.Context, includeDeleted bool, send func(*dto.User) error) error {
+	ctx, log, end := u.rep.Start(ctx, "ExportUsers")
+	defer end()
+
+	var after xid.ID
+	for {
+		query := u.db.User.Query().
+			WithUserDomain(func(query *dbauth.UserDomainQuery) {
+				query.WithDomain().WithRole()
+			}).
+			Order(entUser.ByID()).
+			Limit(exportBatchSize)
+		if !after.IsNil() {
+			query = query.Where(entUser.IDGT(after))
+		}
+		if !includeDeleted {
+			query = query.Where(entUser.StatusNEQ(entUser.StatusDeleted))
+		}
+
+		users, err := query.All(ctx)
+		if err != nil {
+			log.Err(err).Stack().Msg("failed to query users page")
+			return UserExportDBErr.Err()
+		}
+
+		for _, user := range users {
+			if err := send(new(dto.User).FromEnt(user)); err != nil {
+				return err
+			}
+		}
+
+		if len(users) < exportBatchSize {
+			return nil
+		}
+		after = users[len(users)-1].ID
+	}
+}
@@ -0,0 +1,141 @@
+package usecase
+
+import (
+	"fmt"
+	"github.com/hughbliss/my_auth_service/internal/dto"
+	entUser "github.com/hughbliss/my_database/pkg/gen/dbauth/user"
+	"github.com/hughbliss/my_toolkit/fault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestUsersUsecase_ImportUsers(t *testing.T) {
+	usecase, client, ctx := setupUsersTest(t)
+	defer client.Close()
+
+	domain, role, user := createTestUserData(t, ctx, client)
+	manager, err := client.Role.Create().
+		SetName("Manager").
+		SetDescription("Manager").
+		SetPermissions([]string{"test.permission"}).
+		SetDomainID(domain.ID).
+		Save(ctx)
+	require.NoError(t, err)
+
+	records := []*dto.ImportRecord{
+		{Row: 1, Email: "New@Example.com", Name: "New", Domain: domain.Name, Role: role.Name},
+		{Row: 2, Email: user.Email, Name: user.Name, Domain: domain.ID.String(), Role: manager.ID.String()},
+		{Row: 3, Email: "new@example.com", Name: "Duplicate", Domain: domain.Name, Role: role.Name},
+		{Row: 4, Email: "not-an-email", Name: "Broken", Domain: domain.Name, Role: role.Name},
+		{Row: 5, Email: "other@example.com", Name: "Other", Domain: "MissingDomain", Role: role.Name},
+		{Row: 6, Email: "other@example.com", Name: "Other", Domain: domain.Name, Role: "MissingRole"},
+	}
+
+	actions := func(report *dto.ImportReport) []string {
+		res := make([]string, len(report.Results))
+		for i, result := range report.Results {
+			res[i] = result.Action
+		}
+		return res
+	}
+
+	t.Run("пробный импорт не сохраняет изменений", func(t *testing.T) {
+		report, err := usecase.ImportUsers(ctx, records, true)
+		require.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.Equal(t, []string{
+			dto.ImportCreated, dto.ImportUpdated, dto.ImportFailed,
+			dto.ImportFailed, dto.ImportFailed, dto.ImportFailed,
+		}, actions(report))
+		assert.Equal(t, string(ImportDuplicateEmailErr), report.Results[2].ErrorCode)
+		assert.Equal(t, string(InvalidUserDataErr), report.Results[3].ErrorCode)
+		assert.Equal(t, string(DomainNotFoundErr), report.Results[4].ErrorCode)
+		assert.Equal(t, string(RoleNotFoundErr), report.Results[5].ErrorCode)
+
+		exists, err := client.User.Query().Where(entUser.Email("new@example.com")).Exist(ctx)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("импорт создает и обновляет пользователей", func(t *testing.T) {
+		report, err := usecase.ImportUsers(ctx, records, false)
+		require.NoError(t, err)
+		assert.Equal(t, dto.ImportCreated, report.Results[0].Action)
+		assert.Equal(t, dto.ImportUpdated, report.Results[1].Action)
+
+		created, err := client.User.Query().Where(entUser.Email("new@example.com")).WithUserDomain().Only(ctx)
+		require.NoError(t, err)
+		require.Len(t, created.Edges.UserDomain, 1)
+		assert.Equal(t, role.ID, created.Edges.UserDomain[0].RoleID)
+
+		updated, err := client.User.Query().Where(entUser.ID(user.ID)).WithUserDomain().Only(ctx)
+		require.NoError(t, err)
+		require.Len(t, updated.Edges.UserDomain, 1)
+		assert.Equal(t, manager.ID, updated.Edges.UserDomain[0].RoleID)
+	})
+
+	t.Run("повторный импорт идемпотентен", func(t *testing.T) {
+		report, err := usecase.ImportUsers(ctx, records[:2], false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{dto.ImportUnchanged, dto.ImportUnchanged}, actions(report))
+	})
+
+	t.Run("email сравнивается без учета регистра", func(t *testing.T) {
+		mixed, err := client.User.Create().
+			SetName("Mixed").
+			SetEmail("Mixed@Example.com").
+			SetPasswordHash("hash").
+			SetCurrentDomainID(domain.ID).
+			Save(ctx)
+		require.NoError(t, err)
+
+		report, err := usecase.ImportUsers(ctx, []*dto.ImportRecord{
+			{Row: 1, Email: "mixed@example.com", Name: "Mixed", Domain: domain.Name, Role: role.Name},
+		}, false)
+		require.NoError(t, err)
+		assert.Equal(t, dto.ImportUpdated, report.Results[0].Action)
+		assert.Equal(t, mixed.ID, report.Results[0].UserID)
+
+		count, err := client.User.Query().Where(entUser.EmailEqualFold("mixed@example.com")).Count(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("пустой импорт", func(t *testing.T) {
+		_, err := usecase.ImportUsers(ctx, nil, false)
+		f := new(fault.Fault)
+		require.ErrorAs(t, err, &f)
+		assert.Equal(t, f.Error(), InvalidImportErr.Err().Error())
+	})
+}
+
+func TestUsersUsecase_ExportUsers(t *testing.T) {
+	usecase, client, ctx := setupUsersTest(t)
+	defer client.Close()
+
+	domain, _, _ := createTestUserData(t, ctx, client)
+	for i := 0; i < exportBatchSize+1; i++ {
+		_, err := client.User.Create().
+			SetName("Bulk").
+			SetEmail(fmt.Sprintf("bulk%d@example.com", i)).
+			SetPasswordHash("hash").
+			SetCurrentDomainID(domain.ID).
+			Save(ctx)
+		require.NoError(t, err)
+	}
+
+	var exported []*dto.User
+	err := usecase.ExportUsers(ctx, false, func(user *dto.User) error {
+		exported = append(exported, user)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, exported, exportBatchSize+2)
+
+	seen := make(map[string]struct{}, len(exported))
+	for _, user := range exported {
+		seen[user.ID.String()] = struct{}{}
+	}
+	assert.Len(t, seen, len(exported))
+}
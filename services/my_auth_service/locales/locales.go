@@ -0,0 +1,12 @@
+// Package locales файлы <язык>.yaml с сообщениями кодов fault, встроенные в
+// бинарь.
+package locales
+
+import "embed"
+
+// Коды и русские сообщения берутся из комментариев к константам fault.Code,
+// для остальных языков добавляются пустые строки под перевод.
+//go:generate go run github.com/hughbliss/my_toolkit/faultlocale/cmd/faultgen -src .. -langs ru,en
+
+//go:embed *.yaml
+var FS embed.FS
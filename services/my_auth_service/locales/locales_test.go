@@ -0,0 +1,14 @@
+package locales
+
+import (
+	"github.com/hughbliss/my_toolkit/faultlocale"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestTranslations падает, если у какого-либо кода fault нет перевода хотя бы
+// в одной локали: после добавления кода нужно запустить go generate и
+// заполнить пустые строки.
+func TestTranslations(t *testing.T) {
+	require.NoError(t, faultlocale.Verify("..", FS, "ru"))
+}
@@ -0,0 +1,14 @@
+-- reverse: create index "userdomain_user_id_domain_id" to table: "user_domains"
+DROP INDEX "userdomain_user_id_domain_id";
+-- reverse: create "user_domains" table
+DROP TABLE "user_domains";
+-- reverse: create index "users_email_key" to table: "users"
+DROP INDEX "users_email_key";
+-- reverse: create "users" table
+DROP TABLE "users";
+-- reverse: create "roles" table
+DROP TABLE "roles";
+-- reverse: create index "domains_name_key" to table: "domains"
+DROP INDEX "domains_name_key";
+-- reverse: create "domains" table
+DROP TABLE "domains";
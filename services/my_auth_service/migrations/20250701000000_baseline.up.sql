@@ -0,0 +1,14 @@
+-- create "domains" table
+CREATE TABLE "domains" ("id" character varying NOT NULL, "name" character varying NOT NULL, PRIMARY KEY ("id"));
+-- create index "domains_name_key" to table: "domains"
+CREATE UNIQUE INDEX "domains_name_key" ON "domains" ("name");
+-- create "roles" table
+CREATE TABLE "roles" ("id" character varying NOT NULL, "name" character varying NOT NULL, "description" character varying NOT NULL DEFAULT '', "permissions" jsonb NOT NULL, "domain_id" character varying NOT NULL, PRIMARY KEY ("id"), CONSTRAINT "roles_domains_roles" FOREIGN KEY ("domain_id") REFERENCES "domains" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION);
+-- create "users" table
+CREATE TABLE "users" ("id" character varying NOT NULL, "email" character varying NOT NULL, "name" character varying NOT NULL, "password_hash" character varying NOT NULL, "current_domain_id" character varying NOT NULL, PRIMARY KEY ("id"), CONSTRAINT "users_domains_current_domain" FOREIGN KEY ("current_domain_id") REFERENCES "domains" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION);
+-- create index "users_email_key" to table: "users"
+CREATE UNIQUE INDEX "users_email_key" ON "users" ("email");
+-- create "user_domains" table
+CREATE TABLE "user_domains" ("id" character varying NOT NULL, "user_id" character varying NOT NULL, "domain_id" character varying NOT NULL, "role_id" character varying NOT NULL, PRIMARY KEY ("id"), CONSTRAINT "user_domains_users_user_domain" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION, CONSTRAINT "user_domains_domains_domain" FOREIGN KEY ("domain_id") REFERENCES "domains" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION, CONSTRAINT "user_domains_roles_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id") ON UPDATE NO ACTION ON DELETE NO ACTION);
+-- create index "userdomain_user_id_domain_id" to table: "user_domains"
+CREATE UNIQUE INDEX "userdomain_user_id_domain_id" ON "user_domains" ("user_id", "domain_id");
@@ -0,0 +1,4 @@
+-- reverse: modify "users" table
+ALTER TABLE "users" DROP COLUMN "version", DROP COLUMN "deleted_at", DROP COLUMN "disabled_at", DROP COLUMN "status";
+-- reverse: modify "roles" table
+ALTER TABLE "roles" DROP COLUMN "version";
@@ -0,0 +1,4 @@
+-- modify "roles" table
+ALTER TABLE "roles" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+-- modify "users" table
+ALTER TABLE "users" ADD COLUMN "status" character varying NOT NULL DEFAULT 'active', ADD COLUMN "disabled_at" timestamptz NULL, ADD COLUMN "deleted_at" timestamptz NULL, ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
@@ -0,0 +1,6 @@
+-- reverse: create index "outboxevent_published_at" to table: "outbox_events"
+DROP INDEX "outboxevent_published_at";
+-- reverse: create index "outbox_events_event_id_key" to table: "outbox_events"
+DROP INDEX "outbox_events_event_id_key";
+-- reverse: create "outbox_events" table
+DROP TABLE "outbox_events";
@@ -0,0 +1,6 @@
+-- create "outbox_events" table
+CREATE TABLE "outbox_events" ("id" bigint NOT NULL GENERATED BY DEFAULT AS IDENTITY, "event_id" character varying NOT NULL, "type" character varying NOT NULL, "source" character varying NOT NULL, "subject" character varying NOT NULL, "time" timestamptz NOT NULL, "data" bytea NOT NULL, "published_at" timestamptz NULL, "attempts" bigint NOT NULL DEFAULT 0, "last_error" character varying NULL, PRIMARY KEY ("id"));
+-- create index "outbox_events_event_id_key" to table: "outbox_events"
+CREATE UNIQUE INDEX "outbox_events_event_id_key" ON "outbox_events" ("event_id");
+-- create index "outboxevent_published_at" to table: "outbox_events"
+CREATE INDEX "outboxevent_published_at" ON "outbox_events" ("published_at");
@@ -0,0 +1,4 @@
+-- reverse: create index "outboxevent_tx_id_id" to table: "outbox_events"
+DROP INDEX "outboxevent_tx_id_id";
+-- reverse: modify "outbox_events" table
+ALTER TABLE "outbox_events" DROP COLUMN "tx_id";
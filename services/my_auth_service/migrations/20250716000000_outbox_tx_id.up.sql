@@ -0,0 +1,4 @@
+-- modify "outbox_events" table
+ALTER TABLE "outbox_events" ADD COLUMN "tx_id" bigint NULL DEFAULT (pg_current_xact_id())::text::bigint;
+-- create index "outboxevent_tx_id_id" to table: "outbox_events"
+CREATE INDEX "outboxevent_tx_id_id" ON "outbox_events" ("tx_id", "id");
@@ -0,0 +1,2 @@
+-- modify "outbox_events" table
+ALTER TABLE "outbox_events" ADD COLUMN "dead_lettered_at" timestamptz NULL;
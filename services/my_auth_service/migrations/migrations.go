@@ -0,0 +1,15 @@
+// Package migrations версионные миграции базы данных сервиса в формате
+// golang-migrate. Файлы генерируются из ent схемы командой
+// `auth_service migrate diff <name>` и встраиваются в бинарь.
+//
+// Базовая миграция описывает таблицы, которые создавала автомиграция ent до
+// перехода на версионные миграции. Такую базу отмечают командой
+// `migrate baseline`, после чего `migrate up` применяет остальные миграции.
+// Соответствие миграций ent схеме проверяет TestSchemaInSync в
+// internal/migration.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,16 @@
+package migrations
+
+import (
+	"ariga.io/atlas/sql/migrate"
+	"ariga.io/atlas/sql/sqltool"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// TestAtlasSum падает, если файлы миграций изменены без пересчета atlas.sum:
+// atlas migrate hash --dir file://migrations --dir-format golang-migrate.
+func TestAtlasSum(t *testing.T) {
+	dir, err := sqltool.NewGolangMigrateDir(".")
+	require.NoError(t, err)
+	require.NoError(t, migrate.Validate(dir))
+}
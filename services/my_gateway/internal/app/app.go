@@ -4,11 +4,21 @@ import (
 	"context"
 	"fmt"
 	zfg "github.com/chaindead/zerocfg"
+	"github.com/hughbliss/my_gateway/internal/authcache"
 	"github.com/hughbliss/my_gateway/internal/gateway"
 	"github.com/hughbliss/my_gateway/internal/middleware"
+	"github.com/hughbliss/my_gateway/internal/policy"
+	"github.com/hughbliss/my_gateway/internal/ratelimit"
 	"github.com/hughbliss/my_gateway/internal/service"
+	"github.com/hughbliss/my_gateway/internal/streaming"
+	"github.com/hughbliss/my_gateway/internal/transfer"
+	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
 	"github.com/hughbliss/my_protobuf/go/pkg/gen/swagger"
 	"github.com/hughbliss/my_toolkit/cfg"
+	"github.com/hughbliss/my_toolkit/health"
+	"github.com/hughbliss/my_toolkit/lifecycle"
+	"github.com/hughbliss/my_toolkit/metrics"
+	"github.com/hughbliss/my_toolkit/reload"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/hughbliss/my_toolkit/telemetry"
 	"github.com/hughbliss/my_toolkit/telemetry/tracer"
@@ -20,6 +30,8 @@ import (
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 	"go.opentelemetry.io/otel"
 	"net/http"
+	"os"
+	"time"
 )
 
 var (
@@ -28,6 +40,51 @@ var (
 	listenPort  = zfg.Uint32("port", 8080, "LISTEN_PORT", zfg.Group(listenGroup))
 )
 
+var (
+	policyGroup          = zfg.NewGroup("policy")
+	policyPath           = zfg.Str("path", "", "POLICY_PATH", zfg.Group(policyGroup))
+	policyReloadInterval = zfg.Dur("reload_interval", 30*time.Second, "POLICY_RELOADINTERVAL", zfg.Group(policyGroup))
+)
+
+var (
+	authCacheGroup = zfg.NewGroup("auth_cache")
+	authCacheTTL   = zfg.Dur("ttl", 0, "AUTHCACHE_TTL", zfg.Group(authCacheGroup))
+)
+
+var (
+	meterGroup          = zfg.NewGroup("meter")
+	meterExporterName   = zfg.Str("exporter", metrics.ExporterNone, "METER_EXPORTER", zfg.Group(meterGroup))
+	meterPrometheusAddr = zfg.Str("prometheus_addr", "0.0.0.0:9464", "METER_PROMETHEUSADDR", zfg.Group(meterGroup))
+)
+
+// Лимиты в запросах в секунду на корзину, burst - запросов подряд. Строгий
+// лимит authn действует на вход, регистрацию, обновление и проверку токена
+// вместо лимита method. Rate 0 отключает лимит.
+var (
+	rateLimitGroup             = zfg.NewGroup("rate_limit")
+	rateLimitEnabled           = zfg.Bool("enabled", true, "RATELIMIT_ENABLED", zfg.Group(rateLimitGroup))
+	rateLimitTrustForwardedFor = zfg.Bool("trust_forwarded_for", false, "RATELIMIT_TRUSTFORWARDEDFOR", zfg.Group(rateLimitGroup))
+	rateLimitIPRate            = zfg.Float64("ip_rate", 20, "RATELIMIT_IPRATE", zfg.Group(rateLimitGroup))
+	rateLimitIPBurst           = zfg.Int("ip_burst", 40, "RATELIMIT_IPBURST", zfg.Group(rateLimitGroup))
+	rateLimitUserRate          = zfg.Float64("user_rate", 10, "RATELIMIT_USERRATE", zfg.Group(rateLimitGroup))
+	rateLimitUserBurst         = zfg.Int("user_burst", 20, "RATELIMIT_USERBURST", zfg.Group(rateLimitGroup))
+	rateLimitMethodRate        = zfg.Float64("method_rate", 5, "RATELIMIT_METHODRATE", zfg.Group(rateLimitGroup))
+	rateLimitMethodBurst       = zfg.Int("method_burst", 10, "RATELIMIT_METHODBURST", zfg.Group(rateLimitGroup))
+	rateLimitAuthnRate         = zfg.Float64("authn_rate", 0.2, "RATELIMIT_AUTHNRATE", zfg.Group(rateLimitGroup))
+	rateLimitAuthnBurst        = zfg.Int("authn_burst", 5, "RATELIMIT_AUTHNBURST", zfg.Group(rateLimitGroup))
+)
+
+var (
+	shutdownGroup   = zfg.NewGroup("shutdown")
+	shutdownTimeout = zfg.Dur("timeout", 15*time.Second, "SHUTDOWN_TIMEOUT", zfg.Group(shutdownGroup))
+)
+
+var (
+	healthGroup    = zfg.NewGroup("health")
+	healthInterval = zfg.Dur("interval", 5*time.Second, "HEALTH_INTERVAL", zfg.Group(healthGroup))
+	healthTimeout  = zfg.Dur("timeout", 2*time.Second, "HEALTH_TIMEOUT", zfg.Group(healthGroup))
+)
+
 var (
 	appName = zfg.Str("app_name", "my_gateway", "APPNAME")
 	appVer  = zfg.Str("app_ver", "0.0.1", "APPVER", zfg.Alias("v"))
@@ -43,16 +100,15 @@ func initTelemetry() func() {
 		panic(err)
 	}
 
-	//otlpMeter, err := meterExporter.OTLPMeter(ctx)
-	//if err != nil {
-	//	panic(err)
-	//}
-
 	tracerDown := tracer.Init(ctx, resourceMeta, jaegerExporter)
-	//meterDown := meter.Init(ctx, resourceMeta, otlpMeter)
+
+	meterDown, err := metrics.InitExporter(ctx, resourceMeta, *meterExporterName, *meterPrometheusAddr)
+	if err != nil {
+		panic(err)
+	}
 
 	return func() {
-		//meterDown()
+		meterDown()
 		tracerDown()
 	}
 }
@@ -62,13 +118,19 @@ func Run() {
 		panic(err)
 	}
 
+	runner := lifecycle.New(*shutdownTimeout)
+	ctx := runner.Context()
+
 	telemetryDown := initTelemetry()
-	defer telemetryDown()
+	runner.OnStop("telemetry", lifecycle.Func(telemetryDown))
 
 	reporter.Init(*appName, *appVer, *env, trace_middleware.HookForLogger())
+	initReload(ctx)
+
+	limiter := initRateLimit()
 
 	e := echo.New()
-	registerMiddleware(e)
+	registerMiddleware(e, limiter)
 
 	swaggerYamlContent, err := swagger.GetSwagger(swagger.Meta{
 		Title:   *appName,
@@ -82,41 +144,205 @@ func Run() {
 		return c.Blob(http.StatusOK, "application/x-yaml", []byte(swaggerYamlContent))
 	})
 
-	authService, err := service.NewAuthenticationService()
+	if err := initHealth(ctx, e); err != nil {
+		panic(err)
+	}
+
+	authService, err := initAuthService(ctx)
 	if err != nil {
 		panic(err)
 	}
 
-	authInterceptor := middleware.AuthInterceptor(authService)
+	policies, err := initPolicies(ctx)
+	if err != nil {
+		panic(err)
+	}
+
+	interceptors := gateway.Interceptors{
+		Auth:       middleware.AuthInterceptor(authService, policies, limiter),
+		AuthStream: middleware.AuthStreamInterceptor(authService, policies, limiter),
+	}
+	if limiter != nil {
+		interceptors.Rate = ratelimit.UnaryClientInterceptor(limiter)
+		interceptors.RateStream = ratelimit.StreamClientInterceptor(limiter)
+	}
 
 	v1 := e.Group("/v1")
 
 	v1Main := v1.Group("")
-	mainGatewayHandler, err := gateway.MainGateway(authInterceptor)
+	mainGatewayHandler, err := gateway.MainGateway(interceptors)
 	if err != nil {
 		panic(err)
 	}
 	v1Main.Any("/*", echo.WrapHandler(mainGatewayHandler))
 
 	v1Admin := v1.Group("/admin")
-	adminGatewayHandler, err := gateway.AdminGateway(authInterceptor)
+	adminGatewayHandler, err := gateway.AdminGateway(interceptors)
 	if err != nil {
 		panic(err)
 	}
-	v1Admin.Any("/*", echo.WrapHandler(adminGatewayHandler))
 
-	if err := e.Start(fmt.Sprintf("%s:%d", *listenHost, *listenPort)); err != nil {
+	adminUsersService, err := service.NewAdminUsersService()
+	if err != nil {
 		panic(err)
 	}
+	usersTransfer := transfer.NewUsersTransfer(adminUsersService, middleware.Authorizer(authService, policies, limiter))
+	v1Admin.POST("/users/import", usersTransfer.Import)
+	v1Admin.GET("/users/export", usersTransfer.Export)
+
+	// Просмотр и изменение настроек шлюза без перезапуска, каждое изменение
+	// пишется в журнал с email пользователя.
+	v1Admin.Match([]string{http.MethodGet, http.MethodPut}, "/config",
+		echo.WrapHandler(reload.Handler(middleware.PermissionAuthenticator(authService, reload.ConfigPermission))))
+
+	v1Admin.Any("/*", echo.WrapHandler(adminGatewayHandler))
+
+	// Shutdown перестает принимать соединения и дожидается текущих запросов,
+	// включая выгрузку пользователей, до shutdown.timeout.
+	runner.Go("http", func() error {
+		return e.Start(fmt.Sprintf("%s:%d", *listenHost, *listenPort))
+	})
+	runner.OnStop("http", e.Shutdown)
+
+	if err := runner.Wait(); err != nil {
+		log.Error().Err(err).Msg("shutdown failed")
+		os.Exit(1)
+	}
+}
+
+// initHealth добавляет /healthz, отвечающий, пока шлюз жив, и /readyz с
+// готовностью сервисов, в которые шлюз проксирует запросы. Сервисы
+// проверяются по grpc.health.v1 раз в health.interval, а /readyz отдает
+// результат последней проверки: эндпоинт открыт и не ограничен по частоте,
+// поэтому запросы к нему не должны порождать вызовы бэкендов.
+func initHealth(ctx context.Context, e *echo.Echo) error {
+	checks := health.NewChecks(*healthTimeout)
+	backends := []struct {
+		name   string
+		target string
+	}{
+		{"auth_service", *gateway.ConnectionStringAuthService},
+		{"some_service", *gateway.ConnectionStringSomeService},
+	}
+	for _, backend := range backends {
+		client, err := service.NewHealthClient(backend.target)
+		if err != nil {
+			return err
+		}
+		checks.Add(backend.name, health.Client(client, ""))
+	}
+
+	e.GET("/healthz", echo.WrapHandler(health.LivenessHandler()))
+	healthServer := health.NewServer(checks, *healthInterval)
+	go healthServer.Run(ctx)
+
+	e.GET("/readyz", echo.WrapHandler(health.ReadinessHandler(healthServer)))
+	return nil
+}
+
+// initReload следит за reload.path и применяет изменения log.level без
+// перезапуска.
+func initReload(ctx context.Context) {
+	reload.LogLevel("log.level")
+	go reload.WatchConfig(ctx, func(path string, err error) {
+		log.Error().Err(err).Str("path", path).Msg("failed to reload config")
+	})
+}
+
+// initAuthService возвращает клиент сервиса аутентификации. При auth_cache.ttl
+// ответы Authorize кэшируются и сбрасываются по подписке на изменения доступов.
+func initAuthService(ctx context.Context) (authnv1.AuthenticationServiceClient, error) {
+	authService, err := service.NewAuthenticationService()
+	if err != nil {
+		return nil, err
+	}
+	if *authCacheTTL <= 0 {
+		return authService, nil
+	}
+
+	permissionsService, err := service.NewPermissionsService()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := authcache.New(authService, *authCacheTTL)
+	go cached.Watch(ctx, permissionsService)
+	return cached, nil
+}
+
+// initPolicies загружает атрибутные политики, если задан policy.path, и
+// перечитывает файл при его изменении.
+func initPolicies(ctx context.Context) (*policy.Engine, error) {
+	if *policyPath == "" {
+		return nil, nil
+	}
+
+	policies, err := policy.Load(*policyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	go policies.Watch(ctx, *policyReloadInterval, func(err error) {
+		log.Error().Err(err).Str("path", *policyPath).Msg("failed to reload policies")
+	})
+
+	return policies, nil
 }
 
-func registerMiddleware(e *echo.Echo) {
+// initRateLimit возвращает ограничитель запросов с корзинами в памяти шлюза
+// или nil, если rate_limit.enabled выключен.
+func initRateLimit() *ratelimit.Limiter {
+	if !*rateLimitEnabled {
+		return nil
+	}
+
+	return ratelimit.New(ratelimit.NewMemoryStore(), ratelimit.Config{
+		IP:     ratelimit.Limit{Rate: *rateLimitIPRate, Burst: *rateLimitIPBurst},
+		User:   ratelimit.Limit{Rate: *rateLimitUserRate, Burst: *rateLimitUserBurst},
+		Method: ratelimit.Limit{Rate: *rateLimitMethodRate, Burst: *rateLimitMethodBurst},
+		Strict: ratelimit.Limit{Rate: *rateLimitAuthnRate, Burst: *rateLimitAuthnBurst},
+		StrictMethods: []string{
+			authnv1.AuthenticationService_SignIn_FullMethodName,
+			authnv1.AuthenticationService_SignUp_FullMethodName,
+			authnv1.AuthenticationService_RefreshToken_FullMethodName,
+			// Authorize проверяет переданный токен, без строгого лимита через
+			// него можно перебирать токены.
+			authnv1.AuthenticationService_Authorize_FullMethodName,
+		},
+	})
+}
+
+// skipRateLimit не ограничивает проверки здоровья.
+func skipRateLimit(c echo.Context) bool {
+	switch c.Path() {
+	case "/healthz", "/readyz":
+		return true
+	}
+	return false
+}
+
+func registerMiddleware(e *echo.Echo, limiter *ratelimit.Limiter) {
+	// IP клиента для логов и лимитов берется из X-Forwarded-For только за
+	// доверенным прокси, иначе заголовок позволил бы обходить лимиты.
+	e.IPExtractor = echo.ExtractIPDirect()
+	if *rateLimitTrustForwardedFor {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	}
+
+	// Токен WebSocket из URI убирается до журнала запросов и трассировки.
+	e.Pre(echo.WrapMiddleware(streaming.AccessTokenHeader))
 	e.Use(echoMiddleware.LoggerWithConfig(echoMiddleware.LoggerConfig{
 		Format: "${status} ${method} ${uri}",
 		Output: log.With().Str("level", "info").Str("component", "echo").Logger(),
 	}))
+	e.Use(metrics.EchoMiddleware())
 	e.Use(echoMiddleware.Recover())
-	e.Use(echoMiddleware.CORS())
+	e.Use(echoMiddleware.CORSWithConfig(echoMiddleware.CORSConfig{
+		AllowOrigins: *gateway.AllowOrigins,
+	}))
+	if limiter != nil {
+		e.Use(ratelimit.EchoMiddleware(limiter, skipRateLimit))
+	}
 	e.Use(echoMiddleware.Gzip())
 	e.Use(echoMiddleware.BodyLimit("2M"))
 	e.Use(otelecho.Middleware(*appName,
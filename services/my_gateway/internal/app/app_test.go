@@ -0,0 +1,33 @@
+package app
+
+import (
+	"context"
+	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestInitRateLimit_StrictMethods(t *testing.T) {
+	ctx := context.Background()
+
+	methods := []string{
+		authnv1.AuthenticationService_SignIn_FullMethodName,
+		authnv1.AuthenticationService_SignUp_FullMethodName,
+		authnv1.AuthenticationService_RefreshToken_FullMethodName,
+		authnv1.AuthenticationService_Authorize_FullMethodName,
+	}
+	for _, method := range methods {
+		t.Run(method, func(t *testing.T) {
+			limiter := initRateLimit()
+			require.NotNil(t, limiter)
+			for range *rateLimitAuthnBurst {
+				require.NoError(t, limiter.AllowMethod(ctx, "10.0.0.1", method))
+			}
+			err := limiter.AllowMethod(ctx, "10.0.0.1", method)
+			assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Package authcache кэширует ответы Authorize сервиса аутентификации по access
+// токену и сбрасывает их по уведомлениям WatchPermissionChanges, чтобы
+// изменение роли или блокировка пользователя вступали в силу сразу, а не по
+// истечении TTL.
+package authcache
+
+import (
+	"context"
+	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"github.com/hughbliss/my_toolkit/access"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"sync"
+	"time"
+)
+
+const DefaultSize = 10_000
+
+type entry struct {
+	meta    *authnv1.AuthorizeResponse
+	expires time.Time
+}
+
+// Client AuthenticationServiceClient, отвечающий на Authorize из кэша.
+// Кэшируются только успешные ответы. Выход пользователя из системы в
+// уведомлениях не передается, поэтому отозванный токен принимается еще до TTL.
+type Client struct {
+	authnv1.AuthenticationServiceClient
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]entry
+	// generation растет при каждом сбросе. Ответ, полученный от сервиса, не
+	// кладется в кэш, если за время вызова кэш сбрасывался: иначе он вернул
+	// бы запись, которую Evict только что удалил.
+	generation uint64
+}
+
+func New(service authnv1.AuthenticationServiceClient, ttl time.Duration) *Client {
+	return &Client{
+		AuthenticationServiceClient: service,
+		ttl:                         ttl,
+		size:                        DefaultSize,
+		now:                         time.Now,
+		cache:                       map[string]entry{},
+	}
+}
+
+func (c *Client) Authorize(ctx context.Context, in *authnv1.AuthorizeRequest, opts ...grpc.CallOption) (*authnv1.AuthorizeResponse, error) {
+	token := in.GetAccessToken()
+	meta, generation, ok := c.get(token)
+	if ok {
+		return meta, nil
+	}
+
+	meta, err := c.AuthenticationServiceClient.Authorize(ctx, in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.put(token, meta, generation)
+	return meta, nil
+}
+
+// Watch сбрасывает кэш по уведомлениям об изменении доступов до отмены ctx.
+func (c *Client) Watch(ctx context.Context, permissions perserv1.PermissionsServiceClient) {
+	access.Watch(ctx, permissions, c.Evict, func() {
+		log.Debug().Str("component", "authcache").Msg("permission changes resync, cache reset")
+		c.Reset()
+	})
+}
+
+// Evict удаляет ответы пользователя change.UserID и ответы с текущей ролью
+// change.RoleID.
+func (c *Client) Evict(change access.Change) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for token, e := range c.cache {
+		if (change.UserID != "" && e.meta.GetUserId() == change.UserID) ||
+			(change.RoleID != "" && e.meta.GetCurrentRoleId() == change.RoleID) {
+			delete(c.cache, token)
+		}
+	}
+}
+
+// Reset очищает кэш целиком.
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.cache = map[string]entry{}
+}
+
+// get возвращает ответ из кэша и текущее поколение кэша для put.
+func (c *Client) get(token string) (*authnv1.AuthorizeResponse, uint64, bool) {
+	if token == "" || c.ttl <= 0 {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.cache[token]
+	if !ok {
+		return nil, c.generation, false
+	}
+	if c.now().After(e.expires) {
+		delete(c.cache, token)
+		return nil, c.generation, false
+	}
+	return e.meta, c.generation, true
+}
+
+// put кладет ответ в кэш, если с момента get кэш не сбрасывался.
+func (c *Client) put(token string, meta *authnv1.AuthorizeResponse, generation uint64) {
+	if token == "" || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation != generation {
+		return
+	}
+
+	if len(c.cache) >= c.size {
+		now := c.now()
+		for k, e := range c.cache {
+			if now.After(e.expires) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= c.size {
+			c.cache = map[string]entry{}
+		}
+	}
+	c.cache[token] = entry{meta: meta, expires: c.now().Add(c.ttl)}
+}
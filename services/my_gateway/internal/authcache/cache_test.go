@@ -0,0 +1,64 @@
+package authcache
+
+import (
+	"context"
+	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
+	"github.com/hughbliss/my_toolkit/access"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"testing"
+	"time"
+)
+
+// authnStub отвечает на Authorize и вызывает during во время вызова.
+type authnStub struct {
+	authnv1.AuthenticationServiceClient
+	calls  int
+	during func()
+}
+
+func (s *authnStub) Authorize(context.Context, *authnv1.AuthorizeRequest, ...grpc.CallOption) (*authnv1.AuthorizeResponse, error) {
+	s.calls++
+	if s.during != nil {
+		s.during()
+	}
+	return &authnv1.AuthorizeResponse{UserId: "user", CurrentRoleId: "role"}, nil
+}
+
+func TestClient_Authorize(t *testing.T) {
+	ctx := context.Background()
+	request := &authnv1.AuthorizeRequest{AccessToken: "token"}
+
+	t.Run("ответ кэшируется до сброса", func(t *testing.T) {
+		stub := &authnStub{}
+		client := New(stub, time.Minute)
+
+		for range 2 {
+			_, err := client.Authorize(ctx, request)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 1, stub.calls)
+
+		client.Evict(access.Change{RoleID: "role"})
+		_, err := client.Authorize(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, 2, stub.calls)
+	})
+
+	t.Run("сброс во время вызова", func(t *testing.T) {
+		stub := &authnStub{}
+		client := New(stub, time.Minute)
+		// Уведомление пришло, пока сервис отвечал: ответ мог быть получен до
+		// изменения и не должен попасть в кэш.
+		stub.during = func() { client.Evict(access.Change{UserID: "user"}) }
+
+		_, err := client.Authorize(ctx, request)
+		require.NoError(t, err)
+		stub.during = nil
+
+		_, err = client.Authorize(ctx, request)
+		require.NoError(t, err)
+		assert.Equal(t, 2, stub.calls)
+	})
+}
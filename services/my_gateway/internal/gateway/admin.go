@@ -3,21 +3,17 @@ package gateway
 import (
 	"context"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hughbliss/my_gateway/internal/streaming"
 	admrolserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/roles/v1"
 	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
-	"google.golang.org/grpc"
 	"net/http"
 )
 
-func AdminGateway(authInterceptor grpc.UnaryClientInterceptor) (http.Handler, error) {
+func AdminGateway(interceptors Interceptors) (http.Handler, error) {
 	ctx := context.Background()
-	mux := runtime.NewServeMux()
+	mux := newServeMux()
 
-	var opts []grpc.DialOption
-	opts = append(opts, DefaultGRPCOptions...)
-	if authInterceptor != nil {
-		opts = append(opts, grpc.WithUnaryInterceptor(authInterceptor))
-	}
+	opts := interceptors.dialOptions(true)
 
 	/* AUTH_MICROSERVICE */
 	if err := admrolserv1.RegisterAdminRolesServiceHandlerFromEndpoint(
@@ -29,5 +25,5 @@ func AdminGateway(authInterceptor grpc.UnaryClientInterceptor) (http.Handler, er
 		return nil, err
 	}
 
-	return mux, nil
+	return streaming.WebSocketProxy(mux, *AllowOrigins), nil
 }
@@ -17,6 +17,10 @@ var (
 	// example declaring connection strings config
 	//connectionStringYetAnotherService = zfg.Str("yet_another_service", "0.0.0.0:11000", "CONNECTION_YETANOTHERSERVICE", zfg.Group(connectionsGroup))
 
+	// AllowOrigins источники браузерных запросов для CORS и открытия WebSocket.
+	corsGroup    = zfg.NewGroup("cors")
+	AllowOrigins = zfg.Strs("allow_origins", []string{"*"}, "CORS_ALLOWORIGINS", zfg.Group(corsGroup))
+
 	DefaultGRPCOptions = []grpc.DialOption{
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithStatsHandler(otelgrpc.NewClientHandler(
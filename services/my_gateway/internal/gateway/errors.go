@@ -0,0 +1,38 @@
+package gateway
+
+import (
+	"context"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hughbliss/my_gateway/internal/ratelimit"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+// ErrorHandler отвечает на ошибку вызова статусом google.rpc.Status с HTTP
+// кодом по faultstatus.HTTPStatus, чтобы REST клиенты получали 400, 401, 404
+// и 409 так же, как gRPC клиенты получают коды статуса.
+func ErrorHandler(_ context.Context, _ *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, _ *http.Request, err error) {
+	st := status.Convert(err)
+	body, merr := marshaler.Marshal(st.Proto())
+	if merr != nil {
+		log.Error().Err(merr).Msg("failed to marshal error status")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", marshaler.ContentType(st.Proto()))
+	switch st.Code() {
+	case codes.Unauthenticated:
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	case codes.ResourceExhausted:
+		ratelimit.SetRetryAfter(w.Header(), st)
+	}
+	w.WriteHeader(faultstatus.HTTPStatus(st.Code()))
+	if _, werr := w.Write(body); werr != nil {
+		log.Debug().Err(werr).Msg("failed to write error response")
+	}
+}
@@ -0,0 +1,19 @@
+package gateway
+
+import (
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"net/http"
+)
+
+// AcceptLanguageMetadata ключ метаданных gRPC с заголовком Accept-Language, по
+// которому сервисы выбирают язык сообщений об ошибках.
+const AcceptLanguageMetadata = "accept-language"
+
+// HeaderMatcher передает Accept-Language в метаданные без префикса
+// grpcgateway-, остальные заголовки - по правилам grpc-gateway.
+func HeaderMatcher(key string) (string, bool) {
+	if http.CanonicalHeaderKey(key) == "Accept-Language" {
+		return AcceptLanguageMetadata, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"google.golang.org/grpc"
+)
+
+// Interceptors перехватчики вызовов сервисов за шлюзом. Rate ограничивает все
+// вызовы и выполняется первым, Auth - вызовы сервисов, требующих доступа.
+// Перехватчики nil пропускаются.
+type Interceptors struct {
+	Auth       grpc.UnaryClientInterceptor
+	AuthStream grpc.StreamClientInterceptor
+	Rate       grpc.UnaryClientInterceptor
+	RateStream grpc.StreamClientInterceptor
+}
+
+// dialOptions добавляет к DefaultGRPCOptions перехватчики в порядке вызова,
+// перехватчики доступа - только при withAuth.
+func (i Interceptors) dialOptions(withAuth bool) []grpc.DialOption {
+	opts := append([]grpc.DialOption{}, DefaultGRPCOptions...)
+
+	unary := []grpc.UnaryClientInterceptor{i.Rate}
+	stream := []grpc.StreamClientInterceptor{i.RateStream}
+	if withAuth {
+		unary = append(unary, i.Auth)
+		stream = append(stream, i.AuthStream)
+	}
+
+	var unaryChain []grpc.UnaryClientInterceptor
+	for _, interceptor := range unary {
+		if interceptor != nil {
+			unaryChain = append(unaryChain, interceptor)
+		}
+	}
+	if len(unaryChain) > 0 {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(unaryChain...))
+	}
+
+	var streamChain []grpc.StreamClientInterceptor
+	for _, interceptor := range stream {
+		if interceptor != nil {
+			streamChain = append(streamChain, interceptor)
+		}
+	}
+	if len(streamChain) > 0 {
+		opts = append(opts, grpc.WithChainStreamInterceptor(streamChain...))
+	}
+	return opts
+}
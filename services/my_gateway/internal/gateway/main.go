@@ -3,21 +3,21 @@ package gateway
 import (
 	"context"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hughbliss/my_gateway/internal/streaming"
 	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
 	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
 	someservicev1 "github.com/hughbliss/my_protobuf/go/pkg/gen/someservice/v1"
-	"google.golang.org/grpc"
 	"net/http"
 )
 
-func MainGateway(authInterceptor grpc.UnaryClientInterceptor) (http.Handler, error) {
+// MainGateway проксирует публичные сервисы. Ограничение частоты применяется ко
+// всем вызовам, включая методы аутентификации, проверка доступа - к остальным.
+func MainGateway(interceptors Interceptors) (http.Handler, error) {
 	ctx := context.Background()
-	mux := runtime.NewServeMux()
+	mux := newServeMux()
 
-	withAuth := []grpc.DialOption{
-		grpc.WithUnaryInterceptor(authInterceptor),
-	}
-	withAuth = append(withAuth, DefaultGRPCOptions...)
+	withRate := interceptors.dialOptions(false)
+	withAuth := interceptors.dialOptions(true)
 
 	/* EXAMPLE_MICROSERVICE */
 	if err := someservicev1.RegisterSomeServiceHandlerFromEndpoint(
@@ -31,9 +31,20 @@ func MainGateway(authInterceptor grpc.UnaryClientInterceptor) (http.Handler, err
 		return nil, err
 	}
 	if err := authnv1.RegisterAuthenticationServiceHandlerFromEndpoint(
-		ctx, mux, *ConnectionStringAuthService, DefaultGRPCOptions); err != nil {
+		ctx, mux, *ConnectionStringAuthService, withRate); err != nil {
 		return nil, err
 	}
 
-	return mux, nil
+	return streaming.WebSocketProxy(mux, *AllowOrigins), nil
+}
+
+// newServeMux возвращает ServeMux шлюза с ответами потоков в NDJSON и
+// Server-Sent Events.
+func newServeMux() *runtime.ServeMux {
+	opts := append(streaming.ServeMuxOptions(),
+		runtime.WithErrorHandler(ErrorHandler),
+		runtime.WithIncomingHeaderMatcher(HeaderMatcher),
+		runtime.WithMiddlewares(RouteMiddleware),
+	)
+	return runtime.NewServeMux(opts...)
 }
@@ -0,0 +1,18 @@
+package gateway
+
+import (
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/hughbliss/my_toolkit/metrics"
+	"net/http"
+)
+
+// RouteMiddleware передает в метрики шаблон пути grpc-gateway вместо
+// маршрута echo "/v1/*", под которым смонтирован mux.
+func RouteMiddleware(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		if pattern, ok := runtime.HTTPPattern(r.Context()); ok {
+			metrics.SetRoute(r.Context(), pattern.String())
+		}
+		next(w, r, pathParams)
+	}
+}
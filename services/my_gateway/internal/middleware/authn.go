@@ -2,28 +2,44 @@ package middleware
 
 import (
 	"context"
+	"github.com/hughbliss/my_gateway/internal/policy"
+	"github.com/hughbliss/my_gateway/internal/ratelimit"
 	"github.com/hughbliss/my_protobuf/go/pkg/gen/acman"
 	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
+	"github.com/hughbliss/my_toolkit/permission"
+	"github.com/hughbliss/my_toolkit/reload"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 	"strings"
 )
 
-func AuthInterceptor(service authnv1.AuthenticationServiceClient) grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+// AuthorizeFunc проверяет доступ к методу method с запросом req по токену из
+// метаданных исходящего контекста. Возвращает nil, если вызов разрешен.
+type AuthorizeFunc func(ctx context.Context, method string, req any) error
+
+// Authorizer проверяет доступ пользователя к методу из acman.MethodPermissionMap,
+// а затем, если передан policies, атрибутные политики этого метода. Методы без
+// требуемого доступа разрешены без авторизации. Если передан limiter, запросы
+// пользователя ограничиваются его корзиной сразу после аутентификации.
+// Отказы аутентификации, доступа и политик учитываются в gateway.auth_denials.
+func Authorizer(service authnv1.AuthenticationServiceClient, policies *policy.Engine, limiter *ratelimit.Limiter) AuthorizeFunc {
+	return func(ctx context.Context, method string, req any) error {
 		requiredPermission, ok := acman.MethodPermissionMap[method]
 		if !ok {
-			return invoker(ctx, method, req, reply, cc, opts...)
+			return nil
 		}
 		md, ok := metadata.FromOutgoingContext(ctx)
 		if !ok {
+			recordDenial(ctx, requiredPermission.Alias, denialUnauthenticated)
 			return status.Error(codes.Unauthenticated, "metadata is not provided")
 		}
 
 		authHeaders := md.Get("Authorization")
 		if len(authHeaders) != 1 {
+			recordDenial(ctx, requiredPermission.Alias, denialUnauthenticated)
 			return status.Error(codes.Unauthenticated, "authorization header is invalid")
 		}
 
@@ -33,15 +49,154 @@ func AuthInterceptor(service authnv1.AuthenticationServiceClient) grpc.UnaryClie
 			AccessToken: accessToken,
 		})
 		if err != nil {
+			if status.Code(err) == codes.Unauthenticated {
+				recordDenial(ctx, requiredPermission.Alias, denialUnauthenticated)
+			}
 			return err
 		}
 
-		for _, permission := range userMeta.Permissions {
-			if permission == requiredPermission.Alias {
-				return invoker(ctx, method, req, reply, cc, opts...)
+		if limiter != nil {
+			if err := limiter.AllowUser(ctx, userMeta.GetUserId()); err != nil {
+				return err
+			}
+		}
+
+		if !permission.Any(userMeta.Permissions, requiredPermission.Alias) {
+			recordDenial(ctx, requiredPermission.Alias, denialMissingPermission)
+			return status.Error(codes.PermissionDenied, "у вас нет доступа: "+requiredPermission.Description)
+		}
+
+		if policies != nil {
+			message, _ := req.(proto.Message)
+			decision := policies.Evaluate(ctx, method, message, subjectFromMeta(userMeta))
+			// Причина отказа может содержать ошибки вычисления выражений, поэтому
+			// она пишется только в журнал решений.
+			if !decision.Allowed {
+				recordDenial(ctx, requiredPermission.Alias, denialPolicy)
+				return status.Error(codes.PermissionDenied, "доступ запрещен политикой")
+			}
+		}
+
+		return nil
+	}
+}
+
+// AuthInterceptor применяет Authorizer к каждому unary вызову.
+func AuthInterceptor(service authnv1.AuthenticationServiceClient, policies *policy.Engine, limiter *ratelimit.Limiter) grpc.UnaryClientInterceptor {
+	authorize := Authorizer(service, policies, limiter)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := authorize(ctx, method, req); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func subjectFromMeta(meta *authnv1.AuthorizeResponse) policy.Subject {
+	return policy.Subject{
+		UserID:          meta.GetUserId(),
+		Email:           meta.GetEmail(),
+		CurrentDomainID: meta.GetCurrentDomainId(),
+		CurrentRoleID:   meta.GetCurrentRoleId(),
+		Permissions:     meta.GetPermissions(),
+	}
+}
+
+// PermissionAuthenticator проверяет access token из заголовка Authorization
+// HTTP запроса и доступ alias. Возвращает email пользователя для журнала
+// изменений.
+func PermissionAuthenticator(service authnv1.AuthenticationServiceClient, alias string) reload.Authenticator {
+	return reload.PermissionAuthenticator(func(ctx context.Context, accessToken string) (string, []string, error) {
+		userMeta, err := service.Authorize(ctx, &authnv1.AuthorizeRequest{
+			AccessToken: accessToken,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		return userMeta.GetEmail(), userMeta.GetPermissions(), nil
+	}, alias)
+}
+
+// AuthStreamInterceptor применяет Authorizer к потоковым вызовам. Потоки
+// клиента проверяются при открытии без запроса. Поток сервера открывается
+// только при отправке единственного запроса, после проверки с этим запросом,
+// чтобы атрибутные политики видели его поля.
+func AuthStreamInterceptor(service authnv1.AuthenticationServiceClient, policies *policy.Engine, limiter *ratelimit.Limiter) grpc.StreamClientInterceptor {
+	authorize := Authorizer(service, policies, limiter)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if desc.ClientStreams {
+			if err := authorize(ctx, method, nil); err != nil {
+				return nil, err
 			}
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		return &authorizedStream{
+			ctx: ctx,
+			open: func(req any) (grpc.ClientStream, error) {
+				if err := authorize(ctx, method, req); err != nil {
+					return nil, err
+				}
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		}, nil
+	}
+}
+
+// errStreamNotOpened ошибка методов authorizedStream до первого SendMsg.
+var errStreamNotOpened = status.Error(codes.Internal, "stream is not opened: the request has not been sent")
+
+// authorizedStream поток сервера, который открывается первым SendMsg.
+// Сгенерированный клиент отправляет запрос сразу после открытия; до этого
+// методы потока возвращают errStreamNotOpened или пустые метаданные.
+type authorizedStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	open func(req any) (grpc.ClientStream, error)
+}
+
+func (s *authorizedStream) SendMsg(m any) error {
+	if s.ClientStream == nil {
+		stream, err := s.open(m)
+		if err != nil {
+			return err
 		}
+		s.ClientStream = stream
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *authorizedStream) Context() context.Context {
+	if s.ClientStream == nil {
+		return s.ctx
+	}
+	return s.ClientStream.Context()
+}
+
+func (s *authorizedStream) Header() (metadata.MD, error) {
+	if s.ClientStream == nil {
+		return nil, errStreamNotOpened
+	}
+	return s.ClientStream.Header()
+}
+
+func (s *authorizedStream) Trailer() metadata.MD {
+	if s.ClientStream == nil {
+		return nil
+	}
+	return s.ClientStream.Trailer()
+}
+
+func (s *authorizedStream) CloseSend() error {
+	if s.ClientStream == nil {
+		return errStreamNotOpened
+	}
+	return s.ClientStream.CloseSend()
+}
 
-		return status.Error(codes.PermissionDenied, "у вас нет доступа: "+requiredPermission.Description)
+func (s *authorizedStream) RecvMsg(m any) error {
+	if s.ClientStream == nil {
+		return errStreamNotOpened
 	}
+	return s.ClientStream.RecvMsg(m)
 }
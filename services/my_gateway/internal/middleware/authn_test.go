@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"context"
+	"github.com/hughbliss/my_gateway/internal/policy"
+	"github.com/hughbliss/my_protobuf/go/pkg/gen/acman"
+	authnv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/authn/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"testing"
+)
+
+const updateUserMethod = "/admin.users.v1.AdminUsersService/UpdateUser"
+
+// authnStub авторизует токен "token" с доступами permissions.
+type authnStub struct {
+	authnv1.AuthenticationServiceClient
+	permissions []string
+}
+
+func (s *authnStub) Authorize(_ context.Context, request *authnv1.AuthorizeRequest, _ ...grpc.CallOption) (*authnv1.AuthorizeResponse, error) {
+	if request.GetAccessToken() != "token" {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return &authnv1.AuthorizeResponse{UserId: "u1", Permissions: s.permissions}, nil
+}
+
+type recorder struct {
+	decisions []policy.Decision
+}
+
+func (r *recorder) LogDecision(_ context.Context, decision policy.Decision) {
+	r.decisions = append(r.decisions, decision)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// allowed возвращает доступ, требуемый методом method.
+func allowed(t *testing.T, method string) []string {
+	t.Helper()
+	required, ok := acman.MethodPermissionMap[method]
+	require.True(t, ok, "метода %s нет в каталоге", method)
+	return []string{required.Alias}
+}
+
+func TestAuthorizer_Policy(t *testing.T) {
+	rec := &recorder{}
+	policies, err := policy.New([]policy.Rule{{
+		Name:       "own-profile",
+		Method:     updateUserMethod,
+		Expression: `request.user.id == auth.user_id`,
+	}}, policy.WithDecisionLogger(rec))
+	require.NoError(t, err)
+
+	authorize := Authorizer(&authnStub{permissions: allowed(t, updateUserMethod)}, policies, nil)
+
+	// Запрос без поля user: ошибка вычисления выражения остается в журнале
+	// решений и не попадает в ответ клиенту.
+	err = authorize(withToken("token"), updateUserMethod, &structpb.Struct{})
+	st := status.Convert(err)
+	assert.Equal(t, codes.PermissionDenied, st.Code())
+	assert.Equal(t, "доступ запрещен политикой", st.Message())
+	require.Len(t, rec.decisions, 1)
+	assert.Contains(t, rec.decisions[0].Reason, "evaluation error")
+}
+
+// collectDenials устанавливает провайдер с ручным чтением и возвращает
+// функцию, собирающую gateway.auth_denials по "доступ причина".
+func collectDenials(t *testing.T) func() map[string]int64 {
+	t.Helper()
+	reader := sdkmetric.NewManualReader()
+	previous := otel.GetMeterProvider()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(previous) })
+
+	return func() map[string]int64 {
+		var rm metricdata.ResourceMetrics
+		require.NoError(t, reader.Collect(context.Background(), &rm))
+		got := map[string]int64{}
+		for _, scope := range rm.ScopeMetrics {
+			for _, m := range scope.Metrics {
+				if m.Name != "gateway.auth_denials" {
+					continue
+				}
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					permission, _ := point.Attributes.Value(attribute.Key("permission"))
+					reason, _ := point.Attributes.Value(attribute.Key("reason"))
+					got[permission.AsString()+" "+reason.AsString()] = point.Value
+				}
+			}
+		}
+		return got
+	}
+}
+
+func TestAuthorizer_Denials(t *testing.T) {
+	denials := collectDenials(t)
+	alias := allowed(t, updateUserMethod)[0]
+
+	policies, err := policy.New([]policy.Rule{{
+		Name:       "deny-all",
+		Method:     updateUserMethod,
+		Expression: `false`,
+	}}, policy.WithDecisionLogger(&recorder{}))
+	require.NoError(t, err)
+
+	// Без доступа, затем с доступом, но против политики.
+	_ = Authorizer(&authnStub{}, nil, nil)(withToken("token"), updateUserMethod, nil)
+	_ = Authorizer(&authnStub{permissions: []string{alias}}, policies, nil)(withToken("token"), updateUserMethod, nil)
+	// Неверный токен и вызов без метаданных.
+	authorize := Authorizer(&authnStub{permissions: []string{alias}}, nil, nil)
+	_ = authorize(withToken("wrong"), updateUserMethod, nil)
+	_ = authorize(context.Background(), updateUserMethod, nil)
+	// Метод без требуемого доступа не учитывается.
+	require.NoError(t, authorize(context.Background(), "/some.v1.SomeService/Public", nil))
+
+	assert.Equal(t, map[string]int64{
+		alias + " " + denialMissingPermission: 1,
+		alias + " " + denialPolicy:            1,
+		alias + " " + denialUnauthenticated:   2,
+	}, denials())
+}
+
+const watchMethod = "/some.v1.SomeService/Watch"
+
+// sentStream поток, запоминающий отправленные сообщения.
+type sentStream struct {
+	grpc.ClientStream
+	sent []any
+}
+
+func (s *sentStream) SendMsg(m any) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	policies, err := policy.New([]policy.Rule{{
+		Name:       "own-stream",
+		Method:     watchMethod,
+		Expression: `request.user_id == auth.user_id`,
+	}}, policy.WithDecisionLogger(&recorder{}))
+	require.NoError(t, err)
+
+	request := func(t *testing.T, userID string) *structpb.Struct {
+		req, err := structpb.NewStruct(map[string]any{"user_id": userID})
+		require.NoError(t, err)
+		return req
+	}
+	serverStream := &grpc.StreamDesc{ServerStreams: true}
+
+	cases := []struct {
+		name        string
+		ctx         context.Context
+		permissions []string
+		desc        *grpc.StreamDesc
+		userID      string
+		code        codes.Code
+	}{
+		{"поток сервера без токена", context.Background(), allowed(t, watchMethod), serverStream, "u1", codes.Unauthenticated},
+		{"поток сервера без доступа", withToken("token"), nil, serverStream, "u1", codes.PermissionDenied},
+		{"поток сервера против политики", withToken("token"), allowed(t, watchMethod), serverStream, "u2", codes.PermissionDenied},
+		{"поток клиента без токена", context.Background(), allowed(t, watchMethod), &grpc.StreamDesc{ClientStreams: true}, "u1", codes.Unauthenticated},
+		{"поток сервера разрешен", withToken("token"), allowed(t, watchMethod), serverStream, "u1", codes.OK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opened := &sentStream{}
+			streamed := 0
+			streamer := func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+				streamed++
+				return opened, nil
+			}
+			interceptor := AuthStreamInterceptor(&authnStub{permissions: c.permissions}, policies, nil)
+
+			stream, err := interceptor(c.ctx, c.desc, nil, watchMethod, streamer)
+			if err == nil {
+				err = stream.SendMsg(request(t, c.userID))
+			}
+
+			assert.Equal(t, c.code, status.Code(err))
+			if c.code != codes.OK {
+				assert.Zero(t, streamed, "поток открыт до проверки доступа")
+				return
+			}
+			assert.Equal(t, 1, streamed)
+			assert.Len(t, opened.sent, 1)
+		})
+	}
+
+	t.Run("методы до отправки запроса", func(t *testing.T) {
+		interceptor := AuthStreamInterceptor(&authnStub{permissions: allowed(t, watchMethod)}, policies, nil)
+		stream, err := interceptor(withToken("token"), serverStream, nil, watchMethod,
+			func(context.Context, *grpc.StreamDesc, *grpc.ClientConn, string, ...grpc.CallOption) (grpc.ClientStream, error) {
+				t.Fatal("поток открыт без запроса")
+				return nil, nil
+			})
+		require.NoError(t, err)
+
+		_, err = stream.Header()
+		assert.Equal(t, codes.Internal, status.Code(err))
+		assert.Nil(t, stream.Trailer())
+		assert.Equal(t, codes.Internal, status.Code(stream.CloseSend()))
+		assert.Equal(t, codes.Internal, status.Code(stream.RecvMsg(&structpb.Struct{})))
+		assert.NotNil(t, stream.Context())
+	})
+}
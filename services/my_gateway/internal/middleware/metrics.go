@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"github.com/hughbliss/my_toolkit/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Причины отказа в метрике gateway.auth_denials.
+const (
+	denialUnauthenticated   = "unauthenticated"
+	denialMissingPermission = "missing_permission"
+	denialPolicy            = "policy"
+)
+
+var (
+	meter       = metrics.Meter("github.com/hughbliss/my_gateway/middleware")
+	authDenials = metrics.Counter(meter, "gateway.auth_denials", "Denied gateway calls by permission and reason")
+)
+
+// recordDenial учитывает отказ в вызове метода, требующего доступ
+// permission. Алиасы берутся из каталога acman, поэтому число рядов
+// ограничено числом методов.
+func recordDenial(ctx context.Context, permission, reason string) {
+	authDenials.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("permission", permission),
+		attribute.String("reason", reason),
+	))
+}
@@ -0,0 +1,30 @@
+package policy
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+)
+
+// DecisionLogger журнал решений политик.
+type DecisionLogger interface {
+	LogDecision(ctx context.Context, decision Decision)
+}
+
+// ZerologDecisionLogger пишет решения в глобальный zerolog логгер: запреты на
+// уровне warn, разрешения - на уровне debug.
+type ZerologDecisionLogger struct{}
+
+func (ZerologDecisionLogger) LogDecision(_ context.Context, decision Decision) {
+	event := log.Debug()
+	if !decision.Allowed {
+		event = log.Warn()
+	}
+	event.
+		Str("component", "policy").
+		Str("method", decision.Method).
+		Str("user_id", decision.UserID).
+		Str("policy", decision.Policy).
+		Bool("allowed", decision.Allowed).
+		Str("reason", decision.Reason).
+		Msg("policy decision")
+}
@@ -0,0 +1,312 @@
+// Package policy реализует проверку атрибутных политик доступа (ABAC) в шлюзе.
+//
+// Политика - это CEL-выражение, привязанное к полному имени gRPC метода.
+// Выражение должно вернуть bool и видит следующие переменные:
+//
+//	method  - полное имя вызываемого метода, например "/admin.users.v1.AdminUsersService/UpdateUser";
+//	request - поля сообщения запроса в JSON представлении с именами полей из proto
+//	          (int64 и enum приходят строками, как в protojson);
+//	auth    - атрибуты пользователя из AuthorizeResponse: user_id, email,
+//	          current_domain_id, current_role_id, permissions.
+//
+// Если к методу привязано несколько политик, запрос разрешен только тогда, когда
+// разрешают все. Ошибка вычисления выражения трактуется как запрет.
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rule описание политики в YAML файле.
+type Rule struct {
+	Name        string `yaml:"name"`        // Name уникальное имя политики, попадает в журнал решений.
+	Method      string `yaml:"method"`      // Method полное имя gRPC метода.
+	Expression  string `yaml:"expression"`  // Expression CEL-выражение, возвращающее bool.
+	Description string `yaml:"description"` // Description текст, который увидит пользователь при запрете.
+}
+
+// File структура YAML файла с политиками.
+type File struct {
+	Policies []Rule `yaml:"policies"`
+}
+
+// Subject атрибуты авторизованного пользователя.
+type Subject struct {
+	UserID          string
+	Email           string
+	CurrentDomainID string
+	CurrentRoleID   string
+	Permissions     []string
+}
+
+func (s Subject) toMap() map[string]any {
+	permissions := make([]any, len(s.Permissions))
+	for i, p := range s.Permissions {
+		permissions[i] = p
+	}
+	return map[string]any{
+		"user_id":           s.UserID,
+		"email":             s.Email,
+		"current_domain_id": s.CurrentDomainID,
+		"current_role_id":   s.CurrentRoleID,
+		"permissions":       permissions,
+	}
+}
+
+// Decision результат проверки политик для одного вызова.
+type Decision struct {
+	Method  string
+	UserID  string
+	Policy  string // Policy имя политики, определившей решение; пусто, если к методу не привязано политик.
+	Allowed bool
+	Reason  string
+}
+
+type compiledRule struct {
+	Rule
+	program cel.Program
+}
+
+type ruleSet map[string][]compiledRule
+
+// Engine хранит скомпилированные политики и вычисляет решения.
+// Набор политик заменяется атомарно, поэтому Evaluate безопасно вызывать
+// одновременно с Reload.
+type Engine struct {
+	env    *cel.Env
+	path   string
+	logger DecisionLogger
+	rules  atomic.Pointer[ruleSet]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// Option настраивает Engine.
+type Option func(*Engine)
+
+// WithDecisionLogger заменяет журнал решений, по умолчанию используется zerolog.
+func WithDecisionLogger(logger DecisionLogger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+func newEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("method", cel.StringType),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("auth", cel.MapType(cel.StringType, cel.DynType)),
+	)
+}
+
+// New создает Engine из набора правил, без привязки к файлу.
+func New(rules []Rule, opts ...Option) (*Engine, error) {
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+	e := &Engine{env: env, logger: ZerologDecisionLogger{}}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	set, err := e.compile(rules)
+	if err != nil {
+		return nil, err
+	}
+	e.rules.Store(&set)
+	return e, nil
+}
+
+// Load создает Engine из YAML файла. Файл можно перечитать через Reload или Watch.
+func Load(path string, opts ...Option) (*Engine, error) {
+	e, err := New(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	e.path = path
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Engine) compile(rules []Rule) (ruleSet, error) {
+	set := make(ruleSet, len(rules))
+	names := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" || rule.Method == "" || rule.Expression == "" {
+			return nil, fmt.Errorf("policy %q: name, method and expression are required", rule.Name)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("policy %q: duplicate name", rule.Name)
+		}
+		names[rule.Name] = struct{}{}
+
+		ast, issues := e.env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("policy %q: %w", rule.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("policy %q: expression must return bool, got %s", rule.Name, ast.OutputType())
+		}
+		program, err := e.env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", rule.Name, err)
+		}
+		set[rule.Method] = append(set[rule.Method], compiledRule{Rule: rule, program: program})
+	}
+	return set, nil
+}
+
+// Reload перечитывает файл политик. При ошибке чтения или компиляции
+// продолжает действовать предыдущий набор, а Watch не повторяет попытку до
+// следующего изменения файла.
+func (e *Engine) Reload() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+	e.modTime = info.ModTime()
+
+	var file File
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("policy file %s: %w", e.path, err)
+	}
+
+	set, err := e.compile(file.Policies)
+	if err != nil {
+		return err
+	}
+	e.rules.Store(&set)
+	return nil
+}
+
+func (e *Engine) changed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(e.modTime)
+}
+
+// Watch перечитывает файл политик при изменении времени модификации, проверяя
+// его раз в interval, пока не завершится ctx. Ошибки перезагрузки передаются в onError.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	if e.path == "" || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !e.changed() {
+				continue
+			}
+			if err := e.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// Evaluate проверяет все политики метода и записывает решение в журнал.
+func (e *Engine) Evaluate(ctx context.Context, method string, request proto.Message, subject Subject) Decision {
+	decision := e.evaluate(method, request, subject)
+	e.logger.LogDecision(ctx, decision)
+	return decision
+}
+
+func (e *Engine) evaluate(method string, request proto.Message, subject Subject) Decision {
+	decision := Decision{Method: method, UserID: subject.UserID, Allowed: true}
+
+	rules := (*e.rules.Load())[method]
+	if len(rules) == 0 {
+		decision.Reason = "no policies bound to method"
+		return decision
+	}
+
+	fields, err := requestFields(request)
+	if err != nil {
+		decision.Allowed = false
+		decision.Reason = "failed to read request: " + err.Error()
+		return decision
+	}
+
+	activation := map[string]any{
+		"method":  method,
+		"request": fields,
+		"auth":    subject.toMap(),
+	}
+
+	for _, rule := range rules {
+		decision.Policy = rule.Name
+		out, _, err := rule.program.Eval(activation)
+		if err != nil {
+			decision.Allowed = false
+			decision.Reason = "evaluation error: " + err.Error()
+			return decision
+		}
+		allowed, ok := out.Value().(bool)
+		if !ok {
+			decision.Allowed = false
+			decision.Reason = fmt.Sprintf("expression returned %T instead of bool", out.Value())
+			return decision
+		}
+		if !allowed {
+			decision.Allowed = false
+			decision.Reason = rule.Description
+			if decision.Reason == "" {
+				decision.Reason = "denied by policy " + rule.Name
+			}
+			return decision
+		}
+	}
+
+	decision.Reason = "allowed by all policies"
+	return decision
+}
+
+func requestFields(request proto.Message) (map[string]any, error) {
+	fields := map[string]any{}
+	if request == nil {
+		return fields, nil
+	}
+	content, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
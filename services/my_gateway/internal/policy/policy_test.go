@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const updateUserMethod = "/admin.users.v1.AdminUsersService/UpdateUser"
+
+type recorder struct {
+	decisions []Decision
+}
+
+func (r *recorder) LogDecision(_ context.Context, decision Decision) {
+	r.decisions = append(r.decisions, decision)
+}
+
+func userRequest(t *testing.T, userID, domainID string) *structpb.Struct {
+	request, err := structpb.NewStruct(map[string]any{
+		"user": map[string]any{
+			"id":                userID,
+			"current_domain_id": domainID,
+		},
+	})
+	require.NoError(t, err)
+	return request
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	rec := &recorder{}
+	engine, err := New([]Rule{
+		{
+			Name:        "own-profile",
+			Method:      updateUserMethod,
+			Expression:  `request.user.id == auth.user_id`,
+			Description: "можно изменять только свой профиль",
+		},
+		{
+			Name:       "current-domain",
+			Method:     updateUserMethod,
+			Expression: `request.user.current_domain_id == auth.current_domain_id`,
+		},
+	}, WithDecisionLogger(rec))
+	require.NoError(t, err)
+
+	subject := Subject{UserID: "u1", CurrentDomainID: "d1", Permissions: []string{"admin.users.update"}}
+	ctx := context.Background()
+
+	t.Run("все политики разрешают", func(t *testing.T) {
+		decision := engine.Evaluate(ctx, updateUserMethod, userRequest(t, "u1", "d1"), subject)
+		assert.True(t, decision.Allowed)
+	})
+
+	t.Run("запрет первой политикой", func(t *testing.T) {
+		decision := engine.Evaluate(ctx, updateUserMethod, userRequest(t, "u2", "d1"), subject)
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, "own-profile", decision.Policy)
+		assert.Equal(t, "можно изменять только свой профиль", decision.Reason)
+	})
+
+	t.Run("запрет второй политикой", func(t *testing.T) {
+		decision := engine.Evaluate(ctx, updateUserMethod, userRequest(t, "u1", "d2"), subject)
+		assert.False(t, decision.Allowed)
+		assert.Equal(t, "current-domain", decision.Policy)
+	})
+
+	t.Run("ошибка вычисления запрещает", func(t *testing.T) {
+		decision := engine.Evaluate(ctx, updateUserMethod, &structpb.Struct{}, subject)
+		assert.False(t, decision.Allowed)
+		assert.Contains(t, decision.Reason, "evaluation error")
+	})
+
+	t.Run("метод без политик", func(t *testing.T) {
+		decision := engine.Evaluate(ctx, "/some.v1.SomeService/Method", nil, subject)
+		assert.True(t, decision.Allowed)
+		assert.Empty(t, decision.Policy)
+	})
+
+	require.Len(t, rec.decisions, 5)
+	assert.Equal(t, "u1", rec.decisions[0].UserID)
+	assert.False(t, rec.decisions[1].Allowed)
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	_, err := New([]Rule{{Name: "syntax", Method: updateUserMethod, Expression: `request.user.id ==`}})
+	assert.Error(t, err)
+
+	_, err = New([]Rule{{Name: "not-bool", Method: updateUserMethod, Expression: `"str"`}})
+	assert.Error(t, err)
+
+	_, err = New([]Rule{
+		{Name: "dup", Method: updateUserMethod, Expression: `true`},
+		{Name: "dup", Method: updateUserMethod, Expression: `true`},
+	})
+	assert.Error(t, err)
+}
+
+func TestEngine_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	write := func(content string, modTime time.Time) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	write(`
+policies:
+  - name: deny-all
+    method: `+updateUserMethod+`
+    expression: "false"
+`, time.Now().Add(-time.Minute))
+
+	engine, err := Load(path, WithDecisionLogger(&recorder{}))
+	require.NoError(t, err)
+	ctx := context.Background()
+	assert.False(t, engine.Evaluate(ctx, updateUserMethod, nil, Subject{}).Allowed)
+
+	t.Run("невалидный файл не заменяет политики", func(t *testing.T) {
+		write(`policies: [{name: broken, method: m, expression: "1 +"}]`, time.Now().Add(-30*time.Second))
+		assert.Error(t, engine.Reload())
+		assert.False(t, engine.Evaluate(ctx, updateUserMethod, nil, Subject{}).Allowed)
+		// Ошибка не повторяется, пока файл не изменится.
+		assert.False(t, engine.changed())
+	})
+
+	t.Run("изменение файла подхватывается Watch", func(t *testing.T) {
+		write(`
+policies:
+  - name: allow-all
+    method: `+updateUserMethod+`
+    expression: "true"
+`, time.Now())
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go engine.Watch(watchCtx, 10*time.Millisecond, nil)
+
+		assert.Eventually(t, func() bool {
+			return engine.Evaluate(ctx, updateUserMethod, nil, Subject{}).Allowed
+		}, time.Second, 10*time.Millisecond)
+	})
+}
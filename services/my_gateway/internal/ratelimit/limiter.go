@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Config лимиты шлюза. Корзины каждого вида независимы: запрос проходит,
+// только если токен нашелся во всех подходящих корзинах.
+type Config struct {
+	IP            Limit    // IP все запросы с одного IP.
+	User          Limit    // User запросы одного пользователя к методам, требующим доступа.
+	Method        Limit    // Method запросы с одного IP к одному методу gRPC.
+	Strict        Limit    // Strict запросы с одного IP к одному из StrictMethods вместо Method.
+	StrictMethods []string // StrictMethods методы со строгим лимитом, например SignIn.
+}
+
+type Limiter struct {
+	store  Store
+	config Config
+	strict map[string]bool
+}
+
+func New(store Store, config Config) *Limiter {
+	strict := make(map[string]bool, len(config.StrictMethods))
+	for _, method := range config.StrictMethods {
+		strict[method] = true
+	}
+	return &Limiter{
+		store:  store,
+		config: config,
+		strict: strict,
+	}
+}
+
+// AllowIP берет токен из корзины IP клиента.
+func (l *Limiter) AllowIP(ctx context.Context, ip string) error {
+	return l.take(ctx, "ip:"+ip, l.config.IP)
+}
+
+// AllowUser берет токен из корзины пользователя userID.
+func (l *Limiter) AllowUser(ctx context.Context, userID string) error {
+	return l.take(ctx, "user:"+userID, l.config.User)
+}
+
+// AllowMethod берет токен из корзины метода method для IP клиента. Для
+// StrictMethods действует лимит Strict.
+func (l *Limiter) AllowMethod(ctx context.Context, ip, method string) error {
+	limit := l.config.Method
+	if l.strict[method] {
+		limit = l.config.Strict
+	}
+	return l.take(ctx, "method:"+method+":"+ip, limit)
+}
+
+// take отклоняет запрос ошибкой ResourceExhausted с errdetails.RetryInfo.
+// Если хранилище недоступно, запрос пропускается: отказ ограничителя не
+// должен останавливать шлюз.
+func (l *Limiter) take(ctx context.Context, key string, limit Limit) error {
+	if limit.Rate <= 0 {
+		return nil
+	}
+
+	decision, err := l.store.Take(ctx, key, limit)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("rate limit store failed, request allowed")
+		return nil
+	}
+	if decision.Allowed {
+		return nil
+	}
+	return exhausted(decision.RetryAfter)
+}
+
+func exhausted(retryAfter time.Duration) error {
+	st := status.New(codes.ResourceExhausted, "слишком много запросов, повторите позже")
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// SetRetryAfter выставляет заголовок Retry-After в целых секундах по
+// errdetails.RetryInfo статуса st.
+func SetRetryAfter(header http.Header, st *status.Status) {
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.RetryInfo)
+		if !ok {
+			continue
+		}
+		seconds := int(math.Ceil(info.GetRetryDelay().AsDuration().Seconds()))
+		header.Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		return
+	}
+}
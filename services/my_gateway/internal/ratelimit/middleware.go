@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	echoMiddleware "github.com/labstack/echo/v4/middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"net/http"
+)
+
+type clientIPKey struct{}
+
+// ClientIP возвращает IP клиента, сохраненный EchoMiddleware в контексте
+// запроса. grpc-gateway передает этот контекст в вызовы gRPC.
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+// EchoMiddleware ограничивает запросы по IP клиента и сохраняет IP в контексте
+// запроса для UnaryClientInterceptor. Отклоненный запрос получает 429 с
+// Retry-After и телом google.rpc.Status.
+func EchoMiddleware(l *Limiter, skipper echoMiddleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = echoMiddleware.DefaultSkipper
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipper(c) {
+				return next(c)
+			}
+
+			ip := c.RealIP()
+			req := c.Request()
+			ctx := context.WithValue(req.Context(), clientIPKey{}, ip)
+			c.SetRequest(req.WithContext(ctx))
+
+			if err := l.AllowIP(ctx, ip); err != nil {
+				st := status.Convert(err)
+				SetRetryAfter(c.Response().Header(), st)
+				content, err := protojson.Marshal(st.Proto())
+				if err != nil {
+					return err
+				}
+				return c.Blob(http.StatusTooManyRequests, echo.MIMEApplicationJSON, content)
+			}
+			return next(c)
+		}
+	}
+}
+
+// UnaryClientInterceptor ограничивает вызовы каждого метода gRPC с одного IP.
+// Вызовы вне HTTP запроса, без IP в контексте, не ограничиваются.
+func UnaryClientInterceptor(l *Limiter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if ip := ClientIP(ctx); ip != "" {
+			if err := l.AllowMethod(ctx, ip, method); err != nil {
+				return err
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor ограничивает открытие потоков каждого метода gRPC с
+// одного IP тем же лимитом, что и UnaryClientInterceptor.
+func StreamClientInterceptor(l *Limiter) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if ip := ClientIP(ctx); ip != "" {
+			if err := l.AllowMethod(ctx, ip, method); err != nil {
+				return nil, err
+			}
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func testStore() (*MemoryStore, *clock) {
+	c := &clock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = c.Now
+	return store, c
+}
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, Limit) (Decision, error) {
+	return Decision{}, errors.New("store is down")
+}
+
+func TestMemoryStore_Take(t *testing.T) {
+	store, c := testStore()
+	limit := Limit{Rate: 2, Burst: 3}
+	ctx := context.Background()
+
+	for range 3 {
+		decision, err := store.Take(ctx, "ip:10.0.0.1", limit)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	}
+
+	decision, err := store.Take(ctx, "ip:10.0.0.1", limit)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 500*time.Millisecond, decision.RetryAfter)
+
+	// Корзины разных ключей независимы.
+	decision, _ = store.Take(ctx, "ip:10.0.0.2", limit)
+	assert.True(t, decision.Allowed)
+
+	c.now = c.now.Add(500 * time.Millisecond)
+	decision, _ = store.Take(ctx, "ip:10.0.0.1", limit)
+	assert.True(t, decision.Allowed)
+	decision, _ = store.Take(ctx, "ip:10.0.0.1", limit)
+	assert.False(t, decision.Allowed)
+
+	// Заполнившиеся корзины удаляются.
+	c.now = c.now.Add(sweepInterval)
+	_, _ = store.Take(ctx, "ip:10.0.0.3", limit)
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestLimiter(t *testing.T) {
+	store, _ := testStore()
+	limiter := New(store, Config{
+		Method:        Limit{Rate: 10, Burst: 5},
+		Strict:        Limit{Rate: 0.1, Burst: 1},
+		StrictMethods: []string{"/authn.v1.AuthenticationService/SignIn"},
+	})
+	ctx := context.Background()
+
+	require.NoError(t, limiter.AllowMethod(ctx, "10.0.0.1", "/authn.v1.AuthenticationService/SignIn"))
+	err := limiter.AllowMethod(ctx, "10.0.0.1", "/authn.v1.AuthenticationService/SignIn")
+	st := status.Convert(err)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+
+	header := http.Header{}
+	SetRetryAfter(header, st)
+	assert.Equal(t, "10", header.Get("Retry-After"))
+
+	for range 5 {
+		require.NoError(t, limiter.AllowMethod(ctx, "10.0.0.1", "/some.v1.SomeService/Get"))
+	}
+	assert.Error(t, limiter.AllowMethod(ctx, "10.0.0.1", "/some.v1.SomeService/Get"))
+
+	// Лимиты без Rate отключены.
+	for range 10 {
+		require.NoError(t, limiter.AllowIP(ctx, "10.0.0.1"))
+		require.NoError(t, limiter.AllowUser(ctx, "user"))
+	}
+
+	t.Run("store failure", func(t *testing.T) {
+		limiter := New(failingStore{}, Config{IP: Limit{Rate: 1, Burst: 1}})
+		assert.NoError(t, limiter.AllowIP(ctx, "10.0.0.1"))
+	})
+}
+
+func TestEchoMiddleware(t *testing.T) {
+	store, _ := testStore()
+	limiter := New(store, Config{
+		IP:     Limit{Rate: 1, Burst: 2},
+		Method: Limit{Rate: 1, Burst: 1},
+	})
+
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.Use(EchoMiddleware(limiter, func(c echo.Context) bool { return c.Path() == "/healthz" }))
+
+	invoke := UnaryClientInterceptor(limiter)
+	e.GET("/v1/*", func(c echo.Context) error {
+		err := invoke(c.Request().Context(), "/some.v1.SomeService/Get", nil, nil, nil,
+			func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error { return nil })
+		if err != nil {
+			return c.String(http.StatusTooManyRequests, "method")
+		}
+		return c.String(http.StatusOK, ClientIP(c.Request().Context()))
+	})
+	e.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve("/v1/some")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "10.0.0.1", rec.Body.String())
+
+	rec = serve("/v1/some")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "method", rec.Body.String())
+
+	rec = serve("/v1/some")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Contains(t, rec.Body.String(), `"code":8`)
+
+	assert.Equal(t, http.StatusOK, serve("/healthz").Code)
+}
@@ -0,0 +1,104 @@
+// Package ratelimit ограничивает частоту запросов к шлюзу алгоритмом token
+// bucket: по IP клиента, по пользователю и по методу gRPC. Корзины хранятся в
+// Store: пока в памяти процесса, для нескольких реплик шлюза Store можно
+// заменить общим хранилищем.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval период удаления корзин, которые успели заполниться и ничем не
+// отличаются от новых.
+const sweepInterval = time.Minute
+
+// Limit скорость пополнения и емкость корзины. Rate <= 0 отключает
+// ограничение.
+type Limit struct {
+	Rate  float64 // Rate пополнение корзины, запросов в секунду.
+	Burst int     // Burst емкость корзины, запросов подряд.
+}
+
+// Decision результат попытки взять токен из корзины.
+type Decision struct {
+	Allowed    bool
+	RetryAfter time.Duration // RetryAfter через сколько в корзине появится токен, если запрос отклонен.
+}
+
+// Store хранит корзины по ключу. Take пополняет корзину key по limit и берет
+// из нее токен атомарно относительно других реплик, использующих тот же Store.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Decision, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// available возвращает число токенов в корзине на момент now.
+func (b *bucket) available(now time.Time) float64 {
+	tokens := b.tokens + now.Sub(b.updated).Seconds()*b.limit.Rate
+	return min(tokens, float64(burst(b.limit)))
+}
+
+func burst(limit Limit) int {
+	return max(limit.Burst, 1)
+}
+
+// MemoryStore Store в памяти процесса. Подходит для одной реплики шлюза:
+// у каждой реплики свои корзины.
+type MemoryStore struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Decision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst(limit)), updated: now, limit: limit}
+		s.buckets[key] = b
+	}
+	b.tokens, b.updated, b.limit = b.available(now), now, limit
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Decision{Allowed: true}, nil
+	}
+	wait := (1 - b.tokens) / limit.Rate
+	return Decision{RetryAfter: time.Duration(wait * float64(time.Second))}, nil
+}
+
+// sweep удаляет заполнившиеся корзины, чтобы память не росла с числом
+// клиентов.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.available(now) >= float64(burst(b.limit)) {
+			delete(s.buckets, key)
+		}
+	}
+}
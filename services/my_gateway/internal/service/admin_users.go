@@ -0,0 +1,15 @@
+package service
+
+import (
+	"github.com/hughbliss/my_gateway/internal/gateway"
+	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
+	"google.golang.org/grpc"
+)
+
+func NewAdminUsersService() (admusrserv1.AdminUsersServiceClient, error) {
+	connection, err := grpc.NewClient(*gateway.ConnectionStringAuthService, gateway.DefaultGRPCOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return admusrserv1.NewAdminUsersServiceClient(connection), nil
+}
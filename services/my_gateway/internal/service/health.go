@@ -0,0 +1,16 @@
+package service
+
+import (
+	"github.com/hughbliss/my_gateway/internal/gateway"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// NewHealthClient возвращает клиент grpc.health.v1 бэкенда target.
+func NewHealthClient(target string) (healthpb.HealthClient, error) {
+	connection, err := grpc.NewClient(target, gateway.DefaultGRPCOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return healthpb.NewHealthClient(connection), nil
+}
@@ -0,0 +1,15 @@
+package service
+
+import (
+	"github.com/hughbliss/my_gateway/internal/gateway"
+	perserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/permissions/v1"
+	"google.golang.org/grpc"
+)
+
+func NewPermissionsService() (perserv1.PermissionsServiceClient, error) {
+	connection, err := grpc.NewClient(*gateway.ConnectionStringAuthService, gateway.DefaultGRPCOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return perserv1.NewPermissionsServiceClient(connection), nil
+}
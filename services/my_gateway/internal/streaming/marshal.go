@@ -0,0 +1,78 @@
+// Package streaming отдает ответы потоковых методов gRPC через шлюз: поток
+// сервера - строками JSON (NDJSON) или Server-Sent Events по заголовку
+// Accept, двунаправленный поток - через WebSocket.
+package streaming
+
+import (
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// MIMENDJSON ответ потока сервера построчно, по сообщению JSON в строке.
+	MIMENDJSON = "application/x-ndjson"
+	// MIMEEventStream ответ потока сервера событиями Server-Sent Events.
+	MIMEEventStream = "text/event-stream"
+)
+
+// ServeMuxOptions регистрирует в ServeMux маршалеры NDJSON и Server-Sent
+// Events. Без этих заголовков Accept поток сервера отдается построчно с
+// Content-Type application/json, как по умолчанию в grpc-gateway.
+func ServeMuxOptions() []runtime.ServeMuxOption {
+	return []runtime.ServeMuxOption{
+		runtime.WithMarshalerOption(MIMENDJSON, &ndjsonMarshaler{JSONPb: newJSONPb()}),
+		runtime.WithMarshalerOption(MIMEEventStream, &eventStreamMarshaler{JSONPb: newJSONPb()}),
+	}
+}
+
+// newJSONPb возвращает JSONPb с настройками маршалера grpc-gateway по
+// умолчанию.
+func newJSONPb() *runtime.JSONPb {
+	return &runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+}
+
+// ndjsonMarshaler пишет каждое сообщение потока отдельной строкой:
+// {"result": ...} или {"error": ...} при ошибке.
+type ndjsonMarshaler struct {
+	*runtime.JSONPb
+}
+
+func (m *ndjsonMarshaler) ContentType(any) string {
+	return MIMENDJSON
+}
+
+func (m *ndjsonMarshaler) Delimiter() []byte {
+	return []byte("\n")
+}
+
+// eventStreamMarshaler пишет каждое сообщение потока событием с полем data:
+// {"result": ...}. Ошибка потока отправляется событием "error".
+type eventStreamMarshaler struct {
+	*runtime.JSONPb
+}
+
+func (m *eventStreamMarshaler) ContentType(any) string {
+	return MIMEEventStream
+}
+
+func (m *eventStreamMarshaler) Delimiter() []byte {
+	return []byte("\n\n")
+}
+
+func (m *eventStreamMarshaler) Marshal(v any) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var event []byte
+	if chunk, ok := v.(map[string]proto.Message); ok && chunk["error"] != nil {
+		event = []byte("event: error\n")
+	}
+	event = append(event, "data: "...)
+	return append(event, data...), nil
+}
@@ -0,0 +1,226 @@
+package streaming
+
+import (
+	"bufio"
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// streamHandler отвечает потоком из messages и, если задана, ошибкой.
+func streamHandler(messages []string, streamErr error) http.Handler {
+	mux := runtime.NewServeMux(ServeMuxOptions()...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, outbound := runtime.MarshalerForRequest(mux, r)
+		ctx := runtime.NewServerMetadataContext(r.Context(), runtime.ServerMetadata{})
+
+		next := 0
+		runtime.ForwardResponseStream(ctx, mux, outbound, w, r, func() (proto.Message, error) {
+			if next == len(messages) {
+				if streamErr != nil {
+					return nil, streamErr
+				}
+				return nil, io.EOF
+			}
+			next++
+			return wrapperspb.String(messages[next-1]), nil
+		})
+	})
+}
+
+func TestServerStream(t *testing.T) {
+	handler := streamHandler([]string{"first", "second"}, status.Error(codes.PermissionDenied, "denied"))
+
+	serve := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/watch", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("ndjson", func(t *testing.T) {
+		rec := serve(MIMENDJSON)
+		assert.Equal(t, MIMENDJSON, rec.Header().Get("Content-Type"))
+
+		lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+		require.Len(t, lines, 3)
+		assert.JSONEq(t, `{"result":"first"}`, lines[0])
+		assert.JSONEq(t, `{"result":"second"}`, lines[1])
+		assert.Contains(t, lines[2], `"error"`)
+	})
+
+	t.Run("event stream", func(t *testing.T) {
+		rec := serve(MIMEEventStream)
+		assert.Equal(t, MIMEEventStream, rec.Header().Get("Content-Type"))
+
+		events := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n\n"), "\n\n")
+		require.Len(t, events, 3)
+		for i, want := range []string{`{"result":"first"}`, `{"result":"second"}`} {
+			data, ok := strings.CutPrefix(events[i], "data: ")
+			require.True(t, ok, events[i])
+			assert.JSONEq(t, want, data)
+		}
+		assert.True(t, strings.HasPrefix(events[2], "event: error\ndata: {"), events[2])
+	})
+}
+
+func TestWebSocketProxy(t *testing.T) {
+	// Эхо поток: каждая строка тела возвращается сообщением ответа.
+	echoStream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Empty(t, r.URL.Query().Get("access_token"))
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			_, _ = w.Write([]byte(strings.ToUpper(scanner.Text()) + "\n"))
+			assert.NoError(t, http.NewResponseController(w).Flush())
+		}
+		_, _ = w.Write([]byte("done"))
+	})
+
+	server := httptest.NewServer(AccessTokenHeader(WebSocketProxy(echoStream, []string{"https://*.example.com"})))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/chat?access_token=token"
+	conn, _, err := websocket.DefaultDialer.DialContext(context.Background(), url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	for _, message := range []string{"hello", "world"} {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+		_, reply, err := conn.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, strings.ToUpper(message), string(reply))
+	}
+
+	require.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	_, reply, err := conn.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(reply))
+
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+
+	t.Run("origin", func(t *testing.T) {
+		header := http.Header{"Origin": {"https://app.example.com"}}
+		conn, _, err := websocket.DefaultDialer.DialContext(context.Background(), url, header)
+		require.NoError(t, err)
+		conn.Close()
+
+		header.Set("Origin", "https://evil.com")
+		_, resp, err := websocket.DefaultDialer.DialContext(context.Background(), url, header)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("plain request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat", strings.NewReader("ping\n"))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer token")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
+
+// dial открывает WebSocket к серверу, обслуживающему h через WebSocketProxy.
+func dial(t *testing.T, h http.Handler) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(WebSocketProxy(h, nil))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.DialContext(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http")+"/v1/chat", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestWebSocketProxy_Close(t *testing.T) {
+	t.Run("ошибка вызова закрывает с кодом ошибки", func(t *testing.T) {
+		cases := []struct {
+			status int
+			code   int
+		}{
+			{http.StatusForbidden, websocket.ClosePolicyViolation},
+			{http.StatusServiceUnavailable, websocket.CloseInternalServerErr},
+		}
+		for _, c := range cases {
+			conn := dial(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+				_, _ = w.Write([]byte(`{"code":7}`))
+			}))
+
+			_, reply, err := conn.ReadMessage()
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"code":7}`, string(reply))
+
+			_, _, err = conn.ReadMessage()
+			assert.True(t, websocket.IsCloseError(err, c.code), err)
+		}
+	})
+
+	t.Run("слишком большое сообщение", func(t *testing.T) {
+		done := make(chan struct{})
+		conn := dial(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer close(done)
+			_, _ = io.Copy(io.Discard, r.Body)
+		}))
+
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, make([]byte, maxMessageSize+1)))
+		_, _, err := conn.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig), err)
+		<-done
+	})
+
+	t.Run("молчащий клиент отключается", func(t *testing.T) {
+		defer func(wait, period time.Duration) { pongWait, pingPeriod = wait, period }(pongWait, pingPeriod)
+		pongWait, pingPeriod = 100*time.Millisecond, 20*time.Millisecond
+
+		canceled := make(chan struct{})
+		// Клиент не читает соединение, поэтому не отвечает на ping.
+		dial(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			close(canceled)
+		}))
+
+		select {
+		case <-canceled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("вызов не отменен по истечении pongWait")
+		}
+	})
+}
+
+func TestAccessTokenHeader(t *testing.T) {
+	var got *http.Request
+	handler := AccessTokenHeader(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = r }))
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/chat?access_token=token&method=get", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "Bearer token", got.Header.Get("Authorization"))
+	assert.Equal(t, "/v1/chat?method=get", got.RequestURI)
+	assert.Equal(t, "method=get", got.URL.RawQuery)
+
+	// Обычные запросы не авторизуются параметром.
+	req = httptest.NewRequest(http.MethodGet, "/v1/chat?access_token=token", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, got.Header.Get("Authorization"))
+}
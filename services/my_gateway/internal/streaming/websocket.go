@@ -0,0 +1,249 @@
+package streaming
+
+import (
+	"bytes"
+	"context"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// closeTimeout время на отправку кадра закрытия соединения.
+const closeTimeout = time.Second
+
+// maxMessageSize ограничивает сообщение клиента; большее сообщение закрывает
+// соединение с кодом 1009.
+const maxMessageSize = 1 << 20
+
+// Поддержание соединения: шлюз отправляет ping каждые pingPeriod и обрывает
+// соединение, если клиент ничего не прислал, даже pong, за pongWait. Запись
+// сообщения дольше writeWait тоже обрывает соединение. Переменные, чтобы
+// тесты могли их сократить.
+var (
+	pongWait   = time.Minute
+	pingPeriod = pongWait * 9 / 10
+	writeWait  = 10 * time.Second
+)
+
+// WebSocketProxy передает запросы с Upgrade: websocket в h как потоковые
+// HTTP запросы grpc-gateway: каждое сообщение клиента становится строкой тела
+// запроса, каждое сообщение ответа - сообщением WebSocket. Остальные запросы
+// передаются в h без изменений.
+//
+// CORS не распространяется на WebSocket, поэтому Origin браузера проверяется
+// по allowOrigins: точное совпадение, шаблон вида https://*.example.com или
+// "*" для любого источника. Запросы без Origin, не из браузера, пропускаются.
+//
+// Метод HTTP маршрута передается параметром method (по умолчанию POST, как у
+// потоковых методов в grpc-gateway), токен - параметром access_token, см.
+// AccessTokenHeader.
+func WebSocketProxy(h http.Handler, allowOrigins []string) http.Handler {
+	upgrader := &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || originAllowed(origin, allowOrigins)
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		bridge(h, upgrader, w, r)
+	})
+}
+
+func originAllowed(origin string, allowOrigins []string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range allowOrigins {
+		if allowed == "*" {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(allowed), origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessTokenHeader переносит параметр access_token запроса на открытие
+// WebSocket в заголовок Authorization: браузер не может задать заголовки
+// WebSocket. Должен стоять до журнала запросов и трассировки, чтобы токен не
+// попал в записанный URI.
+func AccessTokenHeader(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !websocket.IsWebSocketUpgrade(r) || !query.Has("access_token") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if token := query.Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		query.Del("access_token")
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+		h.ServeHTTP(w, r)
+	})
+}
+
+func bridge(h http.Handler, upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade уже ответил клиенту ошибкой.
+		log.Debug().Err(err).Msg("failed to upgrade websocket")
+		return
+	}
+	defer conn.Close()
+	// Кадр закрытия от клиента завершает только его поток: ответ на закрытие
+	// отправляется после последнего сообщения сервера.
+	conn.SetCloseHandler(func(int, string) error { return nil })
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	body, bodyWriter := io.Pipe()
+	// Закрытие тела после ответа освобождает readMessages, если клиент
+	// продолжает писать.
+	defer body.Close()
+	go readMessages(conn, bodyWriter, cancel)
+	go keepAlive(ctx, conn)
+
+	writer := &messageWriter{conn: conn, header: http.Header{}}
+	h.ServeHTTP(writer, streamRequest(ctx, r, body))
+	writer.Flush()
+
+	deadline := time.Now().Add(closeTimeout)
+	_ = conn.WriteControl(websocket.CloseMessage, closeMessage(writer.status), deadline)
+}
+
+// closeMessage возвращает кадр закрытия для HTTP статуса ответа: ошибку
+// вызова, например отказ в доступе, клиент видит по коду закрытия, а не
+// только по последнему сообщению.
+func closeMessage(status int) []byte {
+	switch {
+	case status < http.StatusMultipleChoices:
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	case status >= http.StatusInternalServerError:
+		return websocket.FormatCloseMessage(websocket.CloseInternalServerErr, http.StatusText(status))
+	default:
+		return websocket.FormatCloseMessage(websocket.ClosePolicyViolation, http.StatusText(status))
+	}
+}
+
+// keepAlive отправляет ping каждые pingPeriod, пока не завершится ctx.
+// WriteControl можно вызывать одновременно с записью сообщений.
+func keepAlive(ctx context.Context, conn *websocket.Conn) {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				log.Debug().Err(err).Msg("failed to ping websocket")
+				return
+			}
+		}
+	}
+}
+
+// streamRequest переделывает запрос на открытие WebSocket в потоковый запрос
+// к маршруту grpc-gateway с телом body.
+func streamRequest(ctx context.Context, r *http.Request, body io.ReadCloser) *http.Request {
+	req := r.Clone(ctx)
+	req.Method = http.MethodPost
+	query := req.URL.Query()
+	if method := query.Get("method"); method != "" {
+		req.Method = strings.ToUpper(method)
+	}
+	query.Del("method")
+	req.URL.RawQuery = query.Encode()
+
+	for _, header := range []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol"} {
+		req.Header.Del(header)
+	}
+	req.Body = body
+	req.ContentLength = -1
+	return req
+}
+
+// readMessages пишет сообщения клиента в тело запроса построчно. Закрытие
+// соединения клиентом завершает поток клиента, обрыв, слишком большое
+// сообщение или молчание дольше pongWait - отменяют вызов.
+func readMessages(conn *websocket.Conn, body *io.PipeWriter, cancel context.CancelFunc) {
+	conn.SetReadLimit(maxMessageSize)
+	extend := func() { _ = conn.SetReadDeadline(time.Now().Add(pongWait)) }
+	extend()
+	conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				_ = body.Close()
+				return
+			}
+			_ = body.CloseWithError(err)
+			cancel()
+			return
+		}
+		extend()
+		message = append(bytes.TrimRight(message, "\n"), '\n')
+		if _, err := body.Write(message); err != nil {
+			return
+		}
+	}
+}
+
+// messageWriter http.ResponseWriter, отправляющий накопленный ответ
+// сообщением WebSocket на каждый Flush: grpc-gateway сбрасывает ответ после
+// каждого сообщения потока. Статус ответа определяет код закрытия.
+type messageWriter struct {
+	conn   *websocket.Conn
+	header http.Header
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *messageWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *messageWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *messageWriter) FlushError() error {
+	message := bytes.TrimRight(w.buf.Bytes(), "\n")
+	defer w.buf.Reset()
+	if len(message) == 0 {
+		return nil
+	}
+	if err := w.conn.SetWriteDeadline(time.Now().Add(writeWait)); err != nil {
+		return err
+	}
+	return w.conn.WriteMessage(websocket.TextMessage, message)
+}
+
+// Flush отправляет ответ, записанный без сброса, например ошибку вызова.
+func (w *messageWriter) Flush() {
+	if err := w.FlushError(); err != nil {
+		log.Debug().Err(err).Msg("failed to write websocket message")
+	}
+}
@@ -0,0 +1,96 @@
+package transfer
+
+import (
+	"encoding/csv"
+	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+)
+
+// exportColumns колонки CSV выгрузки: колонки импорта и сведения о
+// пользователе, которые импорт игнорирует.
+var exportColumns = append(append([]string{}, csvColumns...), "user_id", "status")
+
+// exportWriter пишет выгрузку по мере получения сообщений потока, не собирая
+// всех пользователей в памяти.
+type exportWriter interface {
+	begin() error
+	write(user *admusrserv1.UserDomains) error
+	end() error
+}
+
+func newExportWriter(format string, w io.Writer) exportWriter {
+	if format == formatJSON {
+		return &jsonExportWriter{w: w}
+	}
+	return &csvExportWriter{w: csv.NewWriter(w)}
+}
+
+// csvExportWriter пишет строку на каждое членство пользователя в домене.
+// Пользователь без доменов выгружается одной строкой с пустыми domain и role.
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) begin() error {
+	return e.w.Write(exportColumns)
+}
+
+func (e *csvExportWriter) write(user *admusrserv1.UserDomains) error {
+	u := user.GetUser()
+	row := func(domain, role string) []string {
+		return []string{u.GetEmail(), u.GetName(), domain, role, u.GetId(), u.GetStatus()}
+	}
+
+	if len(user.GetDomainRoles()) == 0 {
+		if err := e.w.Write(row("", "")); err != nil {
+			return err
+		}
+	}
+	for _, domainRole := range user.GetDomainRoles() {
+		if err := e.w.Write(row(domainRole.GetDomain().GetName(), domainRole.GetRole().GetName())); err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExportWriter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonExportWriter пишет JSON массив UserDomains, по элементу на строку.
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonExportWriter) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExportWriter) write(user *admusrserv1.UserDomains) error {
+	content, err := protojson.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if e.count == 0 {
+		separator = "\n"
+	}
+	e.count++
+	if _, err := io.WriteString(e.w, separator); err != nil {
+		return err
+	}
+	_, err = e.w.Write(content)
+	return err
+}
+
+func (e *jsonExportWriter) end() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
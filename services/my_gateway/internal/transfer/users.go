@@ -0,0 +1,267 @@
+// Package transfer HTTP ручки массовой загрузки и выгрузки пользователей
+// поверх потоковых RPC AdminUsersService.
+package transfer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hughbliss/my_gateway/internal/gateway"
+	"github.com/hughbliss/my_gateway/internal/middleware"
+	"github.com/hughbliss/my_gateway/internal/ratelimit"
+	admusrserv1 "github.com/hughbliss/my_protobuf/go/pkg/gen/admin/users/v1"
+	"github.com/hughbliss/my_toolkit/faultstatus"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// csvColumns колонки CSV файла. Выгрузка в CSV использует те же колонки
+// первыми, поэтому ее можно загрузить обратно без изменений.
+var csvColumns = []string{"email", "name", "domain", "role"}
+
+type UsersTransfer struct {
+	client    admusrserv1.AdminUsersServiceClient
+	authorize middleware.AuthorizeFunc
+}
+
+func NewUsersTransfer(client admusrserv1.AdminUsersServiceClient, authorize middleware.AuthorizeFunc) *UsersTransfer {
+	return &UsersTransfer{
+		client:    client,
+		authorize: authorize,
+	}
+}
+
+// Import принимает multipart форму с файлом "file" (CSV с заголовком
+// email,name,domain,role или JSON массив объектов с теми же полями) и
+// необязательным полем "dry_run". Отвечает отчетом ImportUsersResponse.
+// Доступ проверяется до разбора формы, чтобы не читать файл без прав.
+func (h *UsersTransfer) Import(c echo.Context) error {
+	ctx := outgoingContext(c)
+	method := admusrserv1.AdminUsersService_ImportUsers_FullMethodName
+	if err := h.authorize(ctx, method, nil); err != nil {
+		return writeError(c, err)
+	}
+
+	dryRun, _ := strconv.ParseBool(c.FormValue("dry_run"))
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return writeError(c, status.Error(codes.InvalidArgument, "file is required"))
+	}
+	records, err := readRecords(header, c.FormValue("format"))
+	if err != nil {
+		return writeError(c, status.Error(codes.InvalidArgument, err.Error()))
+	}
+
+	stream, err := h.client.ImportUsers(ctx)
+	if err != nil {
+		return writeError(c, err)
+	}
+	for _, record := range records {
+		if err := stream.Send(&admusrserv1.ImportUsersRequest{DryRun: dryRun, Record: record}); err != nil {
+			if errors.Is(err, io.EOF) {
+				// Сервер завершил поток раньше, причина вернется из CloseAndRecv.
+				break
+			}
+			return writeError(c, err)
+		}
+	}
+	report, err := stream.CloseAndRecv()
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	return writeProto(c, http.StatusOK, report)
+}
+
+// Export отдает пользователей файлом: CSV (по умолчанию, одна строка на
+// членство в домене) или JSON массив UserDomains при format=json. Файл
+// пишется по мере получения потока, см. exportWriter.
+// include_deleted=true добавляет удаленных пользователей.
+func (h *UsersTransfer) Export(c echo.Context) error {
+	format := c.QueryParam("format")
+	if format == "" {
+		format = formatCSV
+	}
+	if format != formatCSV && format != formatJSON {
+		return writeError(c, status.Error(codes.InvalidArgument, "format must be csv or json"))
+	}
+	includeDeleted, _ := strconv.ParseBool(c.QueryParam("include_deleted"))
+
+	request := &admusrserv1.ExportUsersRequest{IncludeDeleted: includeDeleted}
+	ctx := outgoingContext(c)
+	method := admusrserv1.AdminUsersService_ExportUsers_FullMethodName
+	if err := h.authorize(ctx, method, request); err != nil {
+		return writeError(c, err)
+	}
+
+	stream, err := h.client.ExportUsers(ctx, request)
+	if err != nil {
+		return writeError(c, err)
+	}
+
+	// Ошибки авторизации и валидации приходят с первым сообщением, поэтому
+	// заголовки ответа пишутся только после него.
+	first, err := stream.Recv()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return writeError(c, err)
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="users.%s"`, format))
+	if format == formatJSON {
+		w.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	} else {
+		w.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	}
+	w.WriteHeader(http.StatusOK)
+
+	writer := newExportWriter(format, w)
+	if err := writer.begin(); err != nil {
+		return err
+	}
+	for message := first; message != nil; {
+		if err := writer.write(message.GetUserDomains()); err != nil {
+			return err
+		}
+		message, err = stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Заголовки уже отправлены, остается только оборвать файл.
+			c.Logger().Errorf("export users stream failed: %v", err)
+			return nil
+		}
+	}
+	return writer.end()
+}
+
+// outgoingContext переносит заголовки Authorization и Accept-Language в
+// исходящие gRPC метаданные так же, как это делает grpc-gateway.
+func outgoingContext(c echo.Context) context.Context {
+	ctx := c.Request().Context()
+	if authorization := c.Request().Header.Get(echo.HeaderAuthorization); authorization != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", authorization)
+	}
+	if language := c.Request().Header.Get("Accept-Language"); language != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, gateway.AcceptLanguageMetadata, language)
+	}
+	return ctx
+}
+
+func readRecords(header *multipart.FileHeader, format string) ([]*admusrserv1.ImportUserRecord, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if format == "" {
+		format = formatCSV
+		if strings.EqualFold(filepath.Ext(header.Filename), ".json") ||
+			strings.HasPrefix(header.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+			format = formatJSON
+		}
+	}
+
+	switch format {
+	case formatCSV:
+		return readCSV(file)
+	case formatJSON:
+		return readJSON(file)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+func readCSV(r io.Reader) ([]*admusrserv1.ImportUserRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range csvColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("csv column %q is missing", column)
+		}
+	}
+
+	var records []*admusrserv1.ImportUserRecord
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+		records = append(records, &admusrserv1.ImportUserRecord{
+			Email:  row[index["email"]],
+			Name:   row[index["name"]],
+			Domain: row[index["domain"]],
+			Role:   row[index["role"]],
+		})
+	}
+}
+
+func readJSON(r io.Reader) ([]*admusrserv1.ImportUserRecord, error) {
+	var rows []struct {
+		Email  string `json:"email"`
+		Name   string `json:"name"`
+		Domain string `json:"domain"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	records := make([]*admusrserv1.ImportUserRecord, len(rows))
+	for i, row := range rows {
+		records[i] = &admusrserv1.ImportUserRecord{
+			Email:  row.Email,
+			Name:   row.Name,
+			Domain: row.Domain,
+			Role:   row.Role,
+		}
+	}
+	return records, nil
+}
+
+// writeError отвечает статусом gRPC ошибки в формате grpc-gateway.
+func writeError(c echo.Context, err error) error {
+	st := status.Convert(err)
+	ratelimit.SetRetryAfter(c.Response().Header(), st)
+	return writeProto(c, faultstatus.HTTPStatus(st.Code()), st.Proto())
+}
+
+func writeProto(c echo.Context, code int, message interface{ ProtoReflect() protoreflect.Message }) error {
+	content, err := protojson.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return c.Blob(code, echo.MIMEApplicationJSON, content)
+}
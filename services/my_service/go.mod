@@ -13,6 +13,7 @@ require (
 	github.com/hughbliss/my_protobuf v0.0.0
 	github.com/hughbliss/my_toolkit v0.0.0
 	github.com/pkg/errors v0.9.1
+	github.com/rs/zerolog v1.34.0
 	google.golang.org/grpc v1.73.0
 )
 
@@ -26,7 +27,6 @@ require (
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/rs/zerolog v1.34.0 // indirect
 	github.com/valyala/bytebufferpool v1.0.0 // indirect
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
@@ -9,12 +9,21 @@ import (
 	someservicev1 "github.com/hughbliss/my_protobuf/go/pkg/gen/someservice/v1"
 	"github.com/hughbliss/my_service/internal/handler"
 	"github.com/hughbliss/my_service/internal/usecase"
+	"github.com/hughbliss/my_toolkit/faultstatus"
 	"github.com/hughbliss/my_toolkit/grpcerver"
+	"github.com/hughbliss/my_toolkit/health"
+	"github.com/hughbliss/my_toolkit/lifecycle"
+	"github.com/hughbliss/my_toolkit/metrics"
+	"github.com/hughbliss/my_toolkit/reload"
 	"github.com/hughbliss/my_toolkit/reporter"
 	"github.com/hughbliss/my_toolkit/telemetry"
 	"github.com/hughbliss/my_toolkit/telemetry/tracer"
 	traceExporter "github.com/hughbliss/my_toolkit/telemetry/tracer/exporter/jaeger"
 	"github.com/hughbliss/my_toolkit/telemetry/tracer/trace_middleware"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"os"
+	"time"
 )
 
 var (
@@ -23,6 +32,17 @@ var (
 	appName = zfg.Str("app_name", "my_service", "APPNAME")
 	appVer  = zfg.Str("app_ver", "0.0.1", "APPVER", zfg.Alias("v"))
 	env     = zfg.Str("env", "local", "ENV", zfg.Alias("e"))
+
+	meterGroup          = zfg.NewGroup("meter")
+	meterExporterName   = zfg.Str("exporter", metrics.ExporterNone, "METER_EXPORTER", zfg.Group(meterGroup))
+	meterPrometheusAddr = zfg.Str("prometheus_addr", "0.0.0.0:9464", "METER_PROMETHEUSADDR", zfg.Group(meterGroup))
+
+	shutdownGroup   = zfg.NewGroup("shutdown")
+	shutdownTimeout = zfg.Dur("timeout", 15*time.Second, "SHUTDOWN_TIMEOUT", zfg.Group(shutdownGroup))
+
+	healthGroup    = zfg.NewGroup("health")
+	healthInterval = zfg.Dur("interval", 5*time.Second, "HEALTH_INTERVAL", zfg.Group(healthGroup))
+	healthTimeout  = zfg.Dur("timeout", 2*time.Second, "HEALTH_TIMEOUT", zfg.Group(healthGroup))
 )
 
 func initTelemetry() func() {
@@ -34,16 +54,15 @@ func initTelemetry() func() {
 		panic(err)
 	}
 
-	//otlpMeter, err := meterExporter.OTLPMeter(ctx)
-	//if err != nil {
-	//	panic(err)
-	//}
-
 	tracerDown := tracer.Init(ctx, resourceMeta, jaegerExporter)
-	//meterDown := meter.Init(ctx, resourceMeta, otlpMeter)
+
+	meterDown, err := metrics.InitExporter(ctx, resourceMeta, *meterExporterName, *meterPrometheusAddr)
+	if err != nil {
+		panic(err)
+	}
 
 	return func() {
-		//meterDown()
+		meterDown()
 		tracerDown()
 	}
 }
@@ -54,13 +73,29 @@ func Run() {
 	}
 	fmt.Println("starting with config\n", zfg.Show())
 
-	lelemetryDown := initTelemetry()
-	defer lelemetryDown()
+	runner := lifecycle.New(*shutdownTimeout)
+
+	telemetryDown := initTelemetry()
+	runner.OnStop("telemetry", lifecycle.Func(telemetryDown))
 
 	reporter.Init(*appName, *appVer, *env, trace_middleware.HookForLogger())
 
-	s := grpcerver.Init()
-	defer s.GracefulStop()
+	// log.level меняется правкой файла конфигурации без перезапуска.
+	reload.LogLevel("log.level")
+	go reload.WatchConfig(runner.Context(), func(path string, err error) {
+		log.Error().Err(err).Str("path", path).Msg("failed to reload config")
+	})
+
+	s := grpcerver.Init(
+		grpc.ChainUnaryInterceptor(metrics.UnaryServerInterceptor(), faultstatus.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(runner.StreamServerInterceptor(), metrics.StreamServerInterceptor(), faultstatus.StreamServerInterceptor()),
+	)
+
+	// У сервиса нет внешних зависимостей, grpc.health.v1 отвечает SERVING,
+	// пока сервер не остановлен.
+	healthServer := health.NewServer(health.NewChecks(*healthTimeout), *healthInterval)
+	healthServer.Register(s)
+	go healthServer.Run(runner.Context())
 
 	someUsecase := usecase.NewSomeUsecase()
 
@@ -72,10 +107,12 @@ func Run() {
 	if err != nil {
 		panic(err)
 	}
-	defer listener.Close()
 
-	if err := s.Serve(listener); err != nil {
-		panic(err)
-	}
+	runner.Go("grpc", func() error { return s.Serve(listener) })
+	runner.OnStop("grpc", lifecycle.GRPC(s))
 
+	if err := runner.Wait(); err != nil {
+		log.Error().Err(err).Msg("shutdown failed")
+		os.Exit(1)
+	}
 }